@@ -0,0 +1,196 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import "strconv"
+
+// Determines if name is a supported aggregate function.
+func isAggregateFunction(name string) bool {
+	switch name {
+	case "count", "sum", "avg", "min", "max":
+		return true
+	}
+	return false
+}
+
+// aggregate is an incrementally maintained aggregate function over a column.
+// Column is nil for count(*).
+type aggregate struct {
+	name  string
+	fn    string
+	col   *column
+	count int
+	sum   float64
+	// number of records per value for min and max
+	values map[float64]int
+	// current min or max, values are scanned again only when the last record with it is removed
+	extreme float64
+	found   bool
+	stale   bool
+}
+
+// aggregate factory
+func newAggregate(fn string, col *column) *aggregate {
+	agg := &aggregate{
+		fn:  fn,
+		col: col,
+	}
+	if col == nil {
+		agg.name = fn + "(*)"
+	} else {
+		agg.name = fn + "(" + col.name + ")"
+	}
+	if fn == "min" || fn == "max" {
+		agg.values = make(map[float64]int)
+	}
+	return agg
+}
+
+// Adds record value to the aggregate, delta is 1 when record is added and -1 when removed.
+// Values that are not numbers are ignored by all functions but count.
+func (this *aggregate) apply(rec *record, delta int) {
+	if this.col == nil {
+		this.count += delta
+		return
+	}
+	val := rec.getValue(this.col.ordinal)
+	if this.fn == "count" {
+		if len(val) > 0 {
+			this.count += delta
+		}
+		return
+	}
+	num, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return
+	}
+	this.count += delta
+	this.sum += float64(delta) * num
+	if this.values != nil {
+		this.values[num] += delta
+		if this.values[num] <= 0 {
+			delete(this.values, num)
+			if this.found && num == this.extreme {
+				this.stale = true
+			}
+		} else if delta > 0 && !this.stale && (!this.found || this.better(num, this.extreme)) {
+			this.extreme = num
+			this.found = true
+		}
+	}
+}
+
+// Determines if num replaces extreme as min or max.
+func (this *aggregate) better(num float64, extreme float64) bool {
+	if this.fn == "min" {
+		return num < extreme
+	}
+	return num > extreme
+}
+
+// Scans values for min or max after the current one was removed.
+func (this *aggregate) rescan() {
+	this.found = false
+	for num, _ := range this.values {
+		if !this.found || this.better(num, this.extreme) {
+			this.extreme = num
+			this.found = true
+		}
+	}
+	this.stale = false
+}
+
+// Returns current value of the aggregate.
+func (this *aggregate) value() string {
+	switch this.fn {
+	case "count":
+		return strconv.Itoa(this.count)
+	case "sum":
+		return strconv.FormatFloat(this.sum, 'f', -1, 64)
+	case "avg":
+		if this.count == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(this.sum/float64(this.count), 'f', -1, 64)
+	}
+	// min or max
+	if this.stale {
+		this.rescan()
+	}
+	if !this.found {
+		return ""
+	}
+	return strconv.FormatFloat(this.extreme, 'f', -1, 64)
+}
+
+// aggregatePubsub delivers aggregate values to a subscription whenever they change.
+// Records are aggregated as they enter and leave the result set defined by the where clause.
+type aggregatePubsub struct {
+	predicatePubsub
+	aggregates []*aggregate
+	columns    []*column
+	last       []string
+}
+
+// aggregatePubsub factory
+func newAggregatePubsub(conditions []condition, aggregates []*aggregate) *aggregatePubsub {
+	agg := &aggregatePubsub{
+		aggregates: aggregates,
+		columns:    make([]*column, len(aggregates)),
+	}
+	agg.conditions = conditions
+	for idx, a := range aggregates {
+		agg.columns[idx] = newColumn(a.name, idx)
+	}
+	return agg
+}
+
+// Applies record change to aggregates, old is nil for insert and rec is nil for delete.
+// Returns true when record was part of the result set before or after the change.
+func (this *aggregatePubsub) apply(old *record, rec *record) bool {
+	changed := false
+	if old != nil && this.match(old) {
+		for _, a := range this.aggregates {
+			a.apply(old, -1)
+		}
+		changed = true
+	}
+	if rec != nil && this.match(rec) {
+		for _, a := range this.aggregates {
+			a.apply(rec, 1)
+		}
+		changed = true
+	}
+	return changed
+}
+
+// Returns current aggregate values when they differ from the last published values, nil otherwise.
+func (this *aggregatePubsub) values() *record {
+	values := make([]string, len(this.aggregates))
+	changed := this.last == nil
+	for idx, a := range this.aggregates {
+		values[idx] = a.value()
+		if !changed && values[idx] != this.last[idx] {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	this.last = values
+	return &record{values: values}
+}
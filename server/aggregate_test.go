@@ -0,0 +1,70 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import "testing"
+
+func TestAggregate(t *testing.T) {
+	col := newColumn("amount", 1)
+	rec := func(val string) *record {
+		return &record{values: []string{"0", val}}
+	}
+	count := newAggregate("count", nil)
+	countCol := newAggregate("count", col)
+	sum := newAggregate("sum", col)
+	avg := newAggregate("avg", col)
+	min := newAggregate("min", col)
+	max := newAggregate("max", col)
+	all := []*aggregate{count, countCol, sum, avg, min, max}
+	validate := func(values ...string) {
+		for idx, a := range all {
+			if a.value() != values[idx] {
+				t.Errorf("expected %s to be %s but got %s", a.name, values[idx], a.value())
+			}
+		}
+	}
+	validate("0", "0", "0", "", "", "")
+	for _, val := range []string{"10", "2.5", "", "abc", "10"} {
+		for _, a := range all {
+			a.apply(rec(val), 1)
+		}
+	}
+	validate("5", "4", "22.5", "7.5", "2.5", "10")
+	for _, a := range all {
+		a.apply(rec("10"), -1)
+		a.apply(rec("2.5"), -1)
+	}
+	validate("3", "2", "10", "10", "10", "10")
+	// min and max are scanned again only after the current one is removed
+	for _, a := range all {
+		a.apply(rec("5"), 1)
+		a.apply(rec("15"), 1)
+	}
+	ASSERT_TRUE(t, !min.stale && !max.stale, "expected current min and max")
+	validate("5", "4", "30", "10", "5", "15")
+	for _, a := range all {
+		a.apply(rec("5"), -1)
+		a.apply(rec("15"), -1)
+	}
+	ASSERT_TRUE(t, min.stale && max.stale, "expected min and max to be scanned")
+	validate("3", "2", "10", "10", "10", "10")
+	for _, a := range all {
+		a.apply(rec("10"), -1)
+	}
+	validate("2", "1", "0", "", "", "")
+	ASSERT_TRUE(t, count.name == "count(*)" && sum.name == "sum(amount)", "expected aggregate names")
+}
@@ -0,0 +1,87 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import "time"
+
+// changeEpoch is the server start time in the upper half of change sequence numbers.
+// Sequences handed out before a restart belong to another epoch and can not be resumed
+// since changes are not retained across restarts.
+var changeEpoch = uint64(time.Now().Unix()) << 32
+
+// change is a table change retained in the change log.
+// Update changes keep record values before and after the update.
+type change struct {
+	sequence uint64
+	action   string
+	cols     []*column
+	old      *record
+	rec      *record
+}
+
+// changeLog is a bounded ring of the most recent table changes.
+type changeLog struct {
+	changes []*change
+	start   int
+	count   int
+}
+
+// changeLog factory
+func newChangeLog(capacity int) *changeLog {
+	return &changeLog{
+		changes: make([]*change, capacity),
+	}
+}
+
+// Adds change to the log, overwriting the oldest change when the log is full.
+func (this *changeLog) add(c *change) {
+	l := len(this.changes)
+	if l == 0 {
+		return
+	}
+	if this.count < l {
+		this.changes[(this.start+this.count)%l] = c
+		this.count++
+		return
+	}
+	this.changes[this.start] = c
+	this.start = (this.start + 1) % l
+}
+
+// Returns changes that followed a given sequence number.
+// Returns false when the log no longer holds every change after the sequence,
+// the sequence is ahead of the current table sequence or belongs to another epoch.
+func (this *changeLog) since(sequence uint64, current uint64) ([]*change, bool) {
+	if sequence > current || sequence>>32 != current>>32 {
+		return nil, false
+	}
+	if sequence == current {
+		return nil, true
+	}
+	l := len(this.changes)
+	if this.count == 0 || this.changes[this.start].sequence > sequence+1 {
+		return nil, false
+	}
+	changes := make([]*change, 0, current-sequence)
+	for i := 0; i < this.count; i++ {
+		c := this.changes[(this.start+i)%l]
+		if c.sequence > sequence {
+			changes = append(changes, c)
+		}
+	}
+	return changes, true
+}
@@ -0,0 +1,46 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import "testing"
+
+func TestChangeLog(t *testing.T) {
+	log := newChangeLog(3)
+	// empty log
+	_, ok := log.since(0, 0)
+	ASSERT_TRUE(t, ok, "expected nothing to replay")
+	_, ok = log.since(1, 0)
+	ASSERT_TRUE(t, !ok, "expected sequence ahead of table to fail")
+	// fill the log
+	for i := uint64(1); i <= 3; i++ {
+		log.add(&change{sequence: i, action: "insert"})
+	}
+	changes, ok := log.since(0, 3)
+	ASSERT_TRUE(t, ok && len(changes) == 3, "expected 3 changes")
+	changes, ok = log.since(2, 3)
+	ASSERT_TRUE(t, ok && len(changes) == 1 && changes[0].sequence == 3, "expected last change")
+	// overwrite oldest
+	log.add(&change{sequence: 4, action: "delete"})
+	_, ok = log.since(0, 4)
+	ASSERT_TRUE(t, !ok, "expected truncated log")
+	changes, ok = log.since(1, 4)
+	ASSERT_TRUE(t, ok && len(changes) == 3, "expected 3 changes")
+	ASSERT_TRUE(t, changes[0].sequence == 2 && changes[2].sequence == 4, "expected changes in sequence order")
+	// sequence of another epoch
+	_, ok = log.since(1, changeEpoch+4)
+	ASSERT_TRUE(t, !ok, "expected sequence of another epoch to fail")
+}
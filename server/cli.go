@@ -18,6 +18,9 @@ package server
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
 	"net"
 	"os"
 	"strconv"
@@ -95,6 +98,125 @@ func (this *cli) runOnce(command string) {
 	}
 }
 
+// backupMessage is a server response received by backup and restore commands.
+type backupMessage struct {
+	Status   string          `json:"status"`
+	Msg      string          `json:"msg"`
+	Tables   int             `json:"tables"`
+	Table    string          `json:"table"`
+	Snapshot json.RawMessage `json:"snapshot"`
+}
+
+// Sends the command and returns the next server response.
+func (this *cli) command(rw *netHelper, command []byte) (*backupMessage, error) {
+	this.requestId++
+	if err := rw.writeHeaderAndMessage(this.requestId, command); err != nil {
+		return nil, err
+	}
+	return this.readBackupMessage(rw)
+}
+
+// Reads the next server response, error response is returned as error.
+func (this *cli) readBackupMessage(rw *netHelper) (*backupMessage, error) {
+	_, bytes, err := rw.readMessage()
+	if err != nil {
+		return nil, err
+	}
+	message := new(backupMessage)
+	if err = json.Unmarshal(bytes, message); err != nil {
+		return nil, err
+	}
+	if message.Status != "ok" {
+		return nil, errors.New(message.Msg)
+	}
+	return message, nil
+}
+
+// runBackup streams dump of all tables from the server to the backup file.
+// Backup file has the snapshot file format and can also be restored on start.
+func (this *cli) runBackup(path string) bool {
+	if !this.connect() {
+		return false
+	}
+	defer this.conn.Close()
+	rw := newNetHelper(this.conn, config.NET_READWRITE_BUFFER_SIZE)
+	message, err := this.command(rw, []byte("backup"))
+	if err != nil {
+		logError("backup failed:", err.Error())
+		return false
+	}
+	temp := path + ".tmp"
+	file, err := os.Create(temp)
+	if err != nil {
+		logError("backup failed:", err.Error())
+		return false
+	}
+	writer := bufio.NewWriter(file)
+	tables := message.Tables
+	for i := 0; i < tables && err == nil; i++ {
+		if message, err = this.readBackupMessage(rw); err == nil {
+			if _, err = writer.Write(message.Snapshot); err == nil {
+				err = writer.WriteByte('\n')
+			}
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err == nil {
+		err = os.Rename(temp, path)
+	}
+	if err != nil {
+		os.Remove(temp)
+		logError("backup failed:", err.Error())
+		return false
+	}
+	logInfo("backup of", tables, "tables was written to", path)
+	return true
+}
+
+// runRestore loads every table of the backup file into the server.
+// Server must be empty, restore stops at the first table that can not be restored.
+func (this *cli) runRestore(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		logError("restore failed:", err.Error())
+		return false
+	}
+	defer file.Close()
+	if !this.connect() {
+		return false
+	}
+	defer this.conn.Close()
+	rw := newNetHelper(this.conn, config.NET_READWRITE_BUFFER_SIZE)
+	reader := bufio.NewReader(file)
+	tables := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			logError("restore failed:", err.Error())
+			return false
+		}
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		if _, err = this.command(rw, append([]byte("restore "), line...)); err != nil {
+			logError("restore failed:", err.Error())
+			return false
+		}
+		tables++
+	}
+	logInfo(tables, "tables were restored from", path)
+	return true
+}
+
 // run is an event loop function that receives a command line input and forwards it to the server.
 func (this *cli) run() {
 	// by default connect to local host
@@ -44,11 +44,33 @@ type configuration struct {
 	TABLE_COLUMNS_CAPACITY                    int
 	TABLE_RECORDS_CAPACITY                    int
 	TABLE_GET_RECORDS_BY_TAG_CAPACITY         int
+	TABLE_CHANGE_LOG_CAPACITY                 int
+	DURABLE_MAX_UNACKED                       int
+	TRIGGER_MAX_DEPTH                         int
 	WAIT_MILLISECOND_SERVER_SHUTDOWN          time.Duration
 	WAIT_MILLISECOND_CLI_SHUTDOWN             time.Duration
 	DATA_BATCH_SIZE                           int
 	NET_READWRITE_BUFFER_SIZE                 int
 
+	// slow consumer
+	SLOW_CONSUMER_POLICY  slowConsumerPolicy
+	SLOW_CONSUMER_TIMEOUT time.Duration
+	SPILL_BUFFER_SIZE     int
+
+	// write-ahead log
+	WAL_PATH             string
+	WAL_SYNC_POLICY      walSyncPolicy
+	WAL_SYNC_INTERVAL    time.Duration
+	WAL_COMPACT_INTERVAL time.Duration
+
+	// snapshots
+	SNAPSHOT_PATH     string
+	SNAPSHOT_INTERVAL time.Duration
+	RESTORE_PATH      string
+
+	// online backup
+	BACKUP_PATH string
+
 	// command
 	COMMAND string
 
@@ -83,11 +105,33 @@ func defaultConfig() configuration {
 		TABLE_COLUMNS_CAPACITY:                    10,
 		TABLE_RECORDS_CAPACITY:                    1000,
 		TABLE_GET_RECORDS_BY_TAG_CAPACITY:         20,
+		TABLE_CHANGE_LOG_CAPACITY:                 1000,
+		DURABLE_MAX_UNACKED:                       10000,
+		TRIGGER_MAX_DEPTH:                         16,
 		WAIT_MILLISECOND_SERVER_SHUTDOWN:          3000,
 		WAIT_MILLISECOND_CLI_SHUTDOWN:             1000,
 		DATA_BATCH_SIZE:                           100,
 		NET_READWRITE_BUFFER_SIZE:                 2048,
 
+		// slow consumer
+		SLOW_CONSUMER_POLICY:  slowConsumerDisconnect,
+		SLOW_CONSUMER_TIMEOUT: 1000,
+		SPILL_BUFFER_SIZE:     64 * 1024 * 1024,
+
+		// write-ahead log
+		WAL_PATH:             "",
+		WAL_SYNC_POLICY:      walSyncAlways,
+		WAL_SYNC_INTERVAL:    0,
+		WAL_COMPACT_INTERVAL: 300 * time.Second,
+
+		// snapshots
+		SNAPSHOT_PATH:     "",
+		SNAPSHOT_INTERVAL: 0,
+		RESTORE_PATH:      "",
+
+		// online backup
+		BACKUP_PATH: "",
+
 		// command
 		COMMAND: "start",
 
@@ -100,10 +144,12 @@ func defaultConfig() configuration {
 var config = defaultConfig()
 
 var validCommands = map[string] string {
-	"start": "",
-	"cli":   "",
-	"help":  "",
-	"stop":  "",
+	"start":   "",
+	"cli":     "",
+	"help":    "",
+	"stop":    "",
+	"backup":  "",
+	"restore": "",
 }
 
 func validCommandsUsageString() string {
@@ -150,6 +196,22 @@ func (this *configuration) processCommandLine(args []string) bool {
 	this.flags.StringVar(&logLevel, "loglevel", "info,warn,error", `logging level "debug,info,warn,error"`)
 	this.flags.StringVar(&this.IP, "ip", config.IP, "ip address")
 	this.flags.UintVar(&this.PORT, "port", config.PORT, "port number")
+	var slowConsumer string
+	this.flags.StringVar(&slowConsumer, "slowconsumer", "disconnect", `slow consumer policy "disconnect|block|dropoldest|dropnewest|spill"`)
+	var slowConsumerTimeout uint
+	this.flags.UintVar(&slowConsumerTimeout, "slowconsumertimeout", uint(config.SLOW_CONSUMER_TIMEOUT), "block slow consumer policy timeout in milliseconds")
+	this.flags.StringVar(&this.WAL_PATH, "wal", config.WAL_PATH, "write-ahead log directory, logging is disabled when empty")
+	var walSync string
+	this.flags.StringVar(&walSync, "walsync", "always", `write-ahead log sync policy "always|never|<N>ms"`)
+	var walCompactInterval uint
+	this.flags.UintVar(&walCompactInterval, "walcompactinterval", uint(config.WAL_COMPACT_INTERVAL / time.Second), "write-ahead log compaction interval in seconds, 0 disables compaction")
+	this.flags.StringVar(&this.SNAPSHOT_PATH, "snapshot", config.SNAPSHOT_PATH, "snapshot file written by snapshot command and periodic snapshots")
+	var snapshotInterval uint
+	this.flags.UintVar(&snapshotInterval, "snapshotinterval", 0, "periodic snapshot interval in seconds, 0 disables periodic snapshots")
+	this.flags.StringVar(&this.RESTORE_PATH, "restore", config.RESTORE_PATH, "snapshot file to restore tables from on start")
+	this.flags.StringVar(&this.BACKUP_PATH, "file", config.BACKUP_PATH, "backup file written by backup command and loaded by restore command")
+	var changeLogCapacity uint
+	this.flags.UintVar(&changeLogCapacity, "changelog", uint(config.TABLE_CHANGE_LOG_CAPACITY), "number of recent changes kept per table to resume subscriptions, 0 disables resume")
 
 	// set command
 	if len(args) > 0 {
@@ -180,6 +242,33 @@ func (this *configuration) processCommandLine(args []string) bool {
 		return false
 	}
 
+	// set slow consumer policy
+	policy, valid := parseSlowConsumerPolicy(slowConsumer)
+	if !valid {
+		fmt.Println("invalid --slowconsumer \"" + slowConsumer + "\"\n" + this.flags.Lookup("slowconsumer").Usage)
+		return false
+	}
+	this.SLOW_CONSUMER_POLICY = policy
+	this.SLOW_CONSUMER_TIMEOUT = time.Duration(slowConsumerTimeout)
+
+	// set write-ahead log sync policy
+	walPolicy, walInterval, valid := parseWalSyncPolicy(walSync)
+	if !valid {
+		fmt.Println("invalid --walsync \"" + walSync + "\"\n" + this.flags.Lookup("walsync").Usage)
+		return false
+	}
+	this.WAL_SYNC_POLICY = walPolicy
+	this.WAL_SYNC_INTERVAL = walInterval
+	this.WAL_COMPACT_INTERVAL = time.Duration(walCompactInterval) * time.Second
+	this.SNAPSHOT_INTERVAL = time.Duration(snapshotInterval) * time.Second
+	this.TABLE_CHANGE_LOG_CAPACITY = int(changeLogCapacity)
+
+	// backup and restore need the backup file
+	if (this.COMMAND == "backup" || this.COMMAND == "restore") && len(this.BACKUP_PATH) == 0 {
+		fmt.Println("missing --file for " + this.COMMAND + " command\n" + this.flags.Lookup("file").Usage)
+		return false
+	}
+
 	// check if there is extra stuff
 	if this.flags.NArg() > 0 {
 		fmt.Println("invalid command line arrguments")
@@ -18,6 +18,7 @@ package server
 
 import "testing"
 import "strconv"
+import "time"
 
 func ASSERT_TRUE(t *testing.T, value bool, message string) {
 	if !value {
@@ -124,3 +125,45 @@ func TestConfigInvalid(t *testing.T) {
 	c = defaultConfig()
 	ASSERT_FALSE(t, c.processCommandLine(args), "invalid arguments")
 }
+
+func TestConfigWriteAheadLog(t *testing.T) {
+	args := []string{"start", "--wal", "/tmp/pubsubsql", "--walsync", "100ms"}
+	c := defaultConfig()
+	ASSERT_TRUE(t, c.processCommandLine(args), "processCommandLine")
+	ASSERT_TRUE(t, c.WAL_PATH == "/tmp/pubsubsql", "wal")
+	ASSERT_TRUE(t, c.WAL_SYNC_POLICY == walSyncInterval && c.WAL_SYNC_INTERVAL == 100*time.Millisecond, "walsync")
+	//
+	args = []string{"start", "--walsync", "sometimes"}
+	c = defaultConfig()
+	ASSERT_FALSE(t, c.processCommandLine(args), "invalid walsync")
+}
+
+func TestConfigSnapshot(t *testing.T) {
+	args := []string{"start", "--snapshot", "/tmp/pubsubsql.snapshot", "--snapshotinterval", "60", "--restore", "/tmp/backup.snapshot"}
+	c := defaultConfig()
+	ASSERT_TRUE(t, c.processCommandLine(args), "processCommandLine")
+	ASSERT_TRUE(t, c.SNAPSHOT_PATH == "/tmp/pubsubsql.snapshot", "snapshot")
+	ASSERT_TRUE(t, c.SNAPSHOT_INTERVAL == 60*time.Second, "snapshotinterval")
+	ASSERT_TRUE(t, c.RESTORE_PATH == "/tmp/backup.snapshot", "restore")
+}
+
+func TestConfigChangeLog(t *testing.T) {
+	c := defaultConfig()
+	ASSERT_TRUE(t, c.processCommandLine([]string{"start", "--changelog", "100"}), "processCommandLine")
+	ASSERT_TRUE(t, c.TABLE_CHANGE_LOG_CAPACITY == 100, "changelog")
+	c = defaultConfig()
+	ASSERT_FALSE(t, c.processCommandLine([]string{"start", "--changelog", "-1"}), "invalid changelog")
+}
+
+func TestConfigBackup(t *testing.T) {
+	c := defaultConfig()
+	ASSERT_TRUE(t, c.processCommandLine([]string{"backup", "--file", "/tmp/pubsubsql.backup"}), "processCommandLine")
+	ASSERT_TRUE(t, c.COMMAND == "backup", "backup")
+	ASSERT_TRUE(t, c.BACKUP_PATH == "/tmp/pubsubsql.backup", "file")
+	c = defaultConfig()
+	ASSERT_TRUE(t, c.processCommandLine([]string{"restore", "--file", "/tmp/pubsubsql.backup"}), "processCommandLine")
+	ASSERT_TRUE(t, c.COMMAND == "restore", "restore")
+	// backup file is required
+	c = defaultConfig()
+	ASSERT_FALSE(t, c.processCommandLine([]string{"restore"}), "missing file")
+}
@@ -26,6 +26,7 @@ import (
 // Controller is a container that initializes, binds and controls server components.
 type Controller struct {
 	network			*network
+	dataService		*dataService
 	requests chan	*requestItem
 	quit			*Quitter
 }
@@ -47,6 +48,10 @@ func (this *Controller) Run() {
 		this.runAsServer()
 	case "stop":
 		this.runOnce("stop")
+	case "backup":
+		newCli().runBackup(config.BACKUP_PATH)
+	case "restore":
+		newCli().runRestore(config.BACKUP_PATH)
 	}
 }
 
@@ -80,6 +85,14 @@ func (this *Controller) runAsServer() {
 	this.requests = make(chan *requestItem)
 	// data service
 	dataService := newDataService(this.quit)
+	dataService.snapshotPath = config.SNAPSHOT_PATH
+	dataService.snapshotInterval = config.SNAPSHOT_INTERVAL
+	dataService.compactInterval = config.WAL_COMPACT_INTERVAL
+	this.dataService = dataService
+	if !this.restore(dataService) {
+		this.quit.Quit(0)
+		return
+	}
 	go dataService.run()
 	// router
 	router := newRequestRouter(dataService)
@@ -114,6 +127,25 @@ LOOP:
 	info("stopped")
 }
 
+// restore rebuilds tables from the snapshot and write-ahead log before clients are accepted.
+func (this *Controller) restore(dataService *dataService) bool {
+	var err error
+	if len(config.WAL_PATH) > 0 {
+		dataService.wal, err = newWriteAheadLog(config.WAL_PATH, config.WAL_SYNC_POLICY, config.WAL_SYNC_INTERVAL)
+	}
+	if err == nil {
+		err = dataService.restore(config.RESTORE_PATH)
+	}
+	if err != nil {
+		logError("failed to restore tables:", err.Error())
+		return false
+	}
+	if dataService.wal != nil {
+		go dataService.wal.run(this.quit)
+	}
+	return true
+}
+
 // readInput reads a command line input from the standard until quit (q) input.
 func (this *Controller) readInput() {
 	cin := newLineReader("q")
@@ -132,6 +164,8 @@ func (this *Controller) onCommandRequest(item *requestItem) {
 			return
 		}
 		res := newCmdStatusResponse(this.network.connectionCount())
+		res.dropped, res.spilled = this.network.slowConsumerCounters()
+		res.walSize, res.lastSnapshot, res.replayDuration = this.dataService.persistenceStatus()
 		res.requestId = item.getRequestId()
 		item.sender.send(res)
 	case *cmdStopRequest:
@@ -16,6 +16,15 @@
 
 package server
 
+import (
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
 // requestItem is a container for client request and sender used to send back responses
 type requestItem struct {
 	header *netHeader
@@ -34,18 +43,57 @@ func (this *requestItem) getRequestId() uint32 {
 // dataService pre-processes sqlRequests and forwards them to approptiate tables for further proccessging.
 // It servers as a collection container for tables.
 type dataService struct {
-	requests chan *requestItem
-	quit     *Quitter
-	tables   map[string]*table
+	requests  chan *requestItem
+	quit      *Quitter
+	tables    map[string]*table
+	topics    *topicBroker
+	wildcards *wildcardBroker
+	schema    *schemaBroker
+	registry  *subscriptionRegistry
+	durables  *durableBroker
+	triggers  map[string]*trigger
+	// write-ahead log, nil when logging is disabled
+	wal *writeAheadLog
+	// snapshot file, periodic snapshots are disabled when interval is 0
+	snapshotPath     string
+	snapshotInterval time.Duration
+	snapshotting     int32
+	// write-ahead log compaction is disabled when interval is 0
+	compactInterval time.Duration
+	// persistence status
+	statusMutex    sync.Mutex
+	lastSnapshot   time.Time
+	replayDuration time.Duration
+	// requests posted by tables and sender used for them
+	mutex    sync.Mutex
+	posted   []*requestItem
+	notify   chan struct{}
+	internal *responseSender
+	// restore is only allowed into an empty server, the connection that started it restores the rest of the tables
+	restorer uint64
+	restored map[string]bool
 }
 
 // newDataService returns new dataService.
 func newDataService(quit *Quitter) *dataService {
-	return &dataService{
-		requests: make(chan *requestItem, config.CHAN_DATA_SERVICE_REQUESTS_BUFFER_SIZE),
-		quit:     quit,
-		tables:   make(map[string]*table),
+	this := &dataService{
+		requests:  make(chan *requestItem, config.CHAN_DATA_SERVICE_REQUESTS_BUFFER_SIZE),
+		quit:      quit,
+		tables:    make(map[string]*table),
+		topics:    newTopicBroker(),
+		wildcards: newWildcardBroker(),
+		schema:    newSchemaBroker(),
+		registry:  newSubscriptionRegistry(),
+		durables:  newDurableBroker(),
+		triggers:  make(map[string]*trigger),
+		notify:    make(chan struct{}, 1),
+		internal:  newResponseSenderStub(0),
 	}
+	// nobody reads responses to posted requests
+	this.internal.setPolicy(slowConsumerDropOldest, 0)
+	this.topics.registry = this.registry
+	this.schema.registry = this.registry
+	return this
 }
 
 // acceptRequest accepts the request from a client.
@@ -56,10 +104,50 @@ func (this *dataService) acceptRequest(item *requestItem) {
 	}
 }
 
+// post queues request issued by a table, responses go to the sender or are discarded when it is nil.
+// It never blocks so that table event loop can not deadlock with data service forwarding requests to the table.
+func (this *dataService) post(req request, sender *responseSender) {
+	if this == nil {
+		return
+	}
+	if sender == nil {
+		req.setStreaming()
+		sender = this.internal
+	}
+	this.mutex.Lock()
+	this.posted = append(this.posted, &requestItem{req: req, sender: sender})
+	this.mutex.Unlock()
+	select {
+	case this.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Returns posted requests in the order they were posted.
+func (this *dataService) takePosted() []*requestItem {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	posted := this.posted
+	this.posted = nil
+	return posted
+}
+
 // run is an event loop function that recieves sql requests from connected clients and forwards them for further processing.
 func (this *dataService) run() {
 	this.quit.Join()
 	defer this.quit.Leave()
+	var snapshotTick <-chan time.Time
+	if len(this.snapshotPath) > 0 && this.snapshotInterval > 0 {
+		ticker := time.NewTicker(this.snapshotInterval)
+		defer ticker.Stop()
+		snapshotTick = ticker.C
+	}
+	var compactTick <-chan time.Time
+	if this.wal != nil && this.compactInterval > 0 {
+		ticker := time.NewTicker(this.compactInterval)
+		defer ticker.Stop()
+		compactTick = ticker.C
+	}
 	for {
 		select {
 		case item := <-this.requests:
@@ -68,6 +156,14 @@ func (this *dataService) run() {
 				return
 			}
 			this.onSqlRequest(item)
+		case <-this.notify:
+			for _, item := range this.takePosted() {
+				this.onSqlRequest(item)
+			}
+		case <-snapshotTick:
+			this.snapshot(nil)
+		case <-compactTick:
+			this.compact()
 		case <-this.quit.GetChan():
 			debug("data service exited due to quit notification")
 			return
@@ -77,17 +173,77 @@ func (this *dataService) run() {
 
 // onSqlRequest forwards sql request to the appropriate table.
 func (this *dataService) onSqlRequest(item *requestItem) {
-	tableName := item.req.getTableName()
-	tbl := this.tables[tableName]
-	if tbl == nil {
-		// auto create table and go run table event loop
-		tbl = newTable(tableName)
-		this.tables[tableName] = tbl
-		tbl.quit = this.quit
-		tbl.requests = make(chan *requestItem, config.CHAN_TABLE_REQUESTS_BUFFER_SIZE)
-		logInfo("table", tableName, "was created; connection:", item.sender.connectionId)
-		go tbl.run()
+	switch item.req.(type) {
+	case *sqlConnectionClosedRequest:
+		this.topics.connectionClosed(item.req.(*sqlConnectionClosedRequest).connectionId)
+		this.wildcards.connectionClosed(item.req.(*sqlConnectionClosedRequest).connectionId)
+		this.schema.connectionClosed(item.req.(*sqlConnectionClosedRequest).connectionId)
+		this.forwardToAllTables(item)
+		return
+	case *sqlSubscribeTopicRequest:
+		req := item.req.(*sqlSubscribeTopicRequest)
+		req.sender = item.sender
+		this.send(item, this.topics.subscribe(req))
+		return
+	case *sqlUnsubscribeTopicRequest:
+		req := item.req.(*sqlUnsubscribeTopicRequest)
+		req.connectionId = item.sender.connectionId
+		this.send(item, this.topics.unsubscribe(req))
+		return
+	case *sqlPublishRequest:
+		this.send(item, this.topics.publish(item.req.(*sqlPublishRequest)))
+		return
+	case *sqlSubscribeSchemaRequest:
+		req := item.req.(*sqlSubscribeSchemaRequest)
+		req.sender = item.sender
+		this.send(item, this.schema.subscribe(req))
+		return
+	case *sqlUnsubscribeSchemaRequest:
+		req := item.req.(*sqlUnsubscribeSchemaRequest)
+		req.connectionId = item.sender.connectionId
+		this.send(item, this.schema.unsubscribe(req))
+		return
+	case *cmdSnapshotRequest:
+		this.snapshot(item)
+		return
+	case *cmdBackupRequest:
+		this.backup(item)
+		return
+	case *cmdRestoreRequest:
+		this.onRestore(item)
+		return
+	case *sqlCreateTriggerRequest:
+		if !this.onSqlCreateTrigger(item) {
+			return
+		}
+	case *sqlDropTriggerRequest:
+		if !this.onSqlDropTrigger(item) {
+			return
+		}
+	case *sqlShowSubscriptionsRequest:
+		this.send(item, newShowSubscriptionsResponse(this.registry.list(item.req.getTableName())))
+		return
+	case *sqlKillSubscriptionRequest:
+		this.onSqlKillSubscription(item)
+		return
+	case *sqlAckRequest:
+		this.send(item, this.durables.ack(item.req.(*sqlAckRequest), item.sender))
+		return
+	case *sqlSubscribeRequest:
+		if isTablePattern(item.req.getTableName()) {
+			this.onSqlSubscribeWildcard(item)
+			return
+		}
+		if !this.onSqlSubscribeDurable(item) {
+			return
+		}
+	case *sqlUnsubscribeRequest:
+		if isTablePattern(item.req.getTableName()) {
+			this.onSqlUnsubscribeWildcard(item)
+			return
+		}
 	}
+	tbl := this.getAddTable(item.req.getTableName(), item.sender.connectionId)
 	switch item.req.(type) {
 	case *mysqlSubscribeRequest:
 		info("database operation onMysqlSubscribe:", item.req.getTableName())
@@ -99,3 +255,403 @@ func (this *dataService) onSqlRequest(item *requestItem) {
 	// forward sql request to the table
 	tbl.requests <- item
 }
+
+// Retrieves existing table or creates it if does not exist.
+// Newly created table receives subscriptions of matching wildcard subscribers.
+func (this *dataService) getAddTable(tableName string, connectionId uint64) *table {
+	tbl := this.tables[tableName]
+	if tbl == nil {
+		// auto create table and go run table event loop
+		tbl = this.addTable(tableName, connectionId)
+		tbl.wal = this.wal.open(tableName, 0)
+		this.runTable(tbl)
+	}
+	return tbl
+}
+
+// Starts event loop of newly created table and subscribes matching wildcard subscribers.
+func (this *dataService) runTable(tbl *table) {
+	go tbl.run()
+	for _, item := range this.wildcards.tableRequests(tbl.name) {
+		tbl.requests <- item
+	}
+}
+
+// Creates table bound to the data service without starting its event loop.
+func (this *dataService) addTable(tableName string, connectionId uint64) *table {
+	tbl := newTable(tableName)
+	this.tables[tableName] = tbl
+	tbl.quit = this.quit
+	tbl.requests = make(chan *requestItem, config.CHAN_TABLE_REQUESTS_BUFFER_SIZE)
+	tbl.schema = this.schema
+	tbl.registry = this.registry
+	tbl.service = this
+	logInfo("table", tableName, "was created; connection:", connectionId)
+	this.schema.publish("create", tableName, "")
+	return tbl
+}
+
+// restore rebuilds tables from the snapshot and replays write-ahead log entries written after it.
+// Tables are first recovered from the snapshot written by log compaction since log entries it includes were truncated,
+// table of the snapshot at the path replaces the compacted one only when it is more recent.
+// Restored tables resume logging of their mutations.
+// It must be called before the data service event loop is started.
+func (this *dataService) restore(snapshotPath string) error {
+	started := time.Now()
+	snapshots := make(map[string]*tableSnapshot)
+	if this.wal != nil {
+		if _, err := os.Stat(this.wal.snapshotPath()); err == nil {
+			tables, err := readSnapshot(this.wal.snapshotPath())
+			if err != nil {
+				return err
+			}
+			for _, snap := range tables {
+				snapshots[snap.Table] = snap
+			}
+		}
+	}
+	if len(snapshotPath) > 0 {
+		tables, err := readSnapshot(snapshotPath)
+		if err != nil {
+			return err
+		}
+		for _, snap := range tables {
+			if prev := snapshots[snap.Table]; prev != nil && prev.Seq >= snap.Seq {
+				continue
+			}
+			snapshots[snap.Table] = snap
+		}
+	}
+	logs := make(map[string][]*walEntry)
+	if this.wal != nil {
+		tables, err := this.wal.tables()
+		if err != nil {
+			return err
+		}
+		for _, tableName := range tables {
+			path := this.wal.path(tableName)
+			entries, size, err := readLog(path)
+			if err != nil {
+				return err
+			}
+			// drop incomplete entry so that new entries start on a new line
+			if err = os.Truncate(path, size); err != nil {
+				return err
+			}
+			logs[tableName] = entries
+		}
+	}
+	tables := make([]string, 0, len(snapshots)+len(logs))
+	for tableName, _ := range snapshots {
+		tables = append(tables, tableName)
+	}
+	for tableName, _ := range logs {
+		if snapshots[tableName] == nil {
+			tables = append(tables, tableName)
+		}
+	}
+	sort.Strings(tables)
+	for _, tableName := range tables {
+		tbl := this.addTable(tableName, 0)
+		var seq uint64
+		var entries []*walEntry
+		if snap := snapshots[tableName]; snap != nil {
+			tbl.restore(snap)
+			seq = snap.Seq
+			entries = snap.Scheduled
+		}
+		// entries logged after the snapshot
+		for _, entry := range logs[tableName] {
+			if entry.Seq > seq {
+				entries = append(entries, entry)
+				seq = entry.Seq
+			}
+		}
+		tbl.replay(entries)
+		tbl.wal = this.wal.open(tableName, seq)
+		logInfo("table", tableName, "was restored")
+		go tbl.run()
+	}
+	this.statusMutex.Lock()
+	this.replayDuration = time.Since(started)
+	this.statusMutex.Unlock()
+	return nil
+}
+
+// snapshot writes snapshot of all tables to the snapshot file, item is nil for periodic snapshots.
+func (this *dataService) snapshot(item *requestItem) {
+	if len(this.snapshotPath) == 0 {
+		this.sendSnapshotResponse(item, newErrorResponse("snapshot path is not configured"))
+		return
+	}
+	started := this.writeSnapshot(this.snapshotPath, func(writer *snapshotWriter, err error) {
+		if err != nil {
+			logError("failed to write snapshot", this.snapshotPath, err.Error())
+			this.sendSnapshotResponse(item, newErrorResponse("snapshot failed: "+err.Error()))
+			return
+		}
+		logInfo("snapshot of", writer.count, "tables was written to", this.snapshotPath)
+		this.sendSnapshotResponse(item, newOkResponse("snapshot"))
+	})
+	if !started {
+		this.sendSnapshotResponse(item, newErrorResponse("snapshot is already in progress"))
+	}
+}
+
+// compact writes snapshot next to the write-ahead log and removes entries included in it from table logs.
+func (this *dataService) compact() {
+	if this.wal.size() == 0 {
+		return
+	}
+	this.writeSnapshot(this.wal.snapshotPath(), func(writer *snapshotWriter, err error) {
+		if err != nil {
+			logError("write-ahead log compaction failed:", err.Error())
+			return
+		}
+		this.wal.truncate(writer.sequences)
+		debug("write-ahead log was compacted")
+	})
+}
+
+// writeSnapshot asks every table to serialize its state and writes the snapshot file in the background.
+// Tables receive the request after all requests accepted before it, done is called when the file is written.
+// Returns false when another snapshot is in progress.
+func (this *dataService) writeSnapshot(path string, done func(*snapshotWriter, error)) bool {
+	if !atomic.CompareAndSwapInt32(&this.snapshotting, 0, 1) {
+		return false
+	}
+	writer := this.requestSnapshots(path)
+	go func() {
+		err := writer.write(this.quit)
+		if err == nil {
+			this.statusMutex.Lock()
+			this.lastSnapshot = time.Now()
+			this.statusMutex.Unlock()
+		}
+		done(writer, err)
+		atomic.StoreInt32(&this.snapshotting, 0)
+	}()
+	return true
+}
+
+// requestSnapshots asks every table to serialize its state to the returned writer.
+func (this *dataService) requestSnapshots(path string) *snapshotWriter {
+	writer := newSnapshotWriter(path, len(this.tables))
+	req := &sqlSnapshotRequest{writer: writer}
+	for _, tbl := range this.tables {
+		tbl.requests <- &requestItem{req: req, sender: this.internal}
+	}
+	return writer
+}
+
+// backup streams dump of all tables to the client.
+// Tables are serialized at the same point of the request stream as snapshots are.
+func (this *dataService) backup(item *requestItem) {
+	if item.req.isStreaming() {
+		return
+	}
+	logInfo("client connection:", item.sender.connectionId, "requested backup of", len(this.tables), "tables")
+	writer := this.requestSnapshots("")
+	go this.streamBackup(item, writer)
+}
+
+// streamBackup sends number of tables followed by table dumps in the order tables serialize them.
+func (this *dataService) streamBackup(item *requestItem, writer *snapshotWriter) {
+	res := newCmdBackupResponse(writer.count)
+	res.requestId = item.getRequestId()
+	if !item.sender.sendWait(res, this.quit) {
+		return
+	}
+	for i := 0; i < writer.count; i++ {
+		serialized, err := writer.next(this.quit)
+		if err != nil {
+			logError("backup failed:", err.Error())
+			res := newErrorResponse("backup failed: " + err.Error())
+			res.requestId = item.getRequestId()
+			item.sender.sendWait(res, this.quit)
+			return
+		}
+		res := newCmdBackupTableResponse(serialized)
+		res.requestId = item.getRequestId()
+		if !item.sender.sendWait(res, this.quit) {
+			return
+		}
+	}
+}
+
+// onRestore creates table from the dump streamed by backup, the table must not exist.
+func (this *dataService) onRestore(item *requestItem) {
+	snap := item.req.(*cmdRestoreRequest).snap
+	if len(this.tables) == 0 {
+		this.restorer = item.sender.connectionId
+		this.restored = make(map[string]bool)
+	}
+	if !this.restoring(item.sender.connectionId) {
+		this.send(item, newErrorResponse("restore requires an empty server"))
+		return
+	}
+	if this.tables[snap.Table] != nil {
+		this.send(item, newErrorResponse("table: "+snap.Table+" already exists"))
+		return
+	}
+	this.restored[snap.Table] = true
+	tbl := this.addTable(snap.Table, item.sender.connectionId)
+	tbl.wal = this.wal.open(snap.Table, 0)
+	tbl.load(snap)
+	this.runTable(tbl)
+	logInfo("table", snap.Table, "was restored; connection:", item.sender.connectionId)
+	this.send(item, newOkResponse("restore"))
+}
+
+// Determines if the connection restores the server and every existing table was restored by it.
+func (this *dataService) restoring(connectionId uint64) bool {
+	if connectionId != this.restorer {
+		return false
+	}
+	for tableName := range this.tables {
+		if !this.restored[tableName] {
+			return false
+		}
+	}
+	return true
+}
+
+// persistenceStatus returns size of the write-ahead log, time of the last snapshot and duration of recovery on start.
+func (this *dataService) persistenceStatus() (int64, time.Time, time.Duration) {
+	var size int64
+	if this.wal != nil {
+		size = this.wal.size()
+	}
+	this.statusMutex.Lock()
+	defer this.statusMutex.Unlock()
+	return size, this.lastSnapshot, this.replayDuration
+}
+
+// sendSnapshotResponse sends response to the client that requested snapshot.
+func (this *dataService) sendSnapshotResponse(item *requestItem, res response) {
+	if item != nil {
+		this.send(item, res)
+	}
+}
+
+// onSqlCreateTrigger creates trigger that is added to the table the request is forwarded to.
+// Returns false when the request was completed with error.
+func (this *dataService) onSqlCreateTrigger(item *requestItem) bool {
+	req := item.req.(*sqlCreateTriggerRequest)
+	if this.triggers[req.name] != nil {
+		this.send(item, newErrorResponse("trigger "+req.name+" already exists"))
+		return false
+	}
+	req.trigger = newTrigger(req, item.sender)
+	this.triggers[req.name] = req.trigger
+	go req.trigger.run(this.quit)
+	logInfo("trigger", req.name, "was created on table", req.table, "; connection:", item.sender.connectionId)
+	return true
+}
+
+// onSqlDropTrigger drops the trigger and forwards the request to its table.
+// Returns false when the request was completed with error.
+func (this *dataService) onSqlDropTrigger(item *requestItem) bool {
+	req := item.req.(*sqlDropTriggerRequest)
+	tr := this.triggers[req.name]
+	if tr == nil {
+		this.send(item, newErrorResponse("trigger "+req.name+" does not exist"))
+		return false
+	}
+	delete(this.triggers, req.name)
+	tr.drop()
+	req.table = tr.table
+	req.trigger = tr
+	logInfo("trigger", req.name, "was dropped; connection:", item.sender.connectionId)
+	return true
+}
+
+// onSqlSubscribeWildcard subscribes to every existing and future table that matches the pattern.
+func (this *dataService) onSqlSubscribeWildcard(item *requestItem) {
+	req := item.req.(*sqlSubscribeRequest)
+	if req.resume {
+		this.send(item, newErrorResponse("sequence is not supported for table pattern "+req.table))
+		return
+	}
+	if len(req.durable) > 0 {
+		this.send(item, newErrorResponse("durable is not supported for table pattern "+req.table))
+		return
+	}
+	req.sender = item.sender
+	wsub := this.wildcards.subscribe(req)
+	this.send(item, &sqlSubscribeResponse{pubsubid: wsub.id})
+	for name, tbl := range this.tables {
+		if matchTablePattern(req.table, name) {
+			tbl.requests <- wsub.tableRequest(name)
+		}
+	}
+}
+
+// onSqlSubscribeDurable resolves durable subscription name before the request is forwarded to the table.
+// Returns false when the request was rejected.
+func (this *dataService) onSqlSubscribeDurable(item *requestItem) bool {
+	req := item.req.(*sqlSubscribeRequest)
+	if len(req.durable) == 0 {
+		return true
+	}
+	durable, errRes := this.durables.reserve(req.durable, req.table, item.sender)
+	if errRes != nil {
+		this.send(item, errRes)
+		return false
+	}
+	req.durableSub = durable
+	return true
+}
+
+// onSqlUnsubscribeWildcard removes wildcard subscriptions from every table that matches the pattern.
+func (this *dataService) onSqlUnsubscribeWildcard(item *requestItem) {
+	req := item.req.(*sqlUnsubscribeRequest)
+	if len(req.filter.col) > 0 && req.filter.col != "pubsubid" {
+		this.send(item, newErrorResponse("Invalid filter expected pubsubid but got "+req.filter.col))
+		return
+	}
+	removed := this.wildcards.unsubscribe(req.table, item.sender.connectionId, req.filter.val)
+	for _, wsub := range removed {
+		for name, tbl := range this.tables {
+			if matchTablePattern(req.table, name) {
+				tbl.requests <- wsub.tableUnsubscribeRequest(name)
+			}
+		}
+	}
+	res := new(sqlUnsubscribeResponse)
+	res.unsubscribed = len(removed)
+	this.send(item, res)
+}
+
+// onSqlKillSubscription kills subscription of any connection and notifies the connection that owned it.
+func (this *dataService) onSqlKillSubscription(item *requestItem) {
+	req := item.req.(*sqlKillSubscriptionRequest)
+	sender := this.registry.kill(req.pubsubid)
+	// wildcard subscription no longer subscribes to new tables
+	if wsub := this.wildcards.kill(req.pubsubid); wsub != nil && !wsub.req.sender.quit.Done() {
+		sender = wsub.req.sender
+	}
+	if sender == nil {
+		this.send(item, newErrorResponse("subscription "+strconv.FormatUint(req.pubsubid, 10)+" does not exist"))
+		return
+	}
+	logInfo("subscription", req.pubsubid, "of connection", sender.connectionId, "was killed; connection:", item.sender.connectionId)
+	sender.send(newActionKillResponse(req.pubsubid))
+	this.send(item, newOkResponse("kill"))
+}
+
+// forwardToAllTables forwards sql request to every table.
+func (this *dataService) forwardToAllTables(item *requestItem) {
+	for _, tbl := range this.tables {
+		tbl.requests <- item
+	}
+}
+
+// send sends response to the client unless the request is streaming.
+func (this *dataService) send(item *requestItem, res response) {
+	if item.req.isStreaming() {
+		return
+	}
+	res.setRequestId(item.getRequestId())
+	item.sender.send(res)
+}
@@ -16,6 +16,7 @@
 
 package server
 
+import "strconv"
 import "testing"
 import "time"
 
@@ -85,3 +86,607 @@ func TestDataService(t *testing.T) {
 	validateSqlUnsubscribe(t, res, 1)
 	quit.Quit(time.Millisecond * 1000)
 }
+
+func validateWildcardInsert(t *testing.T, res response, pubsubid uint64, table string) {
+	switch res.(type) {
+	case *sqlActionInsertResponse:
+		x := res.(*sqlActionInsertResponse)
+		if x.pubsubid != pubsubid {
+			t.Errorf("expected pubsubid %d but got %d", pubsubid, x.pubsubid)
+		}
+		if x.table != table {
+			t.Errorf("expected table %s but got %s", table, x.table)
+		}
+		validateResponseJSON(t, res)
+	default:
+		t.Errorf("data service error: invalid response type expected sqlActionInsertResponse")
+	}
+}
+
+func TestDataServiceWildcardSubscription(t *testing.T) {
+	quit := NewQuitter()
+	dataSrv := newDataService(quit)
+	go dataSrv.run()
+	sender := newResponseSenderStub(1)
+	monitor := newResponseSenderStub(2)
+	// existing table
+	dataSrv.acceptRequest(sqlHelper(" insert into orders_eu (amount) values (10) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	// subscribe to existing and future tables
+	dataSrv.acceptRequest(sqlHelper(" subscribe skip * from orders_* ", monitor))
+	sub := validateSqlSubscribeResponse(t, monitor.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" insert into orders_us (amount) values (20) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	validateWildcardInsert(t, monitor.testRecv(), sub.pubsubid, "orders_us")
+	// table that does not match
+	dataSrv.acceptRequest(sqlHelper(" insert into customers (name) values (john) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" insert into orders_eu (amount) values (30) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	validateWildcardInsert(t, monitor.testRecv(), sub.pubsubid, "orders_eu")
+	// subscribe to all tables
+	dataSrv.acceptRequest(sqlHelper(" subscribe skip * from * ", monitor))
+	all := validateSqlSubscribeResponse(t, monitor.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" insert into customers (name) values (jane) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	validateWildcardInsert(t, monitor.testRecv(), all.pubsubid, "customers")
+	// unsubscribe
+	dataSrv.acceptRequest(sqlHelper(" unsubscribe from orders_* ", monitor))
+	validateSqlUnsubscribe(t, monitor.testRecv(), 1)
+	dataSrv.acceptRequest(sqlHelper(" insert into orders_us (amount) values (40) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	validateWildcardInsert(t, monitor.testRecv(), all.pubsubid, "orders_us")
+	validateNoResponse(t, monitor)
+	quit.Quit(time.Millisecond * 1000)
+}
+
+func TestDataServiceWildcardSubscriptionWhere(t *testing.T) {
+	quit := NewQuitter()
+	dataSrv := newDataService(quit)
+	go dataSrv.run()
+	sender := newResponseSenderStub(1)
+	monitor := newResponseSenderStub(2)
+	dataSrv.acceptRequest(sqlHelper(" subscribe * from orders_* where status = open ", monitor))
+	sub := validateSqlSubscribeResponse(t, monitor.testRecv())
+	// tables created after subscription
+	dataSrv.acceptRequest(sqlHelper(" insert into orders_us (status) values (open) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	validateWildcardInsert(t, monitor.testRecv(), sub.pubsubid, "orders_us")
+	dataSrv.acceptRequest(sqlHelper(" insert into orders_jp (status) values (closed) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" subscribe * from orders_* where status = open and amount > 10 ", monitor))
+	where := validateSqlSubscribeResponse(t, monitor.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" insert into orders_eu (status, amount) values (open, 20) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	validateWildcardInsert(t, monitor.testRecv(), sub.pubsubid, "orders_eu")
+	validateWildcardInsert(t, monitor.testRecv(), where.pubsubid, "orders_eu")
+	validateNoResponse(t, monitor)
+	quit.Quit(time.Millisecond * 1000)
+}
+
+func validateSchemaEvent(t *testing.T, res response, event string, table string, column string) {
+	switch res.(type) {
+	case *sqlActionSchemaResponse:
+		x := res.(*sqlActionSchemaResponse)
+		if x.event != event || x.table != table || x.column != column {
+			t.Errorf("expected schema event %s %s %s but got %s %s %s", event, table, column, x.event, x.table, x.column)
+		}
+		validateResponseJSON(t, res)
+	default:
+		t.Errorf("data service error: invalid response type expected sqlActionSchemaResponse")
+	}
+}
+
+func TestDataServiceSchemaSubscription(t *testing.T) {
+	quit := NewQuitter()
+	dataSrv := newDataService(quit)
+	go dataSrv.run()
+	sender := newResponseSenderStub(1)
+	admin := newResponseSenderStub(2)
+	dataSrv.acceptRequest(sqlHelper(" subscribe schema ", admin))
+	validateSqlSubscribeResponse(t, admin.testRecv())
+	// table creation and new columns
+	dataSrv.acceptRequest(sqlHelper(" insert into stocks (ticker, bid) values (IBM, 12) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	validateSchemaEvent(t, admin.testRecv(), "create", "stocks", "")
+	validateSchemaEvent(t, admin.testRecv(), "column", "stocks", "ticker")
+	validateSchemaEvent(t, admin.testRecv(), "column", "stocks", "bid")
+	// existing columns
+	dataSrv.acceptRequest(sqlHelper(" update stocks set bid = 13 ", sender))
+	validateSqlUpdate(t, sender.testRecv(), 1)
+	validateNoResponse(t, admin)
+	// key and tag
+	dataSrv.acceptRequest(sqlHelper(" key stocks ticker ", sender))
+	validateOkResponse(t, sender.testRecv())
+	validateSchemaEvent(t, admin.testRecv(), "key", "stocks", "ticker")
+	dataSrv.acceptRequest(sqlHelper(" tag stocks sector ", sender))
+	validateOkResponse(t, sender.testRecv())
+	validateSchemaEvent(t, admin.testRecv(), "column", "stocks", "sector")
+	validateSchemaEvent(t, admin.testRecv(), "tag", "stocks", "sector")
+	// unsubscribe
+	dataSrv.acceptRequest(sqlHelper(" unsubscribe schema ", admin))
+	validateSqlUnsubscribe(t, admin.testRecv(), 1)
+	dataSrv.acceptRequest(sqlHelper(" insert into trades (ticker) values (IBM) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	validateNoResponse(t, admin)
+	quit.Quit(time.Millisecond * 1000)
+}
+
+func TestSchemaBrokerSlowSubscriber(t *testing.T) {
+	broker := newSchemaBroker()
+	slow := newTestResponseSender(1, slowConsumerBlock, time.Second)
+	validateSqlSubscribeResponse(t, broker.subscribe(&sqlSubscribeSchemaRequest{sender: slow}))
+	broker.publish("create", "stocks", "")
+	published := make(chan bool)
+	go func() {
+		broker.publish("create", "trades", "")
+		published <- true
+	}()
+	time.Sleep(time.Millisecond * 50)
+	// publisher blocked by slow subscriber does not hold the broker
+	admin := newResponseSenderStub(2)
+	validateSqlSubscribeResponse(t, broker.subscribe(&sqlSubscribeSchemaRequest{sender: admin}))
+	select {
+	case <-published:
+		t.Errorf("expected publisher to be blocked by slow subscriber")
+		return
+	default:
+	}
+	validateSchemaEvent(t, slow.testRecv(), "create", "stocks", "")
+	<-published
+	validateSchemaEvent(t, slow.testRecv(), "create", "trades", "")
+}
+
+func validateShowSubscriptions(t *testing.T, res response, expected [][]string) {
+	show, ok := res.(*sqlActionDataResponse)
+	if !ok || show.action != "show" {
+		t.Errorf("invalid response type expected show subscriptions response")
+		return
+	}
+	validateResponseJSON(t, res)
+	if len(show.records) != len(expected) {
+		t.Errorf("expected %d subscriptions but got %d", len(expected), len(show.records))
+		return
+	}
+	for idx, rec := range show.records {
+		for col, val := range expected[idx] {
+			if rec.getValue(col) != val {
+				t.Errorf("expected %s to be %s but got %s", show.columns[col].name, val, rec.getValue(col))
+			}
+		}
+	}
+}
+
+func TestDataServiceShowAndKillSubscriptions(t *testing.T) {
+	quit := NewQuitter()
+	dataSrv := newDataService(quit)
+	go dataSrv.run()
+	sender := newResponseSenderStub(1)
+	admin := newResponseSenderStub(2)
+	dataSrv.acceptRequest(sqlHelper(" insert into stocks (ticker, bid) values (IBM, 12) ", admin))
+	validateSqlInsertResponse(t, admin.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" subscribe * from stocks where bid > 10 ", sender))
+	pubsubid := strconv.FormatUint(validateSqlSubscribeResponse(t, sender.testRecv()).pubsubid, 10)
+	sender.testRecv()
+	dataSrv.acceptRequest(sqlHelper(" subscribe topic news ", sender))
+	topicid := strconv.FormatUint(validateSqlSubscribeResponse(t, sender.testRecv()).pubsubid, 10)
+	// list
+	dataSrv.acceptRequest(sqlHelper(" show subscriptions ", admin))
+	validateShowSubscriptions(t, admin.testRecv(), [][]string{
+		{pubsubid, "1", "stocks", "bid > 10", "1", "0"},
+		{topicid, "1", "", "topic news", "0", "0"},
+	})
+	dataSrv.acceptRequest(sqlHelper(" show subscriptions from orders ", admin))
+	validateShowSubscriptions(t, admin.testRecv(), nil)
+	// kill
+	dataSrv.acceptRequest(sqlHelper(" kill subscription "+pubsubid, admin))
+	validateOkResponse(t, admin.testRecv())
+	res, ok := sender.testRecv().(*sqlActionKillResponse)
+	if !ok || strconv.FormatUint(res.pubsubid, 10) != pubsubid {
+		t.Errorf("expected kill notification")
+	}
+	dataSrv.acceptRequest(sqlHelper(" insert into stocks (ticker, bid) values (MSFT, 40) ", admin))
+	validateSqlInsertResponse(t, admin.testRecv())
+	validateNoResponse(t, sender)
+	dataSrv.acceptRequest(sqlHelper(" show subscriptions from stocks ", admin))
+	validateShowSubscriptions(t, admin.testRecv(), nil)
+	dataSrv.acceptRequest(sqlHelper(" kill subscription "+pubsubid, admin))
+	validateErrorResponse(t, admin.testRecv())
+	quit.Quit(time.Millisecond * 1000)
+}
+
+func validateDelivery(t *testing.T, res response, delivery uint64) {
+	pubsub, ok := res.(pubsubResponse)
+	if !ok {
+		t.Errorf("invalid response type expected pubsub response")
+		return
+	}
+	validateResponseJSON(t, res)
+	if pubsub.pubsubResponse().delivery != delivery {
+		t.Errorf("expected delivery %d but got %d", delivery, pubsub.pubsubResponse().delivery)
+	}
+}
+
+func TestDataServiceDurableSubscription(t *testing.T) {
+	quit := NewQuitter()
+	dataSrv := newDataService(quit)
+	go dataSrv.run()
+	worker1 := newResponseSenderStub(1)
+	worker2 := newResponseSenderStub(2)
+	producer := newResponseSenderStub(3)
+	dataSrv.acceptRequest(sqlHelper(" insert into jobs (name) values (job1) ", producer))
+	validateSqlInsertResponse(t, producer.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" subscribe * from jobs durable worker ", worker1))
+	pubsubid := validateSqlSubscribeResponse(t, worker1.testRecv()).pubsubid
+	validateDelivery(t, worker1.testRecv(), 1)
+	dataSrv.acceptRequest(sqlHelper(" insert into jobs (name) values (job2) ", producer))
+	validateSqlInsertResponse(t, producer.testRecv())
+	validateDelivery(t, worker1.testRecv(), 2)
+	dataSrv.acceptRequest(sqlHelper(" ack durable worker 1 ", worker1))
+	validateOkResponse(t, worker1.testRecv())
+	// durable name is in use
+	dataSrv.acceptRequest(sqlHelper(" subscribe * from jobs durable worker ", worker2))
+	validateErrorResponse(t, worker2.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" ack durable worker 2 ", worker2))
+	validateErrorResponse(t, worker2.testRecv())
+	// events are retained while no connection is attached
+	worker1.quit.Quit(0)
+	dataSrv.acceptRequest(sqlHelper(" insert into jobs (name) values (job3) ", producer))
+	validateSqlInsertResponse(t, producer.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" subscribe * from jobs durable worker ", worker2))
+	if validateSqlSubscribeResponse(t, worker2.testRecv()).pubsubid != pubsubid {
+		t.Errorf("expected durable subscription to keep pubsubid")
+	}
+	validateDelivery(t, worker2.testRecv(), 2)
+	validateDelivery(t, worker2.testRecv(), 3)
+	validateNoResponse(t, worker2)
+	dataSrv.acceptRequest(sqlHelper(" ack durable worker 3 ", worker2))
+	validateOkResponse(t, worker2.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" ack durable orders 3 ", worker2))
+	validateErrorResponse(t, worker2.testRecv())
+	quit.Quit(time.Millisecond * 1000)
+}
+
+func validatePopRows(t *testing.T, res response, rows int) {
+	pop, ok := res.(*sqlActionDataResponse)
+	if !ok || pop.action != "pop" {
+		t.Errorf("invalid response type expected pop response")
+		return
+	}
+	// records are returned only when pop has returning columns
+	popped := pop.rows
+	if len(pop.columns) > 0 {
+		popped = len(pop.records)
+	}
+	if popped != rows {
+		t.Errorf("expected %d popped rows but got %d", rows, popped)
+	}
+	validateResponseJSON(t, res)
+}
+
+func TestDataServiceBlockingPop(t *testing.T) {
+	quit := NewQuitter()
+	dataSrv := newDataService(quit)
+	go dataSrv.run()
+	worker1 := newResponseSenderStub(1)
+	worker2 := newResponseSenderStub(2)
+	producer := newResponseSenderStub(3)
+	dataSrv.acceptRequest(sqlHelper(" pop front * from jobs wait 5s ", worker1))
+	dataSrv.acceptRequest(sqlHelper(" pop front from jobs wait 5s ", worker2))
+	// each record goes to one waiting worker in arrival order
+	dataSrv.acceptRequest(sqlHelper(" push into jobs (name) values (job1) ", producer))
+	producer.testRecv()
+	validatePopRows(t, worker1.testRecv(), 1)
+	validateNoResponse(t, worker2)
+	dataSrv.acceptRequest(sqlHelper(" push into jobs (name) values (job2) ", producer))
+	producer.testRecv()
+	validatePopRows(t, worker2.testRecv(), 1)
+	// records are popped immediately when the table is not empty
+	dataSrv.acceptRequest(sqlHelper(" push into jobs (name) values (job3) ", producer))
+	producer.testRecv()
+	dataSrv.acceptRequest(sqlHelper(" pop front from jobs wait 5s ", worker1))
+	validatePopRows(t, worker1.testRecv(), 1)
+	// wait time expires
+	dataSrv.acceptRequest(sqlHelper(" pop front from jobs wait 50ms ", worker1))
+	validateNoResponse(t, worker1)
+	validatePopRows(t, worker1.testRecv(), 0)
+	quit.Quit(time.Millisecond * 1000)
+}
+
+func validateReserve(t *testing.T, res response, id string, deliveries int) {
+	reserve, ok := res.(*sqlReserveResponse)
+	if !ok {
+		t.Errorf("invalid response type expected reserve response")
+		return
+	}
+	reserved := ""
+	if len(reserve.records) == 1 {
+		reserved = reserve.records[0].getValue(0)
+	}
+	if reserved != id {
+		t.Errorf("expected reserved record %s but got %s", id, reserved)
+	}
+	if reserve.deliveries != deliveries {
+		t.Errorf("expected %d deliveries but got %d", deliveries, reserve.deliveries)
+	}
+	validateResponseJSON(t, res)
+}
+
+func validatePubSubAction(t *testing.T, res response, typ string) {
+	switch res.(type) {
+	case *sqlActionReservedResponse:
+		if typ != "reserved" {
+			t.Errorf("unexpected reserved event expected %s", typ)
+		}
+	case *sqlActionReleasedResponse:
+		if typ != "released" {
+			t.Errorf("unexpected released event expected %s", typ)
+		}
+	case *sqlActionDeleteResponse:
+		if typ != "delete" {
+			t.Errorf("unexpected delete event expected %s", typ)
+		}
+	default:
+		t.Errorf("invalid pubsub event expected %s", typ)
+	}
+}
+
+func TestDataServiceReserve(t *testing.T) {
+	quit := NewQuitter()
+	dataSrv := newDataService(quit)
+	go dataSrv.run()
+	worker := newResponseSenderStub(1)
+	producer := newResponseSenderStub(2)
+	subscriber := newResponseSenderStub(3)
+	dataSrv.acceptRequest(sqlHelper(" push into jobs (name) values (job1) ", producer))
+	producer.testRecv()
+	dataSrv.acceptRequest(sqlHelper(" push into jobs (name) values (job2) ", producer))
+	producer.testRecv()
+	dataSrv.acceptRequest(sqlHelper(" subscribe * from jobs ", subscriber))
+	validateSqlSubscribeResponse(t, subscriber.testRecv())
+	subscriber.testRecv()
+	failed := newResponseSenderStub(4)
+	dataSrv.acceptRequest(sqlHelper(" subscribe * from failed ", failed))
+	validateSqlSubscribeResponse(t, failed.testRecv())
+	// reserved record is hidden from other workers
+	dataSrv.acceptRequest(sqlHelper(" reserve front from jobs timeout 5s ", worker))
+	validateReserve(t, worker.testRecv(), "0", 1)
+	validatePubSubAction(t, subscriber.testRecv(), "reserved")
+	dataSrv.acceptRequest(sqlHelper(" reserve front from jobs timeout 5s ", worker))
+	validateReserve(t, worker.testRecv(), "1", 1)
+	validatePubSubAction(t, subscriber.testRecv(), "reserved")
+	dataSrv.acceptRequest(sqlHelper(" reserve front from jobs timeout 5s ", worker))
+	validateReserve(t, worker.testRecv(), "", 0)
+	// reserved records are hidden from select, update and delete
+	dataSrv.acceptRequest(sqlHelper(" select * from jobs ", worker))
+	validateSqlSelect(t, worker.testRecv(), 0, 2)
+	dataSrv.acceptRequest(sqlHelper(" update jobs set name = job3 where id = 0 ", worker))
+	validateSqlUpdate(t, worker.testRecv(), 0)
+	dataSrv.acceptRequest(sqlHelper(" delete from jobs where id = 1 ", worker))
+	validateSqlDelete(t, worker.testRecv(), 0)
+	// ack deletes the record
+	dataSrv.acceptRequest(sqlHelper(" ack jobs 1 ", worker))
+	validateOkResponse(t, worker.testRecv())
+	validatePubSubAction(t, subscriber.testRecv(), "delete")
+	dataSrv.acceptRequest(sqlHelper(" ack jobs 1 ", worker))
+	validateErrorResponse(t, worker.testRecv())
+	// nack returns the record to the front
+	dataSrv.acceptRequest(sqlHelper(" nack jobs 0 ", worker))
+	validateOkResponse(t, worker.testRecv())
+	validatePubSubAction(t, subscriber.testRecv(), "released")
+	// unacked record reappears after the timeout
+	dataSrv.acceptRequest(sqlHelper(" reserve front from jobs timeout 50ms deadletter failed after 3 ", worker))
+	validateReserve(t, worker.testRecv(), "0", 2)
+	validatePubSubAction(t, subscriber.testRecv(), "reserved")
+	validatePubSubAction(t, subscriber.testRecv(), "released")
+	// record is moved to dead letter table after the last attempt
+	dataSrv.acceptRequest(sqlHelper(" reserve front from jobs timeout 50ms deadletter failed after 3 ", worker))
+	validateReserve(t, worker.testRecv(), "0", 3)
+	validatePubSubAction(t, subscriber.testRecv(), "reserved")
+	validatePubSubAction(t, subscriber.testRecv(), "delete")
+	if _, ok := failed.testRecv().(*sqlActionInsertResponse); !ok {
+		t.Errorf("expected insert event from dead letter table")
+	}
+	quit.Quit(time.Millisecond * 1000)
+}
+
+func TestDataServiceScheduledPush(t *testing.T) {
+	quit := NewQuitter()
+	dataSrv := newDataService(quit)
+	go dataSrv.run()
+	worker := newResponseSenderStub(1)
+	producer := newResponseSenderStub(2)
+	subscriber := newResponseSenderStub(3)
+	dataSrv.acceptRequest(sqlHelper(" subscribe * from jobs ", subscriber))
+	validateSqlSubscribeResponse(t, subscriber.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" push back into jobs (name) values (job2) delay 100ms ", producer))
+	dataSrv.acceptRequest(sqlHelper(" push back into jobs (name) values (job1) delay 50ms ", producer))
+	for i := 0; i < 2; i++ {
+		if _, ok := producer.testRecv().(*sqlScheduledPushResponse); !ok {
+			t.Errorf("invalid response type expected scheduled push response")
+		}
+	}
+	// scheduled records are not visible until due
+	dataSrv.acceptRequest(sqlHelper(" pop front * from jobs ", worker))
+	validatePopRows(t, worker.testRecv(), 0)
+	dataSrv.acceptRequest(sqlHelper(" pop front * from jobs wait 5s ", worker))
+	res, ok := worker.testRecv().(*sqlActionDataResponse)
+	if !ok || len(res.records) != 1 || res.records[0].getValue(1) != "job1" {
+		t.Errorf("expected job1 to be pushed first")
+	}
+	if _, ok := subscriber.testRecv().(*sqlActionInsertResponse); !ok {
+		t.Errorf("expected insert event for scheduled push")
+	}
+	validatePubSubAction(t, subscriber.testRecv(), "delete")
+	quit.Quit(time.Millisecond * 1000)
+}
+
+func TestDataServicePriorityPush(t *testing.T) {
+	quit := NewQuitter()
+	dataSrv := newDataService(quit)
+	go dataSrv.run()
+	worker := newResponseSenderStub(1)
+	producer := newResponseSenderStub(2)
+	dataSrv.acceptRequest(sqlHelper(" push into jobs (name) values (job1) ", producer))
+	dataSrv.acceptRequest(sqlHelper(" push into jobs priority 1 (name) values (job2) ", producer))
+	dataSrv.acceptRequest(sqlHelper(" push into jobs priority 5 (name) values (job3) ", producer))
+	dataSrv.acceptRequest(sqlHelper(" push front into jobs priority 5 (name) values (job4) ", producer))
+	for i := 0; i < 4; i++ {
+		producer.testRecv()
+	}
+	// peek sees the same record pop returns
+	dataSrv.acceptRequest(sqlHelper(" peek front * from jobs ", worker))
+	res, ok := worker.testRecv().(*sqlActionDataResponse)
+	if !ok || len(res.records) != 1 || res.records[0].getValue(1) != "job3" {
+		t.Errorf("expected peek to return job3")
+	}
+	// highest priority oldest record first, records without priority last
+	for _, name := range []string{"job3", "job4", "job2", "job1"} {
+		dataSrv.acceptRequest(sqlHelper(" pop front * from jobs ", worker))
+		res, ok := worker.testRecv().(*sqlActionDataResponse)
+		if !ok || len(res.records) != 1 || res.records[0].getValue(1) != name {
+			t.Errorf("expected %s to be popped", name)
+		}
+	}
+	quit.Quit(time.Millisecond * 1000)
+}
+
+func TestDataServiceBatchPopAndPeek(t *testing.T) {
+	quit := NewQuitter()
+	dataSrv := newDataService(quit)
+	go dataSrv.run()
+	worker := newResponseSenderStub(1)
+	producer := newResponseSenderStub(2)
+	subscriber := newResponseSenderStub(3)
+	for i := 1; i <= 5; i++ {
+		dataSrv.acceptRequest(sqlHelper(" push back into jobs (name) values (job"+strconv.Itoa(i)+") ", producer))
+		producer.testRecv()
+	}
+	dataSrv.acceptRequest(sqlHelper(" subscribe * from jobs ", subscriber))
+	validateSqlSubscribeResponse(t, subscriber.testRecv())
+	subscriber.testRecv()
+	// peek back returns the newest records first
+	dataSrv.acceptRequest(sqlHelper(" peek back 2 from jobs ", worker))
+	res, ok := worker.testRecv().(*sqlActionDataResponse)
+	if !ok || len(res.records) != 2 || res.records[0].getValue(1) != "job5" || res.records[1].getValue(1) != "job4" {
+		t.Errorf("expected peek to return job5 and job4")
+	}
+	// pop returns up to the requested number of records
+	dataSrv.acceptRequest(sqlHelper(" pop front 3 * from jobs ", worker))
+	validatePopRows(t, worker.testRecv(), 3)
+	dataSrv.acceptRequest(sqlHelper(" pop front 3 * from jobs ", worker))
+	validatePopRows(t, worker.testRecv(), 2)
+	// subscribers receive one delete event per pop
+	for _, rows := range []int{3, 2} {
+		res, ok := subscriber.testRecv().(*sqlActionDeleteResponse)
+		if !ok || len(res.records) != rows {
+			t.Errorf("expected delete event with %d records", rows)
+		}
+	}
+	quit.Quit(time.Millisecond * 1000)
+}
+
+func TestDataServiceTriggers(t *testing.T) {
+	quit := NewQuitter()
+	dataSrv := newDataService(quit)
+	go dataSrv.run()
+	creator := newResponseSenderStub(1)
+	client := newResponseSenderStub(2)
+	subscriber := newResponseSenderStub(3)
+	dataSrv.acceptRequest(sqlHelper(" create trigger audit after update on trades do insert into history (sym, qty, prev) values (new.sym, new.qty, old.qty) ", creator))
+	validateOkResponse(t, creator.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" create trigger audit after insert on trades do delete from history ", creator))
+	validateErrorResponse(t, creator.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" subscribe * from history ", subscriber))
+	validateSqlSubscribeResponse(t, subscriber.testRecv())
+	// trigger statement receives new and old values
+	dataSrv.acceptRequest(sqlHelper(" insert into trades (sym, qty) values (IBM, 10) ", client))
+	client.testRecv()
+	dataSrv.acceptRequest(sqlHelper(" update trades set qty = 20 ", client))
+	client.testRecv()
+	res, ok := subscriber.testRecv().(*sqlActionInsertResponse)
+	if !ok {
+		t.Errorf("expected insert event from trigger")
+	} else {
+		expected := map[string]string{"sym": "IBM", "qty": "20", "prev": "10"}
+		for _, col := range res.columns {
+			if val, ok := expected[col.name]; ok && res.records[0].getValue(col.ordinal) != val {
+				t.Errorf("expected %s %s but got %s", col.name, val, res.records[0].getValue(col.ordinal))
+			}
+		}
+	}
+	// dropped trigger no longer fires
+	dataSrv.acceptRequest(sqlHelper(" drop trigger audit ", creator))
+	validateOkResponse(t, creator.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" update trades set qty = 30 ", client))
+	client.testRecv()
+	validateNoResponse(t, subscriber)
+	// errors go to the trigger creator
+	dataSrv.acceptRequest(sqlHelper(" key positions sym ", client))
+	client.testRecv()
+	dataSrv.acceptRequest(sqlHelper(" create trigger position after insert on trades do insert into positions (sym) values (new.sym) ", creator))
+	validateOkResponse(t, creator.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" insert into trades (sym, qty) values (MSFT, 10) ", client))
+	client.testRecv()
+	dataSrv.acceptRequest(sqlHelper(" insert into trades (sym, qty) values (MSFT, 20) ", client))
+	client.testRecv()
+	validateErrorResponse(t, creator.testRecv())
+	// trigger firing itself stops at the maximum depth
+	dataSrv.acceptRequest(sqlHelper(" create trigger ping after insert on ping do insert into ping (n) values (new.n) ", creator))
+	validateOkResponse(t, creator.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" insert into ping (n) values (1) ", client))
+	client.testRecv()
+	validateErrorResponse(t, creator.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" select * from ping ", client))
+	if sel, ok := client.testRecv().(*sqlSelectResponse); !ok || len(sel.records) != config.TRIGGER_MAX_DEPTH+1 {
+		t.Errorf("expected %d records in ping table", config.TRIGGER_MAX_DEPTH+1)
+	}
+	quit.Quit(time.Millisecond * 1000)
+}
+
+// Returns values of the first record of pubsub response by column name.
+func pubsubValues(res *sqlPubSubResponse) map[string]string {
+	values := make(map[string]string)
+	for idx, col := range res.columns {
+		values[col.name] = res.records[0].getValue(idx)
+	}
+	return values
+}
+
+func TestDataServiceSubscribeWithOldValues(t *testing.T) {
+	quit := NewQuitter()
+	dataSrv := newDataService(quit)
+	go dataSrv.run()
+	client := newResponseSenderStub(1)
+	subscriber := newResponseSenderStub(2)
+	dataSrv.acceptRequest(sqlHelper(" insert into trades (sym, qty, note) values (IBM, 10, first) ", client))
+	client.testRecv()
+	dataSrv.acceptRequest(sqlHelper(" subscribe sym, qty from trades with old values ", subscriber))
+	validateSqlSubscribeResponse(t, subscriber.testRecv())
+	subscriber.testRecv()
+	// update carries previous values of updated columns
+	dataSrv.acceptRequest(sqlHelper(" update trades set qty = 20, note = second ", client))
+	client.testRecv()
+	update, ok := subscriber.testRecv().(*sqlActionUpdateResponse)
+	if !ok {
+		t.Errorf("expected update event")
+	} else {
+		values := pubsubValues(&update.sqlPubSubResponse)
+		if len(values) != 3 || values["qty"] != "20" || values["old.qty"] != "10" {
+			t.Errorf("expected qty 20 and old.qty 10 but got %v", values)
+		}
+	}
+	// delete carries the whole record
+	dataSrv.acceptRequest(sqlHelper(" delete from trades ", client))
+	client.testRecv()
+	del, ok := subscriber.testRecv().(*sqlActionDeleteResponse)
+	if !ok {
+		t.Errorf("expected delete event")
+	} else {
+		values := pubsubValues(&del.sqlPubSubResponse)
+		if values["sym"] != "IBM" || values["qty"] != "20" || values["note"] != "second" {
+			t.Errorf("expected the whole record but got %v", values)
+		}
+	}
+	quit.Quit(time.Millisecond * 1000)
+}
@@ -0,0 +1,203 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import "sync"
+
+// durableEvent is an event of a durable subscription that was not acknowledged yet.
+type durableEvent struct {
+	delivery uint64
+	res      pubsubResponse
+	// response state before it was sent, restored for redelivery
+	saved sqlPubSubResponse
+}
+
+// durableSubscription retains events of a subscription in ack mode until the client acknowledges them.
+// Table subscription outlives the client connection, events are retained while no connection is attached
+// and redelivered to the connection that subscribes with the same durable name.
+type durableSubscription struct {
+	name   string
+	table  string
+	filter string
+	// guards the rest
+	mutex sync.Mutex
+	sub   *subscription
+	// owner is the connection that subscribed last, sender is set once events are delivered to it
+	owner    *responseSender
+	sender   *responseSender
+	delivery uint64
+	unacked  []*durableEvent
+}
+
+// durableSubscription factory
+func newDurableSubscription(name string, table string) *durableSubscription {
+	return &durableSubscription{
+		name:  name,
+		table: table,
+	}
+}
+
+// Binds newly created table subscription.
+func (this *durableSubscription) bind(sub *subscription, filter string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.filter = filter
+	sub.durable = this
+	this.sub = sub
+	this.sender = sub.sender
+}
+
+// Returns bound table subscription that is still active or nil.
+func (this *durableSubscription) subscription() *subscription {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.sub == nil || this.sub.closed() {
+		return nil
+	}
+	return this.sub
+}
+
+// Determines if the bound table subscription was unsubscribed or killed.
+func (this *durableSubscription) closed() bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.sub != nil && this.sub.closed()
+}
+
+// Determines if the durable subscription is owned by another open connection.
+func (this *durableSubscription) ownedByOther(sender *responseSender) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.owner != nil && this.owner != sender && !this.owner.quit.Done()
+}
+
+// Determines if the connection subscribed last.
+func (this *durableSubscription) ownedBy(sender *responseSender) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.owner == sender
+}
+
+// Sets the connection that subscribed last.
+func (this *durableSubscription) setOwner(sender *responseSender) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.owner = sender
+}
+
+// Assigns delivery sequence to the event, retains it until acknowledged and sends it
+// to the attached connection.
+func (this *durableSubscription) send(res response) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if pubsub, ok := res.(pubsubResponse); ok {
+		this.delivery++
+		pubsub.pubsubResponse().delivery = this.delivery
+		if len(this.unacked) >= config.DURABLE_MAX_UNACKED {
+			logWarn("durable subscription", this.name, "discarded unacknowledged event", this.unacked[0].delivery)
+			this.unacked[0] = nil
+			this.unacked = this.unacked[1:]
+		}
+		event := &durableEvent{
+			delivery: this.delivery,
+			res:      pubsub,
+			saved:    *pubsub.pubsubResponse(),
+		}
+		this.unacked = append(this.unacked, event)
+	}
+	if this.sender != nil && !this.sender.send(res) {
+		this.sender = nil
+	}
+}
+
+// Attaches the connection and redelivers unacknowledged events.
+func (this *durableSubscription) attach(sender *responseSender) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.owner = sender
+	this.sender = sender
+	for _, event := range this.unacked {
+		// previous connection is closed and no longer reads the response
+		*event.res.pubsubResponse() = event.saved
+		if !sender.send(event.res) {
+			this.sender = nil
+			return
+		}
+	}
+}
+
+// Removes events up to and including the delivery sequence.
+// Returns number of acknowledged events.
+func (this *durableSubscription) ack(delivery uint64) int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	acked := 0
+	for acked < len(this.unacked) && this.unacked[acked].delivery <= delivery {
+		this.unacked[acked] = nil
+		acked++
+	}
+	this.unacked = this.unacked[acked:]
+	return acked
+}
+
+// durableBroker is a collection container for durable subscriptions.
+// It is owned by dataService, durable subscriptions are shared with tables.
+type durableBroker struct {
+	durables map[string]*durableSubscription
+}
+
+// durableBroker factory
+func newDurableBroker() *durableBroker {
+	return &durableBroker{
+		durables: make(map[string]*durableSubscription),
+	}
+}
+
+// Returns durable subscription with the name for the subscribing connection,
+// creates new one when it does not exist or was closed.
+// Returns errorResponse when durable subscription belongs to another table or connection.
+func (this *durableBroker) reserve(name string, table string, sender *responseSender) (*durableSubscription, response) {
+	durable := this.durables[name]
+	if durable == nil || durable.closed() {
+		durable = newDurableSubscription(name, table)
+		this.durables[name] = durable
+	}
+	if durable.table != table {
+		return nil, newErrorResponse("durable subscription " + name + " belongs to table " + durable.table)
+	}
+	if durable.ownedByOther(sender) {
+		return nil, newErrorResponse("durable subscription " + name + " is in use")
+	}
+	durable.setOwner(sender)
+	return durable, nil
+}
+
+// Processes sql ack request.
+// On success returns okResponse.
+func (this *durableBroker) ack(req *sqlAckRequest, sender *responseSender) response {
+	durable := this.durables[req.durable]
+	if durable == nil || durable.closed() {
+		delete(this.durables, req.durable)
+		return newErrorResponse("durable subscription " + req.durable + " does not exist")
+	}
+	if !durable.ownedBy(sender) {
+		return newErrorResponse("durable subscription " + req.durable + " is not attached to this connection")
+	}
+	acked := durable.ack(req.delivery)
+	debug("durable subscription", req.durable, "acknowledged", acked, "events up to", req.delivery)
+	return newOkResponse("ack")
+}
@@ -0,0 +1,97 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiry is the deadline of a waiting pop request or a reservation.
+type expiry struct {
+	deadline time.Time
+	waiter   *popWaiter
+	resv     *reservation
+	// position in the heap, -1 when it is not in the heap
+	heapIdx int
+}
+
+// expiryHeap is a min heap of deadlines of waiting pop requests and reservations.
+type expiryHeap []*expiry
+
+func (this expiryHeap) Len() int {
+	return len(this)
+}
+
+func (this expiryHeap) Less(i, j int) bool {
+	return this[i].deadline.Before(this[j].deadline)
+}
+
+func (this expiryHeap) Swap(i, j int) {
+	this[i], this[j] = this[j], this[i]
+	this[i].heapIdx = i
+	this[j].heapIdx = j
+}
+
+func (this *expiryHeap) Push(x interface{}) {
+	exp := x.(*expiry)
+	exp.heapIdx = len(*this)
+	*this = append(*this, exp)
+}
+
+func (this *expiryHeap) Pop() interface{} {
+	old := *this
+	n := len(old)
+	exp := old[n-1]
+	old[n-1] = nil
+	exp.heapIdx = -1
+	*this = old[:n-1]
+	return exp
+}
+
+// Adds the deadline.
+func (this *expiryHeap) add(exp *expiry) {
+	heap.Push(this, exp)
+}
+
+// Removes the deadline that is no longer needed.
+func (this *expiryHeap) remove(exp *expiry) {
+	if exp.heapIdx >= 0 && exp.heapIdx < len(*this) && (*this)[exp.heapIdx] == exp {
+		heap.Remove(this, exp.heapIdx)
+	}
+}
+
+// Determines if the deadline is still in the heap.
+func (this *expiry) pending() bool {
+	return this.heapIdx >= 0
+}
+
+// Returns the earliest deadline, zero time when the heap is empty.
+func (this expiryHeap) next() time.Time {
+	if len(this) == 0 {
+		return time.Time{}
+	}
+	return this[0].deadline
+}
+
+// Removes and returns the earliest deadline that expired, nil when none expired.
+func (this *expiryHeap) due(now time.Time) *expiry {
+	if len(*this) == 0 || (*this)[0].deadline.After(now) {
+		return nil
+	}
+	return heap.Pop(this).(*expiry)
+}
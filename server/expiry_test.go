@@ -0,0 +1,46 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import "testing"
+import "time"
+
+func TestExpiryHeap(t *testing.T) {
+	var expiries expiryHeap
+	now := time.Now()
+	var added []*expiry
+	for _, offset := range []int{30, 10, 50, 20, 40} {
+		exp := &expiry{deadline: now.Add(time.Duration(offset) * time.Millisecond)}
+		expiries.add(exp)
+		added = append(added, exp)
+	}
+	ASSERT_TRUE(t, expiries.next().Equal(now.Add(10*time.Millisecond)), "expected earliest deadline")
+	// removed deadline does not expire
+	expiries.remove(added[3])
+	ASSERT_FALSE(t, added[3].pending(), "expected removed deadline")
+	ASSERT_TRUE(t, expiries.due(now) == nil, "expected no expired deadlines")
+	var due []*expiry
+	for exp := expiries.due(now.Add(40 * time.Millisecond)); exp != nil; exp = expiries.due(now.Add(40 * time.Millisecond)) {
+		ASSERT_FALSE(t, exp.pending(), "expected expired deadline to leave the heap")
+		due = append(due, exp)
+	}
+	ASSERT_TRUE(t, len(due) == 3 && due[0] == added[1] && due[1] == added[0] && due[2] == added[4], "expected deadlines in order")
+	ASSERT_TRUE(t, added[2].pending() && len(expiries) == 1, "expected one pending deadline")
+	// removing deadline that is not in the heap has no effect
+	expiries.remove(added[1])
+	ASSERT_TRUE(t, len(expiries) == 1, "expected one pending deadline")
+}
@@ -134,6 +134,13 @@ func (this *JSONBuilder) nameIntValue(name string, val int) {
 	this.int(val)
 }
 
+// value must be valid JSON
+func (this *JSONBuilder) nameRawValue(name string, value []byte) {
+	this.string(name)
+	this.nameSeparator()
+	this.Write(value)
+}
+
 func (this *JSONBuilder) getNetworkBytes(requestId uint32) []byte {
 	bytes := this.Bytes()
 	var header netHeader
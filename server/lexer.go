@@ -18,6 +18,7 @@ package server
 
 import (
 	"fmt"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
@@ -66,6 +67,51 @@ const (
 	tokenTypeCmdConnect                               // connect
 	tokenTypeCmdDisconnect                            // disconnect
 	tokenTypeCmdTables                                // tables
+	tokenTypeSqlEphemeral                             // ephemeral
+	tokenTypeSqlTopicName                             // topic name
+	tokenTypeSqlPublish                               // publish
+	tokenTypeSqlOperator                              // != <> < <= > >=
+	tokenTypeSqlAnd                                   // and
+	tokenTypeSqlSequence                              // sequence
+	tokenTypeCmdPolicy                                // policy
+	tokenTypeSqlConflate                              // conflate
+	tokenTypeSqlThrottle                              // throttle
+	tokenTypeSqlSchema                                // schema
+	tokenTypeSqlDrop                                  // drop
+	tokenTypeSqlAggregate                             // count sum avg min max
+	tokenTypeSqlOrder                                 // order
+	tokenTypeSqlBy                                    // by
+	tokenTypeSqlAsc                                   // asc
+	tokenTypeSqlDesc                                  // desc
+	tokenTypeSqlLimit                                 // limit
+	tokenTypeSqlShow                                  // show
+	tokenTypeSqlSubscriptions                         // subscriptions
+	tokenTypeSqlKill                                  // kill
+	tokenTypeSqlSubscription                          // subscription
+	tokenTypeSqlDurable                               // durable
+	tokenTypeSqlDurableName                           // durable subscription name
+	tokenTypeSqlAck                                   // ack
+	tokenTypeSqlWait                                  // wait
+	tokenTypeSqlReserve                               // reserve
+	tokenTypeSqlTimeout                               // timeout
+	tokenTypeSqlDeadLetter                            // deadletter
+	tokenTypeSqlAfter                                 // after
+	tokenTypeSqlNack                                  // nack
+	tokenTypeSqlDelay                                 // delay
+	tokenTypeSqlAt                                    // at
+	tokenTypeSqlPriority                              // priority
+	tokenTypeSqlCreate                                // create
+	tokenTypeSqlTrigger                               // trigger
+	tokenTypeSqlTriggerName                           // trigger name
+	tokenTypeSqlOn                                    // on
+	tokenTypeSqlDo                                    // do
+	tokenTypeSqlStatement                             // statement executed by trigger
+	tokenTypeSqlWith                                  // with
+	tokenTypeSqlOld                                   // old
+	tokenTypeCmdSnapshot                              // snapshot
+	tokenTypeCmdBackup                                // backup
+	tokenTypeCmdRestore                               // restore
+	tokenTypeCmdDump                                  // table dump
 )
 
 // String converts tokenType value to a string.
@@ -149,6 +195,96 @@ func (typ tokenType) String() string {
 		return "tokenTypeCmdDisconnect"
 	case tokenTypeCmdTables:
 		return "tokenTypeCmdTables"
+	case tokenTypeSqlEphemeral:
+		return "tokenTypeSqlEphemeral"
+	case tokenTypeSqlTopicName:
+		return "tokenTypeSqlTopicName"
+	case tokenTypeSqlPublish:
+		return "tokenTypeSqlPublish"
+	case tokenTypeSqlOperator:
+		return "tokenTypeSqlOperator"
+	case tokenTypeSqlAnd:
+		return "tokenTypeSqlAnd"
+	case tokenTypeSqlSequence:
+		return "tokenTypeSqlSequence"
+	case tokenTypeCmdPolicy:
+		return "tokenTypeCmdPolicy"
+	case tokenTypeSqlConflate:
+		return "tokenTypeSqlConflate"
+	case tokenTypeSqlThrottle:
+		return "tokenTypeSqlThrottle"
+	case tokenTypeSqlSchema:
+		return "tokenTypeSqlSchema"
+	case tokenTypeSqlDrop:
+		return "tokenTypeSqlDrop"
+	case tokenTypeSqlAggregate:
+		return "tokenTypeSqlAggregate"
+	case tokenTypeSqlOrder:
+		return "tokenTypeSqlOrder"
+	case tokenTypeSqlBy:
+		return "tokenTypeSqlBy"
+	case tokenTypeSqlAsc:
+		return "tokenTypeSqlAsc"
+	case tokenTypeSqlDesc:
+		return "tokenTypeSqlDesc"
+	case tokenTypeSqlLimit:
+		return "tokenTypeSqlLimit"
+	case tokenTypeSqlShow:
+		return "tokenTypeSqlShow"
+	case tokenTypeSqlSubscriptions:
+		return "tokenTypeSqlSubscriptions"
+	case tokenTypeSqlKill:
+		return "tokenTypeSqlKill"
+	case tokenTypeSqlSubscription:
+		return "tokenTypeSqlSubscription"
+	case tokenTypeSqlDurable:
+		return "tokenTypeSqlDurable"
+	case tokenTypeSqlDurableName:
+		return "tokenTypeSqlDurableName"
+	case tokenTypeSqlAck:
+		return "tokenTypeSqlAck"
+	case tokenTypeSqlWait:
+		return "tokenTypeSqlWait"
+	case tokenTypeSqlReserve:
+		return "tokenTypeSqlReserve"
+	case tokenTypeSqlTimeout:
+		return "tokenTypeSqlTimeout"
+	case tokenTypeSqlDeadLetter:
+		return "tokenTypeSqlDeadLetter"
+	case tokenTypeSqlAfter:
+		return "tokenTypeSqlAfter"
+	case tokenTypeSqlNack:
+		return "tokenTypeSqlNack"
+	case tokenTypeSqlDelay:
+		return "tokenTypeSqlDelay"
+	case tokenTypeSqlAt:
+		return "tokenTypeSqlAt"
+	case tokenTypeSqlPriority:
+		return "tokenTypeSqlPriority"
+	case tokenTypeSqlCreate:
+		return "tokenTypeSqlCreate"
+	case tokenTypeSqlTrigger:
+		return "tokenTypeSqlTrigger"
+	case tokenTypeSqlTriggerName:
+		return "tokenTypeSqlTriggerName"
+	case tokenTypeSqlOn:
+		return "tokenTypeSqlOn"
+	case tokenTypeSqlDo:
+		return "tokenTypeSqlDo"
+	case tokenTypeSqlStatement:
+		return "tokenTypeSqlStatement"
+	case tokenTypeSqlWith:
+		return "tokenTypeSqlWith"
+	case tokenTypeSqlOld:
+		return "tokenTypeSqlOld"
+	case tokenTypeCmdSnapshot:
+		return "tokenTypeCmdSnapshot"
+	case tokenTypeCmdBackup:
+		return "tokenTypeCmdBackup"
+	case tokenTypeCmdRestore:
+		return "tokenTypeCmdRestore"
+	case tokenTypeCmdDump:
+		return "tokenTypeCmdDump"
 	}
 	return "not implemented"
 }
@@ -349,6 +485,28 @@ func (this *lexer) tryMatch(val string) bool {
 	return true
 }
 
+// Scans input and tries to match the expected keyword followed by white space.
+// Does not advance the input if the keyword was not matched.
+func (this *lexer) tryMatchKeyword(val string) bool {
+	pos := this.pos
+	if this.tryMatch(val) && isWhiteSpace(this.peek()) {
+		return true
+	}
+	this.pos = pos
+	return false
+}
+
+// Determines if the rest of the column list follows without consuming the input.
+func (this *lexer) followedByColumns() bool {
+	pos := this.pos
+	for rune := this.next(); unicode.IsSpace(rune); rune = this.next() {
+	}
+	this.backup()
+	found := this.peek() == ',' || this.tryMatchKeyword("from")
+	this.pos = pos
+	return found
+}
+
 // lexMatch matches expected string value emitting the token on success
 // and returning passed state function.
 func (this *lexer) lexMatch(typ tokenType, value string, skip int, fn stateFn) stateFn {
@@ -367,7 +525,7 @@ func (this *lexer) lexSqlIdentifier(typ tokenType, fn stateFn) stateFn {
 	if !unicode.IsLetter(this.next()) {
 		return this.errorToken("identifier must begin with a letter " + this.current())
 	}
-	for rune := this.next(); unicode.IsLetter(rune) || unicode.IsDigit(rune); rune = this.next() {
+	for rune := this.next(); isIdentifierRune(rune); rune = this.next() {
 
 	}
 	this.backup()
@@ -375,6 +533,44 @@ func (this *lexer) lexSqlIdentifier(typ tokenType, fn stateFn) stateFn {
 	return fn
 }
 
+// Determines if rune can be part of sql identifier after the first letter.
+func isIdentifierRune(rune int32) bool {
+	return unicode.IsLetter(rune) || unicode.IsDigit(rune) || rune == '_'
+}
+
+// Determines if string is valid sql identifier.
+func isIdentifier(str string) bool {
+	for idx, rune := range str {
+		if idx == 0 && !unicode.IsLetter(rune) || !isIdentifierRune(rune) {
+			return false
+		}
+	}
+	return len(str) > 0
+}
+
+// lexSqlTablePattern scans input for table name or table name pattern
+// ending with '*' emitting the token on success and returning passed state function.
+func (this *lexer) lexSqlTablePattern(fn stateFn) stateFn {
+	this.skipWhiteSpaces()
+	if this.next() == '*' {
+		this.emit(tokenTypeSqlTable)
+		return fn
+	}
+	this.backup()
+	if !unicode.IsLetter(this.next()) {
+		return this.errorToken("identifier must begin with a letter " + this.current())
+	}
+	for rune := this.next(); isIdentifierRune(rune); rune = this.next() {
+
+	}
+	this.backup()
+	if this.peek() == '*' {
+		this.next()
+	}
+	this.emit(tokenTypeSqlTable)
+	return fn
+}
+
 // lexSqlLeftParenthesis scans input for '(' emitting the token on success
 // and returning passed state function.
 func (this *lexer) lexSqlLeftParenthesis(fn stateFn) stateFn {
@@ -487,15 +683,41 @@ func lexSqlPushInto(this *lexer) stateFn {
 	this.skipWhiteSpaces()
 	switch this.next() {
 	case 'b':
-		return this.lexMatch(tokenTypeSqlBack, "back", 1, lexSqlInsertInto)
+		return this.lexMatch(tokenTypeSqlBack, "back", 1, lexSqlPushIntoKeyword)
 	case 'f':
-		return this.lexMatch(tokenTypeSqlFront, "front", 1, lexSqlInsertInto)
+		return this.lexMatch(tokenTypeSqlFront, "front", 1, lexSqlPushIntoKeyword)
 	case 'i':
-		return this.lexMatch(tokenTypeSqlInto, "into", 1, lexSqlInsertIntoTable)
+		return this.lexMatch(tokenTypeSqlInto, "into", 1, lexSqlPushIntoTable)
 	}
 	return this.errorToken("unexpected token expected front, back or into")
 }
 
+func lexSqlPushIntoKeyword(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	return this.lexMatch(tokenTypeSqlInto, "into", 0, lexSqlPushIntoTable)
+}
+
+func lexSqlPushIntoTable(this *lexer) stateFn {
+	return this.lexSqlIdentifier(tokenTypeSqlTable, lexSqlPushPriority)
+}
+
+func lexSqlPushPriority(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.tryMatchKeyword("priority") {
+		this.emit(tokenTypeSqlPriority)
+		return lexSqlPushPriorityValue
+	}
+	return lexSqlInsertIntoTableLeftParenthesis
+}
+
+func lexSqlPushPriorityValue(this *lexer) stateFn {
+	return this.lexSqlValue(lexSqlInsertIntoTableLeftParenthesis)
+}
+
+func lexSqlInsertEphemeral(this *lexer) stateFn {
+	return this.lexTryMatch(tokenTypeSqlEphemeral, "ephemeral", lexSqlInsertInto, lexSqlInsertInto)
+}
+
 func lexSqlInsertInto(this *lexer) stateFn {
 	this.skipWhiteSpaces()
 	return this.lexMatch(tokenTypeSqlInto, "into", 0, lexSqlInsertIntoTable)
@@ -560,9 +782,31 @@ func lexSqlReturning(this *lexer) stateFn {
 	if this.end() {
 		return nil
 	}
+	// blocking pop
+	if this.tryMatchKeyword("wait") {
+		this.emit(tokenTypeSqlWait)
+		return lexSqlWaitValue
+	}
+	// scheduled push
+	if this.tryMatchKeyword("delay") {
+		this.emit(tokenTypeSqlDelay)
+		return lexSqlScheduleValue
+	}
+	if this.tryMatchKeyword("at") {
+		this.emit(tokenTypeSqlAt)
+		return lexSqlScheduleValue
+	}
 	return this.lexMatch(tokenTypeSqlReturning, "returning", 0, lexSqlReturningStar)
 }
 
+func lexSqlWaitValue(this *lexer) stateFn {
+	return this.lexSqlValue(lexEof)
+}
+
+func lexSqlScheduleValue(this *lexer) stateFn {
+	return this.lexSqlValue(lexSqlReturning)
+}
+
 func lexSqlReturningStar(this *lexer) stateFn {
 	this.skipWhiteSpaces()
 	if this.next() == '*' {
@@ -632,17 +876,36 @@ func lexSqlPopFrom(this *lexer) stateFn {
 	// back
 	if this.tryMatch("back") {
 		this.emit(tokenTypeSqlBack)
-		return lexSqlSelectStar
+		return lexSqlPopCount
 	}
 	// front
 	if this.tryMatch("front") {
 		this.emit(tokenTypeSqlFront)
-		return lexSqlSelectStar
+		return lexSqlPopCount
 	}
 	// columns
 	return lexSqlSelectColumn(this)
 }
 
+// Scans optional number of records to pop or peek.
+func lexSqlPopCount(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if unicode.IsDigit(this.peek()) {
+		return this.lexSqlValue(lexSqlPopColumns)
+	}
+	return lexSqlPopColumns
+}
+
+func lexSqlPopColumns(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	// from
+	if this.tryMatchKeyword("from") {
+		this.emit(tokenTypeSqlFrom)
+		return lexSqlFromTable
+	}
+	return lexSqlSelectStar
+}
+
 func lexSqlPeekFrom(this *lexer) stateFn {
 	this.skipWhiteSpaces()
 	if this.next() == '*' {
@@ -653,12 +916,12 @@ func lexSqlPeekFrom(this *lexer) stateFn {
 	// back
 	if this.tryMatch("back") {
 		this.emit(tokenTypeSqlBack)
-		return lexSqlSelectStar
+		return lexSqlPopCount
 	}
 	// front
 	if this.tryMatch("front") {
 		this.emit(tokenTypeSqlFront)
-		return lexSqlSelectStar
+		return lexSqlPopCount
 	}
 	// columns
 	return lexSqlSelectColumn(this)
@@ -723,6 +986,75 @@ func lexSqlWhere(this *lexer) stateFn {
 	return this.lexTryMatch(tokenTypeSqlWhere, "where", lexSqlWhereColumn, lexSqlReturning)
 }
 
+// DROP sql statement scan state functions.
+
+func lexSqlDropTrigger(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	return this.lexMatch(tokenTypeSqlTrigger, "trigger", 0, lexSqlDropTriggerName)
+}
+
+func lexSqlDropTriggerName(this *lexer) stateFn {
+	return this.lexSqlIdentifier(tokenTypeSqlTriggerName, lexEof)
+}
+
+// CREATE TRIGGER sql statement scan state functions.
+
+func lexSqlCreateTrigger(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	return this.lexMatch(tokenTypeSqlTrigger, "trigger", 0, lexSqlCreateTriggerName)
+}
+
+func lexSqlCreateTriggerName(this *lexer) stateFn {
+	return this.lexSqlIdentifier(tokenTypeSqlTriggerName, lexSqlTriggerAfter)
+}
+
+func lexSqlTriggerAfter(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	return this.lexMatch(tokenTypeSqlAfter, "after", 0, lexSqlTriggerAction)
+}
+
+func lexSqlTriggerAction(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.tryMatchKeyword("insert") {
+		this.emit(tokenTypeSqlInsert)
+		return lexSqlTriggerOn
+	}
+	if this.tryMatchKeyword("update") {
+		this.emit(tokenTypeSqlUpdate)
+		return lexSqlTriggerOn
+	}
+	if this.tryMatchKeyword("delete") {
+		this.emit(tokenTypeSqlDelete)
+		return lexSqlTriggerOn
+	}
+	return this.errorToken("expected insert, update or delete")
+}
+
+func lexSqlTriggerOn(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	return this.lexMatch(tokenTypeSqlOn, "on", 0, lexSqlTriggerTable)
+}
+
+func lexSqlTriggerTable(this *lexer) stateFn {
+	return this.lexSqlIdentifier(tokenTypeSqlTable, lexSqlTriggerDo)
+}
+
+func lexSqlTriggerDo(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	return this.lexMatch(tokenTypeSqlDo, "do", 0, lexSqlTriggerStatement)
+}
+
+// Statement executed by trigger is the rest of the input, it is scanned when the trigger fires.
+func lexSqlTriggerStatement(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.end() {
+		return this.errorToken("expected trigger statement")
+	}
+	this.pos = len(this.input)
+	this.tokens.Consume(&token{tokenTypeSqlStatement, strings.TrimSpace(this.current())})
+	return nil
+}
+
 // KEY and TAG sql statement scan state functions.
 
 func lexSqlKeyTable(this *lexer) stateFn {
@@ -743,24 +1075,410 @@ func lexSqlSubscribe(this *lexer) stateFn {
 	this.skipWhiteSpaces()
 	if this.next() == '*' {
 		this.backup()
-		return lexSqlSelectStar
+		return lexSqlSubscribeStar
 	}
 	this.backup()
-	return this.lexTryMatch(tokenTypeSqlSkip, "skip", lexSqlSelectStar, lexSqlTopic)
+	// skip
+	if this.tryMatchKeyword("skip") {
+		this.emit(tokenTypeSqlSkip)
+		return lexSqlSubscribeStar
+	}
+	// topic and schema are keywords unless followed by a comma or from, in which case they are column names:
+	// subscribe topic from stocks projects column topic, therefore a topic can not be named from
+	pos := this.pos
+	// topic
+	if this.tryMatchKeyword("topic") {
+		if !this.followedByColumns() {
+			this.emit(tokenTypeSqlTopic)
+			return lexSqlTopicName
+		}
+		this.pos = pos
+	}
+	// schema
+	if this.tryMatchKeyword("schema") {
+		if !this.followedByColumns() {
+			this.emit(tokenTypeSqlSchema)
+			return lexEof
+		}
+		this.pos = pos
+	}
+	// columns
+	return lexSqlSubscribeColumn(this)
 }
 
-func lexSqlTopic(this *lexer) stateFn {
-	return this.lexSqlIdentifier(tokenTypeSqlTopic, nil)
+func lexSqlSubscribeStar(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.next() == '*' {
+		this.emit(tokenTypeSqlStar)
+		return lexSqlSubscribeFrom
+	}
+	this.backup()
+	return lexSqlSubscribeColumn(this)
+}
+
+func lexSqlSubscribeColumn(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	// aggregate function
+	pos := this.pos
+	for rune := this.next(); unicode.IsLetter(rune); rune = this.next() {
+
+	}
+	this.backup()
+	if this.peek() == '(' && isAggregateFunction(this.input[pos:this.pos]) {
+		this.emit(tokenTypeSqlAggregate)
+		return lexSqlAggregateLeftParenthesis
+	}
+	this.pos = pos
+	return this.lexSqlIdentifier(tokenTypeSqlColumn, lexSqlSubscribeColumnCommaOrFrom)
+}
+
+func lexSqlAggregateLeftParenthesis(this *lexer) stateFn {
+	return this.lexSqlLeftParenthesis(lexSqlAggregateColumn)
+}
+
+func lexSqlAggregateColumn(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.next() == '*' {
+		this.emit(tokenTypeSqlStar)
+		return lexSqlAggregateRightParenthesis
+	}
+	this.backup()
+	return this.lexSqlIdentifier(tokenTypeSqlColumn, lexSqlAggregateRightParenthesis)
+}
+
+func lexSqlAggregateRightParenthesis(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.next() != ')' {
+		return this.errorToken("expected ) ")
+	}
+	this.emit(tokenTypeSqlRightParenthesis)
+	return lexSqlSubscribeColumnCommaOrFrom
+}
+
+func lexSqlSubscribeColumnCommaOrFrom(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.next() == ',' {
+		this.emit(tokenTypeSqlComma)
+		return lexSqlSubscribeColumn
+	}
+	this.backup()
+	return lexSqlSubscribeFrom(this)
+}
+
+func lexSqlSubscribeFrom(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	return this.lexMatch(tokenTypeSqlFrom, "from", 0, lexSqlSubscribeTable)
+}
+
+func lexSqlSubscribeTable(this *lexer) stateFn {
+	return this.lexSqlTablePattern(lexSqlSubscribeWhere)
+}
+
+func lexSqlSubscribeWhere(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.tryMatchKeyword("where") {
+		this.emit(tokenTypeSqlWhere)
+		return lexSqlConditionColumn
+	}
+	return lexSqlSubscribeOptions
+}
+
+// Subscribe options that follow table name and where clause.
+func lexSqlSubscribeOptions(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.tryMatchKeyword("from") {
+		this.emit(tokenTypeSqlFrom)
+		return lexSqlSubscribeSequence
+	}
+	if this.tryMatchKeyword("conflate") {
+		this.emit(tokenTypeSqlConflate)
+		return lexSqlSubscribeOptions
+	}
+	if this.tryMatchKeyword("throttle") {
+		this.emit(tokenTypeSqlThrottle)
+		return lexSqlSubscribeThrottleValue
+	}
+	if this.tryMatchKeyword("order") {
+		this.emit(tokenTypeSqlOrder)
+		return lexSqlSubscribeOrderBy
+	}
+	if this.tryMatchKeyword("limit") {
+		this.emit(tokenTypeSqlLimit)
+		return lexSqlSubscribeLimitValue
+	}
+	if this.tryMatchKeyword("durable") {
+		this.emit(tokenTypeSqlDurable)
+		return lexSqlSubscribeDurableName
+	}
+	if this.tryMatchKeyword("with") {
+		this.emit(tokenTypeSqlWith)
+		return lexSqlSubscribeWithOld
+	}
+	return lexEof
+}
+
+func lexSqlSubscribeWithOld(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	return this.lexMatch(tokenTypeSqlOld, "old", 0, lexSqlSubscribeWithOldValues)
+}
+
+func lexSqlSubscribeWithOldValues(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	return this.lexMatch(tokenTypeSqlValues, "values", 0, lexSqlSubscribeOptions)
+}
+
+func lexSqlSubscribeDurableName(this *lexer) stateFn {
+	return this.lexSqlIdentifier(tokenTypeSqlDurableName, lexSqlSubscribeOptions)
+}
+
+func lexSqlSubscribeOrderBy(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	return this.lexMatch(tokenTypeSqlBy, "by", 0, lexSqlSubscribeOrderColumn)
+}
+
+func lexSqlSubscribeOrderColumn(this *lexer) stateFn {
+	return this.lexSqlIdentifier(tokenTypeSqlColumn, lexSqlSubscribeOrderDirection)
+}
+
+func lexSqlSubscribeOrderDirection(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.tryMatchKeyword("asc") {
+		this.emit(tokenTypeSqlAsc)
+	} else if this.tryMatchKeyword("desc") {
+		this.emit(tokenTypeSqlDesc)
+	}
+	return lexSqlSubscribeOptions
+}
+
+func lexSqlSubscribeLimitValue(this *lexer) stateFn {
+	return this.lexSqlValue(lexSqlSubscribeOptions)
+}
+
+func lexSqlSubscribeThrottleValue(this *lexer) stateFn {
+	return this.lexSqlValue(lexSqlSubscribeOptions)
+}
+
+func lexSqlSubscribeSequence(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	return this.lexMatch(tokenTypeSqlSequence, "sequence", 0, lexSqlSubscribeSequenceValue)
+}
+
+func lexSqlSubscribeSequenceValue(this *lexer) stateFn {
+	return this.lexSqlValue(lexSqlSubscribeOptions)
+}
+
+// CONDITION subscribe where clause with comparison operators joined by and.
+
+func lexSqlConditionColumn(this *lexer) stateFn {
+	return this.lexSqlIdentifier(tokenTypeSqlColumn, lexSqlConditionOperator)
+}
+
+func lexSqlConditionOperator(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	switch this.next() {
+	case '=':
+		this.emit(tokenTypeSqlEqual)
+		return lexSqlConditionValue
+	case '!':
+		if this.next() == '=' {
+			this.emit(tokenTypeSqlOperator)
+			return lexSqlConditionValue
+		}
+	case '<':
+		if rune := this.next(); rune != '=' && rune != '>' {
+			this.backup()
+		}
+		this.emit(tokenTypeSqlOperator)
+		return lexSqlConditionValue
+	case '>':
+		if this.next() != '=' {
+			this.backup()
+		}
+		this.emit(tokenTypeSqlOperator)
+		return lexSqlConditionValue
+	}
+	return this.errorToken("expected comparison operator ")
+}
+
+func lexSqlConditionValue(this *lexer) stateFn {
+	return this.lexSqlValue(lexSqlConditionAnd)
+}
+
+func lexSqlConditionAnd(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.tryMatchKeyword("and") {
+		this.emit(tokenTypeSqlAnd)
+		return lexSqlConditionColumn
+	}
+	return lexSqlSubscribeOptions
+}
+
+func lexSqlTopicName(this *lexer) stateFn {
+	return this.lexSqlIdentifier(tokenTypeSqlTopicName, nil)
 }
 
 // UNSUBSCRIBE
 
 func lexSqlUnsubscribeFrom(this *lexer) stateFn {
-	return lexSqlFrom(this)
+	this.skipWhiteSpaces()
+	if this.tryMatch("topic") {
+		this.emit(tokenTypeSqlTopic)
+		return lexSqlTopicName
+	}
+	if this.tryMatchKeyword("schema") {
+		this.emit(tokenTypeSqlSchema)
+		return lexEof
+	}
+	return this.lexMatch(tokenTypeSqlFrom, "from", 0, lexSqlUnsubscribeTable)
+}
+
+func lexSqlUnsubscribeTable(this *lexer) stateFn {
+	return this.lexSqlTablePattern(lexSqlWhere)
+}
+
+// RESERVE
+
+func lexSqlReserveFrom(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.tryMatchKeyword("back") {
+		this.emit(tokenTypeSqlBack)
+	} else if this.tryMatchKeyword("front") {
+		this.emit(tokenTypeSqlFront)
+	}
+	return lexSqlReserveFromTable
+}
+
+func lexSqlReserveFromTable(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	return this.lexMatch(tokenTypeSqlFrom, "from", 0, lexSqlReserveTable)
+}
+
+func lexSqlReserveTable(this *lexer) stateFn {
+	return this.lexSqlIdentifier(tokenTypeSqlTable, lexSqlReserveOptions)
+}
+
+func lexSqlReserveOptions(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.tryMatchKeyword("timeout") {
+		this.emit(tokenTypeSqlTimeout)
+		return lexSqlReserveTimeoutValue
+	}
+	if this.tryMatchKeyword("deadletter") {
+		this.emit(tokenTypeSqlDeadLetter)
+		return lexSqlReserveDeadLetterTable
+	}
+	return lexEof
+}
+
+func lexSqlReserveTimeoutValue(this *lexer) stateFn {
+	return this.lexSqlValue(lexSqlReserveOptions)
+}
+
+func lexSqlReserveDeadLetterTable(this *lexer) stateFn {
+	return this.lexSqlIdentifier(tokenTypeSqlTable, lexSqlReserveDeadLetterAfter)
+}
+
+func lexSqlReserveDeadLetterAfter(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	return this.lexMatch(tokenTypeSqlAfter, "after", 0, lexSqlReserveDeadLetterAttempts)
+}
+
+func lexSqlReserveDeadLetterAttempts(this *lexer) stateFn {
+	return this.lexSqlValue(lexSqlReserveOptions)
+}
+
+// ACK and NACK
+
+func lexSqlAck(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.tryMatchKeyword("durable") {
+		this.emit(tokenTypeSqlDurable)
+		return lexSqlAckDurableName
+	}
+	return lexSqlAckTable
+}
+
+func lexSqlAckTable(this *lexer) stateFn {
+	return this.lexSqlIdentifier(tokenTypeSqlTable, lexSqlAckRecordId)
+}
+
+func lexSqlAckRecordId(this *lexer) stateFn {
+	return this.lexSqlValue(lexEof)
+}
+
+func lexSqlAckDurableName(this *lexer) stateFn {
+	return this.lexSqlIdentifier(tokenTypeSqlDurableName, lexSqlAckDelivery)
+}
+
+func lexSqlAckDelivery(this *lexer) stateFn {
+	return this.lexSqlValue(lexEof)
+}
+
+// SHOW SUBSCRIPTIONS
+
+func lexSqlShowSubscriptions(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	return this.lexMatch(tokenTypeSqlSubscriptions, "subscriptions", 0, lexSqlShowSubscriptionsFrom)
+}
+
+func lexSqlShowSubscriptionsFrom(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.end() {
+		return nil
+	}
+	return this.lexMatch(tokenTypeSqlFrom, "from", 0, lexSqlShowSubscriptionsTable)
+}
+
+func lexSqlShowSubscriptionsTable(this *lexer) stateFn {
+	return this.lexSqlIdentifier(tokenTypeSqlTable, lexEof)
+}
+
+// KILL SUBSCRIPTION
+
+func lexSqlKillSubscription(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	return this.lexMatch(tokenTypeSqlSubscription, "subscription", 0, lexSqlKillPubsubid)
+}
+
+func lexSqlKillPubsubid(this *lexer) stateFn {
+	return this.lexSqlValue(lexEof)
+}
+
+// PUBLISH
+
+func lexSqlPublishTopicName(this *lexer) stateFn {
+	return this.lexSqlIdentifier(tokenTypeSqlTopicName, lexSqlPublishMessage)
+}
+
+func lexSqlPublishMessage(this *lexer) stateFn {
+	return this.lexSqlValue(lexEof)
 }
 
 // END SQL
 
+// POLICY cmd arguments.
+
+func lexCmdPolicyArgs(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.end() {
+		return nil
+	}
+	return this.lexSqlValue(lexCmdPolicyArgs)
+}
+
+// RESTORE cmd arguments.
+
+// Table dump is the rest of the input.
+func lexCmdRestoreDump(this *lexer) stateFn {
+	this.skipWhiteSpaces()
+	if this.end() {
+		return this.errorToken("expected table dump")
+	}
+	this.pos = len(this.input)
+	this.tokens.Consume(&token{tokenTypeCmdDump, strings.TrimSpace(this.current())})
+	return nil
+}
+
 // Helper function to process status stop start commands.
 func lexCommandST(this *lexer) stateFn {
 	switch this.next() {
@@ -774,7 +1492,7 @@ func lexCommandST(this *lexer) stateFn {
 	return this.errorToken("Invalid command:" + this.current())
 }
 
-// Helper function to process select subscribe status stop start commands.
+// Helper function to process select subscribe status stop start show snapshot commands.
 func lexCommandS(this *lexer) stateFn {
 	switch this.next() {
 	case 'e':
@@ -783,17 +1501,54 @@ func lexCommandS(this *lexer) stateFn {
 		return this.lexMatch(tokenTypeSqlSubscribe, "subscribe", 2, lexSqlSubscribe)
 	case 't':
 		return lexCommandST(this)
+	case 'h':
+		return this.lexMatch(tokenTypeSqlShow, "show", 2, lexSqlShowSubscriptions)
+	case 'n':
+		return this.lexMatch(tokenTypeCmdSnapshot, "snapshot", 2, nil)
+	}
+	return this.errorToken("Invalid command:" + this.current())
+}
+
+// Helper function to process reserve restore commands.
+func lexCommandRES(this *lexer) stateFn {
+	switch this.next() {
+	case 'e':
+		return this.lexMatch(tokenTypeSqlReserve, "reserve", 4, lexSqlReserveFrom)
+	case 't':
+		return this.lexMatch(tokenTypeCmdRestore, "restore", 4, lexCmdRestoreDump)
+	}
+	return this.errorToken("Invalid command:" + this.current())
+}
+
+// Helper function to process push, publish commands.
+func lexCommandPU(this *lexer) stateFn {
+	switch this.next() {
+	case 's':
+		return this.lexMatch(tokenTypeSqlPush, "push", 3, lexSqlPushInto)
+	case 'b':
+		return this.lexMatch(tokenTypeSqlPublish, "publish", 3, lexSqlPublishTopicName)
 	}
 	return this.errorToken("Invalid command:" + this.current())
 }
 
-// Helper function to process push, pop, peek commands.
+// Helper function to process pop, policy commands.
+func lexCommandPO(this *lexer) stateFn {
+	switch this.next() {
+	case 'p':
+		return this.lexMatch(tokenTypeSqlPop, "pop", 3, lexSqlPopFrom)
+	case 'l':
+		return this.lexMatch(tokenTypeCmdPolicy, "policy", 3, lexCmdPolicyArgs)
+	}
+	return this.errorToken("Invalid command:" + this.current())
+}
+
+// Helper function to process push, publish, pop, policy, peek commands.
 func lexCommandP(this *lexer) stateFn {
 	switch this.next() {
 	case 'u':
-		return this.lexMatch(tokenTypeSqlPush, "push", 2, lexSqlPushInto)
+		return lexCommandPU(this)
 	case 'o':
-		return this.lexMatch(tokenTypeSqlPop, "pop", 2, lexSqlPopFrom)
+		return lexCommandPO(this)
 	case 'e':
 		return this.lexMatch(tokenTypeSqlPeek, "peek", 2, lexSqlPeekFrom)
 	}
@@ -809,22 +1564,42 @@ func lexCommand(this *lexer) stateFn {
 			return this.lexMatch(tokenTypeSqlUpdate, "update", 2, lexSqlUpdateTable)
 		}
 		return this.lexMatch(tokenTypeSqlUnsubscribe, "unsubscribe", 2, lexSqlUnsubscribeFrom)
-	case 's': // select subscribe status stop start stream
+	case 's': // select subscribe status stop start stream show snapshot
 		return lexCommandS(this)
 	case 'i': // insert
-		return this.lexMatch(tokenTypeSqlInsert, "insert", 1, lexSqlInsertInto)
-	case 'd': // delete
-		return this.lexMatch(tokenTypeSqlDelete, "delete", 1, lexSqlFrom)
-	case 'k': // key
-		return this.lexMatch(tokenTypeSqlKey, "key", 1, lexSqlKeyTable)
+		return this.lexMatch(tokenTypeSqlInsert, "insert", 1, lexSqlInsertEphemeral)
+	case 'd': // delete drop
+		if this.next() == 'r' {
+			return this.lexMatch(tokenTypeSqlDrop, "drop", 2, lexSqlDropTrigger)
+		}
+		return this.lexMatch(tokenTypeSqlDelete, "delete", 2, lexSqlFrom)
+	case 'k': // key kill
+		if this.next() == 'i' {
+			return this.lexMatch(tokenTypeSqlKill, "kill", 2, lexSqlKillSubscription)
+		}
+		return this.lexMatch(tokenTypeSqlKey, "key", 2, lexSqlKeyTable)
 	case 't': // tag
 		return this.lexMatch(tokenTypeSqlTag, "tag", 1, lexSqlKeyTable)
-	case 'c': // close
-		return this.lexMatch(tokenTypeCmdClose, "close", 1, nil)
-	case 'p': // pop, push, peek
+	case 'c': // close create
+		if this.next() == 'r' {
+			return this.lexMatch(tokenTypeSqlCreate, "create", 2, lexSqlCreateTrigger)
+		}
+		return this.lexMatch(tokenTypeCmdClose, "close", 2, nil)
+	case 'p': // pop, policy, push, publish, peek
 		return lexCommandP(this)
 	case 'm': // mysql
 		return this.lexMatch(tokenTypeCmdMysql, "mysql", 1, lexCmdMysql)
+	case 'a': // ack
+		return this.lexMatch(tokenTypeSqlAck, "ack", 1, lexSqlAck)
+	case 'n': // nack
+		return this.lexMatch(tokenTypeSqlNack, "nack", 1, lexSqlAckTable)
+	case 'r': // reserve restore
+		if this.next() == 'e' && this.next() == 's' {
+			return lexCommandRES(this)
+		}
+		return this.errorToken("Invalid command:" + this.current())
+	case 'b': // backup
+		return this.lexMatch(tokenTypeCmdBackup, "backup", 1, nil)
 	}
 	return this.errorToken("Invalid command:" + this.current())
 }
@@ -85,6 +85,40 @@ func TestStopCommand(t *testing.T) {
 	validateTokens(t, expected, consumer.channel)
 }
 
+// SNAPSHOT
+func TestSnapshotCommand(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" snapshot ", &consumer)
+	expected := []token{
+		{tokenTypeCmdSnapshot, "snapshot"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+// BACKUP
+func TestBackupCommand(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" backup ", &consumer)
+	expected := []token{
+		{tokenTypeCmdBackup, "backup"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+// RESTORE
+func TestRestoreCommand(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(` restore {"table":"stocks","records":[]} `, &consumer)
+	expected := []token{
+		{tokenTypeCmdRestore, "restore"},
+		{tokenTypeCmdDump, `{"table":"stocks","records":[]}`},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
 // CLOSE
 func TestCloseCommand(t *testing.T) {
 	consumer := chanTokenConsumer{channel: make(chan *token)}
@@ -96,6 +130,19 @@ func TestCloseCommand(t *testing.T) {
 	validateTokens(t, expected, consumer.channel)
 }
 
+// POLICY
+func TestPolicyCommand(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex("policy block 500", &consumer)
+	expected := []token{
+		{tokenTypeCmdPolicy, "policy"},
+		{tokenTypeSqlValue, "block"},
+		{tokenTypeSqlValue, "500"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
 // INSERT
 func TestSqlInsertStatement1(t *testing.T) {
 	consumer := chanTokenConsumer{channel: make(chan *token)}
@@ -184,6 +231,26 @@ func TestSqlInsertStatement3(t *testing.T) {
 	validateTokens(t, expected, consumer.channel)
 }
 
+func TestSqlInsertEphemeralStatement(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex("insert ephemeral into users (name) values (john)", &consumer)
+	expected := []token{
+		{tokenTypeSqlInsert, "insert"},
+		{tokenTypeSqlEphemeral, "ephemeral"},
+		{tokenTypeSqlInto, "into"},
+		{tokenTypeSqlTable, "users"},
+		{tokenTypeSqlLeftParenthesis, "("},
+		{tokenTypeSqlColumn, "name"},
+		{tokenTypeSqlRightParenthesis, ")"},
+		{tokenTypeSqlValues, "values"},
+		{tokenTypeSqlLeftParenthesis, "("},
+		{tokenTypeSqlValue, "john"},
+		{tokenTypeSqlRightParenthesis, ")"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
 // DELETE
 func TestSqlDeleteStatement1(t *testing.T) {
 	consumer := chanTokenConsumer{channel: make(chan *token)}
@@ -344,12 +411,423 @@ func TestSqlSubscribeStatement3(t *testing.T) {
 	validateTokens(t, expected, consumer.channel)
 }
 
+func TestSqlSubscribePredicate(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" subscribe * from orders where status = 'open' and amount > 1000 and qty<=5 and side != buy and px <> 1", &consumer)
+	expected := []token{
+		{tokenTypeSqlSubscribe, "subscribe"},
+		{tokenTypeSqlStar, "*"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "orders"},
+		{tokenTypeSqlWhere, "where"},
+		{tokenTypeSqlColumn, "status"},
+		{tokenTypeSqlEqual, "="},
+		{tokenTypeSqlValue, "open"},
+		{tokenTypeSqlAnd, "and"},
+		{tokenTypeSqlColumn, "amount"},
+		{tokenTypeSqlOperator, ">"},
+		{tokenTypeSqlValue, "1000"},
+		{tokenTypeSqlAnd, "and"},
+		{tokenTypeSqlColumn, "qty"},
+		{tokenTypeSqlOperator, "<="},
+		{tokenTypeSqlValue, "5"},
+		{tokenTypeSqlAnd, "and"},
+		{tokenTypeSqlColumn, "side"},
+		{tokenTypeSqlOperator, "!="},
+		{tokenTypeSqlValue, "buy"},
+		{tokenTypeSqlAnd, "and"},
+		{tokenTypeSqlColumn, "px"},
+		{tokenTypeSqlOperator, "<>"},
+		{tokenTypeSqlValue, "1"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlSubscribeColumns(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" subscribe skip ticker, bid from stocks where sector = TECH", &consumer)
+	expected := []token{
+		{tokenTypeSqlSubscribe, "subscribe"},
+		{tokenTypeSqlSkip, "skip"},
+		{tokenTypeSqlColumn, "ticker"},
+		{tokenTypeSqlComma, ","},
+		{tokenTypeSqlColumn, "bid"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "stocks"},
+		{tokenTypeSqlWhere, "where"},
+		{tokenTypeSqlColumn, "sector"},
+		{tokenTypeSqlEqual, "="},
+		{tokenTypeSqlValue, "TECH"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlSubscribeFromSequence(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" subscribe * from stocks where ticker = IBM from sequence 12345", &consumer)
+	expected := []token{
+		{tokenTypeSqlSubscribe, "subscribe"},
+		{tokenTypeSqlStar, "*"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "stocks"},
+		{tokenTypeSqlWhere, "where"},
+		{tokenTypeSqlColumn, "ticker"},
+		{tokenTypeSqlEqual, "="},
+		{tokenTypeSqlValue, "IBM"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlSequence, "sequence"},
+		{tokenTypeSqlValue, "12345"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlSubscribeConflate(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" subscribe * from stocks conflate", &consumer)
+	expected := []token{
+		{tokenTypeSqlSubscribe, "subscribe"},
+		{tokenTypeSqlStar, "*"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "stocks"},
+		{tokenTypeSqlConflate, "conflate"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlSubscribeThrottle(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" subscribe * from stocks throttle 200ms conflate", &consumer)
+	expected := []token{
+		{tokenTypeSqlSubscribe, "subscribe"},
+		{tokenTypeSqlStar, "*"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "stocks"},
+		{tokenTypeSqlThrottle, "throttle"},
+		{tokenTypeSqlValue, "200ms"},
+		{tokenTypeSqlConflate, "conflate"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlSubscribeTablePattern(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" subscribe * from orders_* where status = open", &consumer)
+	expected := []token{
+		{tokenTypeSqlSubscribe, "subscribe"},
+		{tokenTypeSqlStar, "*"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "orders_*"},
+		{tokenTypeSqlWhere, "where"},
+		{tokenTypeSqlColumn, "status"},
+		{tokenTypeSqlEqual, "="},
+		{tokenTypeSqlValue, "open"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+	//
+	all := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" subscribe * from *", &all)
+	expected = []token{
+		{tokenTypeSqlSubscribe, "subscribe"},
+		{tokenTypeSqlStar, "*"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "*"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, all.channel)
+	//
+	unsubscribe := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" unsubscribe from orders_*", &unsubscribe)
+	expected = []token{
+		{tokenTypeSqlUnsubscribe, "unsubscribe"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "orders_*"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, unsubscribe.channel)
+}
+
+func TestSqlSubscribeAggregates(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" subscribe count(*), sum( amount ) from orders where status = open", &consumer)
+	expected := []token{
+		{tokenTypeSqlSubscribe, "subscribe"},
+		{tokenTypeSqlAggregate, "count"},
+		{tokenTypeSqlLeftParenthesis, "("},
+		{tokenTypeSqlStar, "*"},
+		{tokenTypeSqlRightParenthesis, ")"},
+		{tokenTypeSqlComma, ","},
+		{tokenTypeSqlAggregate, "sum"},
+		{tokenTypeSqlLeftParenthesis, "("},
+		{tokenTypeSqlColumn, "amount"},
+		{tokenTypeSqlRightParenthesis, ")"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "orders"},
+		{tokenTypeSqlWhere, "where"},
+		{tokenTypeSqlColumn, "status"},
+		{tokenTypeSqlEqual, "="},
+		{tokenTypeSqlValue, "open"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+	// column named as aggregate function
+	column := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" subscribe count from orders", &column)
+	expected = []token{
+		{tokenTypeSqlSubscribe, "subscribe"},
+		{tokenTypeSqlColumn, "count"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "orders"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, column.channel)
+}
+
+func TestSqlSubscribeOrderBy(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" subscribe * from scores where game = chess order by points desc limit 10", &consumer)
+	expected := []token{
+		{tokenTypeSqlSubscribe, "subscribe"},
+		{tokenTypeSqlStar, "*"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "scores"},
+		{tokenTypeSqlWhere, "where"},
+		{tokenTypeSqlColumn, "game"},
+		{tokenTypeSqlEqual, "="},
+		{tokenTypeSqlValue, "chess"},
+		{tokenTypeSqlOrder, "order"},
+		{tokenTypeSqlBy, "by"},
+		{tokenTypeSqlColumn, "points"},
+		{tokenTypeSqlDesc, "desc"},
+		{tokenTypeSqlLimit, "limit"},
+		{tokenTypeSqlValue, "10"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
 func TestSqlSubscribeTopic(t *testing.T) {
 	consumer := chanTokenConsumer{channel: make(chan *token)}
-	go lex("subscribe topicname", &consumer)
+	go lex("subscribe topic topicname", &consumer)
+	expected := []token{
+		{tokenTypeSqlSubscribe, "subscribe"},
+		{tokenTypeSqlTopic, "topic"},
+		{tokenTypeSqlTopicName, "topicname"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlUnsubscribeTopic(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex("unsubscribe topic topicname", &consumer)
+	expected := []token{
+		{tokenTypeSqlUnsubscribe, "unsubscribe"},
+		{tokenTypeSqlTopic, "topic"},
+		{tokenTypeSqlTopicName, "topicname"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+// SCHEMA
+func TestSqlSubscribeSchema(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex("subscribe schema", &consumer)
+	expected := []token{
+		{tokenTypeSqlSubscribe, "subscribe"},
+		{tokenTypeSqlSchema, "schema"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+// topic and schema followed by from are column names
+func TestSqlSubscribeTopicSchemaColumns(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex("subscribe topic from news", &consumer)
+	expected := []token{
+		{tokenTypeSqlSubscribe, "subscribe"},
+		{tokenTypeSqlColumn, "topic"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "news"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+
+	schema := chanTokenConsumer{channel: make(chan *token)}
+	go lex("subscribe schema , topic from topic", &schema)
+	expected = []token{
+		{tokenTypeSqlSubscribe, "subscribe"},
+		{tokenTypeSqlColumn, "schema"},
+		{tokenTypeSqlComma, ","},
+		{tokenTypeSqlColumn, "topic"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "topic"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, schema.channel)
+}
+
+// ACK
+func TestSqlAck(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" ack durable worker 12 ", &consumer)
+	expected := []token{
+		{tokenTypeSqlAck, "ack"},
+		{tokenTypeSqlDurable, "durable"},
+		{tokenTypeSqlDurableName, "worker"},
+		{tokenTypeSqlValue, "12"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlAckRecord(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" ack jobs 12 ", &consumer)
+	expected := []token{
+		{tokenTypeSqlAck, "ack"},
+		{tokenTypeSqlTable, "jobs"},
+		{tokenTypeSqlValue, "12"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlNack(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" nack jobs 12 ", &consumer)
+	expected := []token{
+		{tokenTypeSqlNack, "nack"},
+		{tokenTypeSqlTable, "jobs"},
+		{tokenTypeSqlValue, "12"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlReserve(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" reserve front from jobs timeout 60s deadletter failed after 3 ", &consumer)
+	expected := []token{
+		{tokenTypeSqlReserve, "reserve"},
+		{tokenTypeSqlFront, "front"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "jobs"},
+		{tokenTypeSqlTimeout, "timeout"},
+		{tokenTypeSqlValue, "60s"},
+		{tokenTypeSqlDeadLetter, "deadletter"},
+		{tokenTypeSqlTable, "failed"},
+		{tokenTypeSqlAfter, "after"},
+		{tokenTypeSqlValue, "3"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlCreateTrigger(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" create trigger audit after update on trades do update positions set qty = new.qty where sym = old.sym ", &consumer)
+	expected := []token{
+		{tokenTypeSqlCreate, "create"},
+		{tokenTypeSqlTrigger, "trigger"},
+		{tokenTypeSqlTriggerName, "audit"},
+		{tokenTypeSqlAfter, "after"},
+		{tokenTypeSqlUpdate, "update"},
+		{tokenTypeSqlOn, "on"},
+		{tokenTypeSqlTable, "trades"},
+		{tokenTypeSqlDo, "do"},
+		{tokenTypeSqlStatement, "update positions set qty = new.qty where sym = old.sym"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlDropTrigger(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" drop trigger audit ", &consumer)
+	expected := []token{
+		{tokenTypeSqlDrop, "drop"},
+		{tokenTypeSqlTrigger, "trigger"},
+		{tokenTypeSqlTriggerName, "audit"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlSubscribeWithOldValues(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" subscribe * from trades with old values ", &consumer)
 	expected := []token{
 		{tokenTypeSqlSubscribe, "subscribe"},
-		{tokenTypeSqlTopic, "topicname"}}
+		{tokenTypeSqlStar, "*"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "trades"},
+		{tokenTypeSqlWith, "with"},
+		{tokenTypeSqlOld, "old"},
+		{tokenTypeSqlValues, "values"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlSubscribeDurable(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" subscribe * from jobs durable worker ", &consumer)
+	expected := []token{
+		{tokenTypeSqlSubscribe, "subscribe"},
+		{tokenTypeSqlStar, "*"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "jobs"},
+		{tokenTypeSqlDurable, "durable"},
+		{tokenTypeSqlDurableName, "worker"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+// SHOW SUBSCRIPTIONS
+func TestSqlShowSubscriptions(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" show subscriptions from stocks ", &consumer)
+	expected := []token{
+		{tokenTypeSqlShow, "show"},
+		{tokenTypeSqlSubscriptions, "subscriptions"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "stocks"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+// KILL SUBSCRIPTION
+func TestSqlKillSubscription(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" kill subscription 12 ", &consumer)
+	expected := []token{
+		{tokenTypeSqlKill, "kill"},
+		{tokenTypeSqlSubscription, "subscription"},
+		{tokenTypeSqlValue, "12"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+// PUBLISH
+func TestSqlPublish(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex("publish topicname 'hello world'", &consumer)
+	expected := []token{
+		{tokenTypeSqlPublish, "publish"},
+		{tokenTypeSqlTopicName, "topicname"},
+		{tokenTypeSqlValue, "hello world"},
+		{tokenTypeEOF, ""}}
 
 	validateTokens(t, expected, consumer.channel)
 }
@@ -581,6 +1059,73 @@ func TestSqlPushStatement3(t *testing.T) {
 	validateTokens(t, expected, consumer.channel)
 }
 
+func TestSqlPushStatement4(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex("push back into jobs (name) values (job1) delay 5m returning *", &consumer)
+	expected := []token{
+		{tokenTypeSqlPush, "push"},
+		{tokenTypeSqlBack, "back"},
+		{tokenTypeSqlInto, "into"},
+		{tokenTypeSqlTable, "jobs"},
+		{tokenTypeSqlLeftParenthesis, "("},
+		{tokenTypeSqlColumn, "name"},
+		{tokenTypeSqlRightParenthesis, ")"},
+		{tokenTypeSqlValues, "values"},
+		{tokenTypeSqlLeftParenthesis, "("},
+		{tokenTypeSqlValue, "job1"},
+		{tokenTypeSqlRightParenthesis, ")"},
+		{tokenTypeSqlDelay, "delay"},
+		{tokenTypeSqlValue, "5m"},
+		{tokenTypeSqlReturning, "returning"},
+		{tokenTypeSqlStar, "*"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlPushStatement5(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex("push into jobs (name) values (job1) at '2026-11-01T00:00:00Z'", &consumer)
+	expected := []token{
+		{tokenTypeSqlPush, "push"},
+		{tokenTypeSqlInto, "into"},
+		{tokenTypeSqlTable, "jobs"},
+		{tokenTypeSqlLeftParenthesis, "("},
+		{tokenTypeSqlColumn, "name"},
+		{tokenTypeSqlRightParenthesis, ")"},
+		{tokenTypeSqlValues, "values"},
+		{tokenTypeSqlLeftParenthesis, "("},
+		{tokenTypeSqlValue, "job1"},
+		{tokenTypeSqlRightParenthesis, ")"},
+		{tokenTypeSqlAt, "at"},
+		{tokenTypeSqlValue, "2026-11-01T00:00:00Z"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlPushStatement6(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex("push back into jobs priority 5 (name) values (job1)", &consumer)
+	expected := []token{
+		{tokenTypeSqlPush, "push"},
+		{tokenTypeSqlBack, "back"},
+		{tokenTypeSqlInto, "into"},
+		{tokenTypeSqlTable, "jobs"},
+		{tokenTypeSqlPriority, "priority"},
+		{tokenTypeSqlValue, "5"},
+		{tokenTypeSqlLeftParenthesis, "("},
+		{tokenTypeSqlColumn, "name"},
+		{tokenTypeSqlRightParenthesis, ")"},
+		{tokenTypeSqlValues, "values"},
+		{tokenTypeSqlLeftParenthesis, "("},
+		{tokenTypeSqlValue, "job1"},
+		{tokenTypeSqlRightParenthesis, ")"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
 // POP
 func TestSqlPopStatement1(t *testing.T) {
 	consumer := chanTokenConsumer{channel: make(chan *token)}
@@ -676,6 +1221,36 @@ func TestSqlPopStatement6(t *testing.T) {
 	validateTokens(t, expected, consumer.channel)
 }
 
+func TestSqlPopStatement7(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" pop front from jobs wait 30s", &consumer)
+	expected := []token{
+		{tokenTypeSqlPop, "pop"},
+		{tokenTypeSqlFront, "front"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "jobs"},
+		{tokenTypeSqlWait, "wait"},
+		{tokenTypeSqlValue, "30s"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
+func TestSqlPopStatement8(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" pop front 50 * from jobs", &consumer)
+	expected := []token{
+		{tokenTypeSqlPop, "pop"},
+		{tokenTypeSqlFront, "front"},
+		{tokenTypeSqlValue, "50"},
+		{tokenTypeSqlStar, "*"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "jobs"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
+
 // PEEK
 func TestSqliPeekStatement1(t *testing.T) {
 	consumer := chanTokenConsumer{channel: make(chan *token)}
@@ -770,3 +1345,17 @@ func TestSqlPeekStatement6(t *testing.T) {
 
 	validateTokens(t, expected, consumer.channel)
 }
+
+func TestSqlPeekStatement7(t *testing.T) {
+	consumer := chanTokenConsumer{channel: make(chan *token)}
+	go lex(" peek back 20 from events", &consumer)
+	expected := []token{
+		{tokenTypeSqlPeek, "peek"},
+		{tokenTypeSqlBack, "back"},
+		{tokenTypeSqlValue, "20"},
+		{tokenTypeSqlFrom, "from"},
+		{tokenTypeSqlTable, "events"},
+		{tokenTypeEOF, ""}}
+
+	validateTokens(t, expected, consumer.channel)
+}
@@ -54,6 +54,9 @@ type network struct {
 	connections map[uint64]*networkConnection
 	listener    net.Listener
 	context     *networkContext
+	// responses dropped and spilled by closed connections
+	dropped uint64
+	spilled uint64
 }
 
 func (this *network) addConnection(netConn *networkConnection) {
@@ -73,6 +76,10 @@ func (this *network) removeConnection(netConn *networkConnection) {
 	this.mutex.Lock()
 	defer this.mutex.Unlock()
 	if this.connections != nil {
+		if _, contains := this.connections[netConn.getConnectionId()]; contains {
+			this.dropped += netConn.sender.droppedCount()
+			this.spilled += netConn.sender.spilledCount()
+		}
 		delete(this.connections, netConn.getConnectionId())
 	}
 }
@@ -84,6 +91,19 @@ func (this *network) connectionCount() int {
 	return count
 }
 
+// Returns total number of responses dropped and spilled due to slow consumers.
+func (this *network) slowConsumerCounters() (uint64, uint64) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	dropped := this.dropped
+	spilled := this.spilled
+	for _, c := range this.connections {
+		dropped += c.sender.droppedCount()
+		spilled += c.sender.spilledCount()
+	}
+	return dropped, spilled
+}
+
 func (this *network) closeConnections() {
 	this.mutex.Lock()
 	defer this.mutex.Unlock()
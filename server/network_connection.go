@@ -53,6 +53,10 @@ func (this *networkConnection) watchForQuit() {
 	}
 	this.conn.Close()
 	this.parent.removeConnection(this)
+	this.sender.release()
+	// notify tables so that ephemeral records owned by this connection are deleted
+	req := &sqlConnectionClosedRequest{connectionId: this.getConnectionId()}
+	this.route(nil, req)
 }
 
 func (this *networkConnection) close() {
@@ -128,6 +132,8 @@ func (this *networkConnection) write() {
 			for nextRes != nil && res.merge(nextRes) {
 				nextRes = this.sender.tryRecv()
 			}
+			// there is room in the queue for spilled responses
+			this.sender.refill()
 			// write messages in batches if applicable
 			var msg []byte
 			more := true
@@ -16,7 +16,12 @@
 
 package server
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
 
 // tokenProducer produces tokens for the parser.
 type tokenProducer interface {
@@ -96,6 +101,51 @@ func (this *parser) parseSqlWhere(filter *sqlFilter, tok *token) request {
 	return this.parseSqlEqualVal(&(filter.columnValue), nil)
 }
 
+// Parses where clause conditions joined by and leaving tok at the token that follows the clause.
+// Single equality condition is stored as col = val filter, otherwise filter holds the predicate.
+func (this *parser) parseSqlWherePredicate(filter *sqlFilter, ptok **token) request {
+	tok := *ptok
+	//must be where
+	if tok.typ != tokenTypeSqlWhere {
+		return this.parseError("expected where clause")
+	}
+	predicate := new(sqlPredicate)
+	for {
+		cond := new(sqlCondition)
+		// col
+		tok = this.tokens.Produce()
+		if tok.typ != tokenTypeSqlColumn {
+			return this.parseError("expected column name")
+		}
+		cond.col = tok.val
+		// operator
+		tok = this.tokens.Produce()
+		if tok.typ != tokenTypeSqlEqual && tok.typ != tokenTypeSqlOperator {
+			return this.parseError("expected comparison operator")
+		}
+		cond.op = tok.val
+		// value
+		tok = this.tokens.Produce()
+		if tok.typ != tokenTypeSqlValue {
+			return this.parseError("expected valid value")
+		}
+		cond.val = tok.val
+		predicate.conditions = append(predicate.conditions, cond)
+		// and
+		tok = this.tokens.Produce()
+		if tok.typ != tokenTypeSqlAnd {
+			break
+		}
+	}
+	*ptok = tok
+	if len(predicate.conditions) == 1 && predicate.conditions[0].op == "=" {
+		filter.addFilter(predicate.conditions[0].col, predicate.conditions[0].val)
+		return nil
+	}
+	filter.predicate = predicate
+	return nil
+}
+
 // STATUS cmd
 func (this *parser) parseCmdStatus() request {
 	// into
@@ -116,6 +166,41 @@ func (this *parser) parseCmdStop() request {
 	return new(cmdStopRequest)
 }
 
+// SNAPSHOT cmd
+func (this *parser) parseCmdSnapshot() request {
+	tok := this.tokens.Produce()
+	if tok.typ != tokenTypeEOF {
+		return this.parseError("unexpected extra token")
+	}
+	return new(cmdSnapshotRequest)
+}
+
+// BACKUP cmd
+func (this *parser) parseCmdBackup() request {
+	tok := this.tokens.Produce()
+	if tok.typ != tokenTypeEOF {
+		return this.parseError("unexpected extra token")
+	}
+	return new(cmdBackupRequest)
+}
+
+// RESTORE cmd
+// restore {table dump}
+func (this *parser) parseCmdRestore() request {
+	tok := this.tokens.Produce()
+	if tok.typ != tokenTypeCmdDump {
+		return this.parseError("expected table dump")
+	}
+	snap := new(tableSnapshot)
+	if err := json.Unmarshal([]byte(tok.val), snap); err != nil {
+		return this.parseError("invalid table dump: " + err.Error())
+	}
+	if !isIdentifier(snap.Table) {
+		return this.parseError("invalid table name in table dump: " + snap.Table)
+	}
+	return &cmdRestoreRequest{snap: snap}
+}
+
 // CLOSE cmd
 func (this *parser) parseCmdClose() request {
 	// into
@@ -126,18 +211,62 @@ func (this *parser) parseCmdClose() request {
 	return new(cmdCloseRequest)
 }
 
+// POLICY cmd
+// policy disconnect | block milliseconds | drop oldest | drop newest | spill
+func (this *parser) parseCmdPolicy() request {
+	req := new(cmdPolicyRequest)
+	tok := this.tokens.Produce()
+	if tok.typ != tokenTypeSqlValue {
+		return this.parseError("expected policy")
+	}
+	name := tok.val
+	tok = this.tokens.Produce()
+	switch name {
+	case "block":
+		if tok.typ != tokenTypeSqlValue {
+			return this.parseError("expected block timeout in milliseconds")
+		}
+		timeout, err := strconv.ParseUint(tok.val, 10, 32)
+		if err != nil {
+			return this.parseError("invalid block timeout " + tok.val)
+		}
+		req.timeout = time.Duration(timeout) * time.Millisecond
+		tok = this.tokens.Produce()
+	case "drop":
+		if tok.typ != tokenTypeSqlValue {
+			return this.parseError("expected oldest or newest")
+		}
+		name += tok.val
+		tok = this.tokens.Produce()
+	}
+	policy, valid := parseSlowConsumerPolicy(name)
+	if !valid {
+		return this.parseError("invalid policy " + name)
+	}
+	req.policy = policy
+	if tok.typ != tokenTypeEOF {
+		return this.parseError("unexpected extra token")
+	}
+	return req
+}
+
 // INSERT sql statement
 
 // Parses sql insert statement and returns sqlInsertRequest on success.
 func (this *parser) parseSqlInsert() request {
-	// into
+	req := &sqlInsertRequest{
+		colVals: make([]*columnValue, 0, config.PARSER_SQL_INSERT_REQUEST_COLUMN_CAPACITY),
+	}
+	// ephemeral
 	tok := this.tokens.Produce()
+	if tok.typ == tokenTypeSqlEphemeral {
+		req.ephemeral = true
+		tok = this.tokens.Produce()
+	}
+	// into
 	if tok.typ != tokenTypeSqlInto {
 		return this.parseError("expected into")
 	}
-	req := &sqlInsertRequest{
-		colVals: make([]*columnValue, 0, config.PARSER_SQL_INSERT_REQUEST_COLUMN_CAPACITY),
-	}
 	// table name
 	if errreq := this.parseTableName(&req.table); errreq != nil {
 		return errreq
@@ -233,8 +362,20 @@ func (this *parser) parseSqlPush() request {
 	if errreq := this.parseTableName(&req.table); errreq != nil {
 		return errreq
 	}
-	// (
+	// priority
 	tok = this.tokens.Produce()
+	if tok.typ == tokenTypeSqlPriority {
+		if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlValue {
+			return this.parseError("expected priority")
+		}
+		priority, err := strconv.ParseUint(tok.val, 10, 31)
+		if err != nil || priority == 0 {
+			return this.parseError("invalid priority " + tok.val + " expected positive integer")
+		}
+		req.priority = int(priority)
+		tok = this.tokens.Produce()
+	}
+	// (
 	if tok.typ != tokenTypeSqlLeftParenthesis {
 		return this.parseError("expected ( ")
 	}
@@ -278,7 +419,31 @@ func (this *parser) parseSqlPush() request {
 		s := fmt.Sprintf("number of columns:%d and values:%d do not match", columns, values)
 		return this.parseError(s)
 	}
-	return this.returningColumnsHelper(nil, req, &req.returningColumns)
+	// delay or at
+	tok = this.tokens.Produce()
+	switch tok.typ {
+	case tokenTypeSqlDelay:
+		if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlValue {
+			return this.parseError("expected delay")
+		}
+		delay, err := time.ParseDuration(tok.val)
+		if err != nil || delay <= 0 {
+			return this.parseError("invalid delay " + tok.val)
+		}
+		req.delay = delay
+		tok = nil
+	case tokenTypeSqlAt:
+		if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlValue {
+			return this.parseError("expected time")
+		}
+		at, err := time.Parse(time.RFC3339, tok.val)
+		if err != nil {
+			return this.parseError("invalid time " + tok.val + " expected RFC 3339 format")
+		}
+		req.at = at
+		tok = nil
+	}
+	return this.returningColumnsHelper(tok, req, &req.returningColumns)
 }
 
 func (this *parser) parseSqlInsertColumn() (request, tokenType, string) {
@@ -380,13 +545,22 @@ func (this *parser) parseSqlPeek() request {
 		req.front = false
 		tok = this.tokens.Produce()
 	}
-	if tok.typ != tokenTypeSqlStar {
-		if errreq := this.parseReturningColumns(&tok, &req.returningColumns); errreq != nil {
+	// count
+	if tok.typ == tokenTypeSqlValue {
+		if errreq := this.parseRecordCount(tok, &req.count); errreq != nil {
 			return errreq
 		}
-	} else {
 		tok = this.tokens.Produce()
 	}
+	switch tok.typ {
+	case tokenTypeSqlStar:
+		tok = this.tokens.Produce()
+	case tokenTypeSqlFrom:
+	default:
+		if errreq := this.parseReturningColumns(&tok, &req.returningColumns); errreq != nil {
+			return errreq
+		}
+	}
 	// from
 	if tok.typ != tokenTypeSqlFrom {
 		return this.parseError("expected from")
@@ -402,6 +576,16 @@ func (this *parser) parseSqlPeek() request {
 	return req
 }
 
+// Parses number of records to pop or peek.
+func (this *parser) parseRecordCount(tok *token, count *int) request {
+	n, err := strconv.ParseUint(tok.val, 10, 31)
+	if err != nil || n == 0 {
+		return this.parseError("invalid number of records " + tok.val)
+	}
+	*count = int(n)
+	return nil
+}
+
 // Parses sql pop statement and returns sqlPopRequest on success.
 func (this *parser) parseSqlPop() request {
 	req := newSqlPopRequest()
@@ -414,7 +598,13 @@ func (this *parser) parseSqlPop() request {
 		req.front = false
 		tok = this.tokens.Produce()
 	}
-
+	// count
+	if tok.typ == tokenTypeSqlValue {
+		if errreq := this.parseRecordCount(tok, &req.count); errreq != nil {
+			return errreq
+		}
+		tok = this.tokens.Produce()
+	}
 	switch tok.typ {
 	case tokenTypeSqlStar:
 		req.use = true
@@ -435,6 +625,18 @@ func (this *parser) parseSqlPop() request {
 		return errreq
 	}
 	tok = this.tokens.Produce()
+	if tok.typ == tokenTypeSqlWait {
+		// wait time
+		if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlValue {
+			return this.parseError("expected wait time")
+		}
+		wait, err := time.ParseDuration(tok.val)
+		if err != nil || wait <= 0 {
+			return this.parseError("invalid wait time " + tok.val)
+		}
+		req.wait = wait
+		tok = this.tokens.Produce()
+	}
 	if tok.typ != tokenTypeEOF {
 		return this.parseError("expected eof token")
 	}
@@ -526,6 +728,65 @@ func (this *parser) parseSqlDelete() request {
 	return this.returningColumnsHelper(tok, req, &req.returningColumns)
 }
 
+// TRIGGER sql statement
+
+// Parses sql create trigger statement and returns sqlCreateTriggerRequest on success.
+func (this *parser) parseSqlCreateTrigger() request {
+	if tok := this.tokens.Produce(); tok.typ != tokenTypeSqlTrigger {
+		return this.parseError("expected trigger")
+	}
+	req := new(sqlCreateTriggerRequest)
+	// name
+	tok := this.tokens.Produce()
+	if tok.typ != tokenTypeSqlTriggerName {
+		return this.parseError("expected trigger name")
+	}
+	req.name = tok.val
+	// after insert, update or delete
+	if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlAfter {
+		return this.parseError("expected after")
+	}
+	tok = this.tokens.Produce()
+	switch tok.typ {
+	case tokenTypeSqlInsert, tokenTypeSqlUpdate, tokenTypeSqlDelete:
+		req.action = tok.val
+	default:
+		return this.parseError("expected insert, update or delete")
+	}
+	// on table
+	if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlOn {
+		return this.parseError("expected on")
+	}
+	if errreq := this.parseTableName(&req.table); errreq != nil {
+		return errreq
+	}
+	// do statement
+	if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlDo {
+		return this.parseError("expected do")
+	}
+	if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlStatement {
+		return this.parseError("expected trigger statement")
+	}
+	if err := validateTriggerStatement(req.action, tok.val); len(err) > 0 {
+		return this.parseError("invalid trigger statement: " + err)
+	}
+	req.statement = tok.val
+	return this.parseEOF(req)
+}
+
+// Parses sql drop trigger statement and returns sqlDropTriggerRequest on success.
+func (this *parser) parseSqlDropTrigger() request {
+	if tok := this.tokens.Produce(); tok.typ != tokenTypeSqlTrigger {
+		return this.parseError("expected trigger")
+	}
+	tok := this.tokens.Produce()
+	if tok.typ != tokenTypeSqlTriggerName {
+		return this.parseError("expected trigger name")
+	}
+	req := &sqlDropTriggerRequest{name: tok.val}
+	return this.parseEOF(req)
+}
+
 // KEY sql statement
 
 // Parses sql key statement and returns sqlKeyRequest on success.
@@ -564,7 +825,10 @@ func (this *parser) parseSqlTag() request {
 func (this *parser) parseSqlSubscribe() request {
 	tok := this.tokens.Produce()
 	if tok.typ == tokenTypeSqlTopic {
-		return &sqlSubscribeTopicRequest { topic: tok.val }
+		return this.parseSqlSubscribeTopic()
+	}
+	if tok.typ == tokenTypeSqlSchema {
+		return this.parseEOF(new(sqlSubscribeSchemaRequest))
 	}
 	req := new(sqlSubscribeRequest)
 	// skip
@@ -573,11 +837,22 @@ func (this *parser) parseSqlSubscribe() request {
 		tok = this.tokens.Produce()
 	}
 
-	if tok.typ != tokenTypeSqlStar {
-		return this.parseError("expected * symbol")
+	// * or projected columns or aggregates
+	if tok.typ == tokenTypeSqlAggregate {
+		if errreq := this.parseSqlAggregates(&tok, req); errreq != nil {
+			return errreq
+		}
+	} else if tok.typ != tokenTypeSqlStar {
+		if tok.typ != tokenTypeSqlColumn {
+			return this.parseError("expected * symbol or column name")
+		}
+		if errreq := this.parseReturningColumns(&tok, &req.returningColumns); errreq != nil {
+			return errreq
+		}
+	} else {
+		tok = this.tokens.Produce()
 	}
 	// from
-	tok = this.tokens.Produce()
 	if tok.typ != tokenTypeSqlFrom {
 		return this.parseError("expected from")
 	}
@@ -585,17 +860,151 @@ func (this *parser) parseSqlSubscribe() request {
 	if errreq := this.parseTableName(&req.table); errreq != nil {
 		return errreq
 	}
-	// possible eof
+	// possible where
 	tok = this.tokens.Produce()
-	if tok.typ == tokenTypeEOF {
-		return req
+	if tok.typ == tokenTypeSqlWhere {
+		if errreq := this.parseSqlWherePredicate(&(req.filter), &tok); errreq != nil {
+			return errreq
+		}
 	}
-	// where
-	if errreq := this.parseSqlWhere(&(req.filter), tok); errreq != nil {
+	return this.parseSqlSubscribeOptions(req, tok)
+}
+
+// Parses options that follow subscribe where clause.
+func (this *parser) parseSqlSubscribeOptions(req *sqlSubscribeRequest, tok *token) request {
+	for {
+		switch tok.typ {
+		case tokenTypeEOF:
+			if req.limit > 0 && len(req.orderBy) == 0 {
+				return this.parseError("limit requires order by")
+			}
+			if len(req.durable) > 0 && (req.conflate || req.throttle > 0) {
+				return this.parseError("durable subscription can not be conflated or throttled")
+			}
+			if req.oldValues && req.conflate {
+				return this.parseError("conflated subscription can not include old values")
+			}
+			return req
+		case tokenTypeSqlFrom:
+			// from sequence
+			if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlSequence {
+				return this.parseError("expected sequence")
+			}
+			if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlValue {
+				return this.parseError("expected sequence number")
+			}
+			sequence, err := strconv.ParseUint(tok.val, 10, 64)
+			if err != nil {
+				return this.parseError("invalid sequence number " + tok.val)
+			}
+			req.resume = true
+			req.sequence = sequence
+		case tokenTypeSqlConflate:
+			req.conflate = true
+		case tokenTypeSqlThrottle:
+			// throttle interval
+			if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlValue {
+				return this.parseError("expected throttle interval")
+			}
+			interval, err := time.ParseDuration(tok.val)
+			if err != nil || interval <= 0 {
+				return this.parseError("invalid throttle interval " + tok.val)
+			}
+			req.throttle = interval
+		case tokenTypeSqlOrder:
+			// order by column [asc | desc]
+			if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlBy {
+				return this.parseError("expected by")
+			}
+			if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlColumn {
+				return this.parseError("expected order by column name")
+			}
+			req.orderBy = tok.val
+			tok = this.tokens.Produce()
+			if tok.typ == tokenTypeSqlAsc || tok.typ == tokenTypeSqlDesc {
+				req.desc = tok.typ == tokenTypeSqlDesc
+			} else {
+				continue
+			}
+		case tokenTypeSqlLimit:
+			if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlValue {
+				return this.parseError("expected limit")
+			}
+			limit, err := strconv.ParseUint(tok.val, 10, 32)
+			if err != nil || limit == 0 {
+				return this.parseError("invalid limit " + tok.val)
+			}
+			req.limit = int(limit)
+		case tokenTypeSqlDurable:
+			if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlDurableName {
+				return this.parseError("expected durable subscription name")
+			}
+			req.durable = tok.val
+		case tokenTypeSqlWith:
+			// with old values
+			if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlOld {
+				return this.parseError("expected old")
+			}
+			if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlValues {
+				return this.parseError("expected values")
+			}
+			req.oldValues = true
+		default:
+			return this.parseError("unexpected token " + tok.val)
+		}
+		tok = this.tokens.Produce()
+	}
+}
+
+// Parses comma separated aggregate functions leaving tok at the token that follows them.
+func (this *parser) parseSqlAggregates(tok **token, req *sqlSubscribeRequest) request {
+	for {
+		if (*tok).typ != tokenTypeSqlAggregate {
+			return this.parseError("expected aggregate function")
+		}
+		agg := &sqlAggregate{fn: (*tok).val}
+		if *tok = this.tokens.Produce(); (*tok).typ != tokenTypeSqlLeftParenthesis {
+			return this.parseError("expected (")
+		}
+		*tok = this.tokens.Produce()
+		switch (*tok).typ {
+		case tokenTypeSqlStar:
+			if agg.fn != "count" {
+				return this.parseError("* is only valid for count")
+			}
+		case tokenTypeSqlColumn:
+		default:
+			return this.parseError("expected column name")
+		}
+		agg.col = (*tok).val
+		if *tok = this.tokens.Produce(); (*tok).typ != tokenTypeSqlRightParenthesis {
+			return this.parseError("expected )")
+		}
+		req.aggregates = append(req.aggregates, agg)
+		if *tok = this.tokens.Produce(); (*tok).typ != tokenTypeSqlComma {
+			return nil
+		}
+		*tok = this.tokens.Produce()
+	}
+}
+
+func (this *parser) parseTopicName(topic *string) request {
+	tok := this.tokens.Produce()
+	if tok.typ != tokenTypeSqlTopicName {
+		return this.parseError("expected topic name")
+	}
+	*topic = tok.val
+	return nil
+}
+
+// Parses sql subscribe topic statement and returns sqlSubscribeTopicRequest on success.
+func (this *parser) parseSqlSubscribeTopic() request {
+	req := new(sqlSubscribeTopicRequest)
+	// topic name
+	if errreq := this.parseTopicName(&req.topic); errreq != nil {
 		return errreq
 	}
-	// we are good
-	return req
+	return this.parseEOF(req)
 }
 
 // UNSUBSCRIBE sql statement
@@ -604,6 +1013,12 @@ func (this *parser) parseSqlSubscribe() request {
 func (this *parser) parseSqlUnsubscribe() request {
 	// from
 	tok := this.tokens.Produce()
+	if tok.typ == tokenTypeSqlTopic {
+		return this.parseSqlUnsubscribeTopic()
+	}
+	if tok.typ == tokenTypeSqlSchema {
+		return this.parseEOF(new(sqlUnsubscribeSchemaRequest))
+	}
 	if tok.typ != tokenTypeSqlFrom {
 		return this.parseError("expected from")
 	}
@@ -625,6 +1040,191 @@ func (this *parser) parseSqlUnsubscribe() request {
 	return req
 }
 
+// Parses sql unsubscribe topic statement and returns sqlUnsubscribeTopicRequest on success.
+func (this *parser) parseSqlUnsubscribeTopic() request {
+	req := new(sqlUnsubscribeTopicRequest)
+	// topic name
+	if errreq := this.parseTopicName(&req.topic); errreq != nil {
+		return errreq
+	}
+	return this.parseEOF(req)
+}
+
+// RESERVE sql statement
+
+// Parses sql reserve statement and returns sqlReserveRequest on success.
+func (this *parser) parseSqlReserve() request {
+	req := new(sqlReserveRequest)
+	tok := this.tokens.Produce()
+	switch tok.typ {
+	case tokenTypeSqlFront:
+		req.front = true
+		tok = this.tokens.Produce()
+	case tokenTypeSqlBack:
+		tok = this.tokens.Produce()
+	}
+	// from
+	if tok.typ != tokenTypeSqlFrom {
+		return this.parseError("expected from")
+	}
+	// table name
+	if errreq := this.parseTableName(&req.table); errreq != nil {
+		return errreq
+	}
+	for tok = this.tokens.Produce(); tok.typ != tokenTypeEOF; tok = this.tokens.Produce() {
+		switch tok.typ {
+		case tokenTypeSqlTimeout:
+			if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlValue {
+				return this.parseError("expected timeout")
+			}
+			timeout, err := time.ParseDuration(tok.val)
+			if err != nil || timeout <= 0 {
+				return this.parseError("invalid timeout " + tok.val)
+			}
+			req.timeout = timeout
+		case tokenTypeSqlDeadLetter:
+			// deadletter table after attempts
+			if errreq := this.parseTableName(&req.deadLetter); errreq != nil {
+				return errreq
+			}
+			if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlAfter {
+				return this.parseError("expected after")
+			}
+			if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlValue {
+				return this.parseError("expected number of attempts")
+			}
+			attempts, err := strconv.ParseUint(tok.val, 10, 32)
+			if err != nil || attempts == 0 {
+				return this.parseError("invalid number of attempts " + tok.val)
+			}
+			req.attempts = int(attempts)
+		default:
+			return this.parseError("unexpected token " + tok.val)
+		}
+	}
+	if req.timeout == 0 {
+		return this.parseError("expected timeout")
+	}
+	if req.deadLetter == req.table {
+		return this.parseError("dead letter table must be different from " + req.table)
+	}
+	return req
+}
+
+// ACK sql statement
+
+// Parses sql ack statement for reserved record and returns sqlAckRecordRequest on success.
+func (this *parser) parseSqlAckRecord(tok *token) request {
+	req := new(sqlAckRecordRequest)
+	if errreq := this.parseRecordId(tok, &req.sqlRequest, &req.id); errreq != nil {
+		return errreq
+	}
+	return this.parseEOF(req)
+}
+
+// Parses sql nack statement and returns sqlNackRecordRequest on success.
+func (this *parser) parseSqlNack() request {
+	req := new(sqlNackRecordRequest)
+	if errreq := this.parseRecordId(this.tokens.Produce(), &req.sqlRequest, &req.id); errreq != nil {
+		return errreq
+	}
+	return this.parseEOF(req)
+}
+
+// Parses table name and record id of ack and nack statements.
+func (this *parser) parseRecordId(tok *token, req *sqlRequest, id *string) request {
+	if tok.typ != tokenTypeSqlTable {
+		return this.parseError("expected table name")
+	}
+	req.table = tok.val
+	if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlValue {
+		return this.parseError("expected record id")
+	}
+	*id = tok.val
+	return nil
+}
+
+// Parses sql ack statement and returns sqlAckRequest or sqlAckRecordRequest on success.
+func (this *parser) parseSqlAck() request {
+	tok := this.tokens.Produce()
+	if tok.typ != tokenTypeSqlDurable {
+		return this.parseSqlAckRecord(tok)
+	}
+	tok = this.tokens.Produce()
+	if tok.typ != tokenTypeSqlDurableName {
+		return this.parseError("expected durable subscription name")
+	}
+	req := &sqlAckRequest{durable: tok.val}
+	if tok = this.tokens.Produce(); tok.typ != tokenTypeSqlValue {
+		return this.parseError("expected delivery sequence")
+	}
+	delivery, err := strconv.ParseUint(tok.val, 10, 64)
+	if err != nil {
+		return this.parseError("invalid delivery sequence " + tok.val)
+	}
+	req.delivery = delivery
+	return this.parseEOF(req)
+}
+
+// SHOW SUBSCRIPTIONS statement
+
+// Parses show subscriptions statement and returns sqlShowSubscriptionsRequest on success.
+func (this *parser) parseSqlShowSubscriptions() request {
+	if tok := this.tokens.Produce(); tok.typ != tokenTypeSqlSubscriptions {
+		return this.parseError("expected subscriptions")
+	}
+	req := new(sqlShowSubscriptionsRequest)
+	tok := this.tokens.Produce()
+	switch tok.typ {
+	case tokenTypeEOF:
+		return req
+	case tokenTypeSqlFrom:
+		// table name
+		if errreq := this.parseTableName(&req.table); errreq != nil {
+			return errreq
+		}
+		return this.parseEOF(req)
+	}
+	return this.parseError("expected from or EOF")
+}
+
+// KILL SUBSCRIPTION statement
+
+// Parses kill subscription statement and returns sqlKillSubscriptionRequest on success.
+func (this *parser) parseSqlKillSubscription() request {
+	if tok := this.tokens.Produce(); tok.typ != tokenTypeSqlSubscription {
+		return this.parseError("expected subscription")
+	}
+	tok := this.tokens.Produce()
+	if tok.typ != tokenTypeSqlValue {
+		return this.parseError("expected pubsubid")
+	}
+	pubsubid, err := strconv.ParseUint(tok.val, 10, 64)
+	if err != nil {
+		return this.parseError("invalid pubsubid " + tok.val)
+	}
+	req := &sqlKillSubscriptionRequest{pubsubid: pubsubid}
+	return this.parseEOF(req)
+}
+
+// PUBLISH sql statement
+
+// Parses sql publish statement and returns sqlPublishRequest on success.
+func (this *parser) parseSqlPublish() request {
+	req := new(sqlPublishRequest)
+	// topic name
+	if errreq := this.parseTopicName(&req.topic); errreq != nil {
+		return errreq
+	}
+	// message
+	tok := this.tokens.Produce()
+	if tok.typ != tokenTypeSqlValue {
+		return this.parseError("expected message")
+	}
+	req.message = tok.val
+	return this.parseEOF(req)
+}
+
 // Runs the parser.
 func (this *parser) run() request {
 	tok := this.tokens.Produce()
@@ -650,6 +1250,22 @@ func (this *parser) run() request {
 		return this.parseSqlSubscribe()
 	case tokenTypeSqlUnsubscribe:
 		return this.parseSqlUnsubscribe()
+	case tokenTypeSqlPublish:
+		return this.parseSqlPublish()
+	case tokenTypeSqlDrop:
+		return this.parseSqlDropTrigger()
+	case tokenTypeSqlCreate:
+		return this.parseSqlCreateTrigger()
+	case tokenTypeSqlShow:
+		return this.parseSqlShowSubscriptions()
+	case tokenTypeSqlKill:
+		return this.parseSqlKillSubscription()
+	case tokenTypeSqlAck:
+		return this.parseSqlAck()
+	case tokenTypeSqlNack:
+		return this.parseSqlNack()
+	case tokenTypeSqlReserve:
+		return this.parseSqlReserve()
 	case tokenTypeSqlKey:
 		return this.parseSqlKey()
 	case tokenTypeSqlTag:
@@ -660,6 +1276,14 @@ func (this *parser) run() request {
 		return this.parseCmdStop()
 	case tokenTypeCmdClose:
 		return this.parseCmdClose()
+	case tokenTypeCmdSnapshot:
+		return this.parseCmdSnapshot()
+	case tokenTypeCmdBackup:
+		return this.parseCmdBackup()
+	case tokenTypeCmdRestore:
+		return this.parseCmdRestore()
+	case tokenTypeCmdPolicy:
+		return this.parseCmdPolicy()
 	case tokenTypeCmdMysql:
 		return this.parseCmdMysql()
 	}
@@ -16,7 +16,10 @@
 
 package server
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func expectedError(t *testing.T, a request) {
 	switch a.(type) {
@@ -70,6 +73,46 @@ func TestParseCmdStop(t *testing.T) {
 	validateStop(t, req)
 }
 
+// SNAPSHOT
+func TestParseCmdSnapshot(t *testing.T) {
+	pc := newTokens()
+	lex(" snapshot ", pc)
+	if _, ok := parse(pc).(*cmdSnapshotRequest); !ok {
+		t.Errorf("parse error: invalid request type expected cmdSnapshotRequest")
+	}
+}
+
+// BACKUP
+func TestParseCmdBackup(t *testing.T) {
+	pc := newTokens()
+	lex(" backup ", pc)
+	if _, ok := parse(pc).(*cmdBackupRequest); !ok {
+		t.Errorf("parse error: invalid request type expected cmdBackupRequest")
+	}
+}
+
+// RESTORE
+func TestParseCmdRestore(t *testing.T) {
+	pc := newTokens()
+	lex(` restore {"table":"stocks","columns":["ticker"],"keys":["ticker"],"records":[{"id":0,"vals":["IBM"]}]} `, pc)
+	req, ok := parse(pc).(*cmdRestoreRequest)
+	if !ok {
+		t.Fatalf("parse error: invalid request type expected cmdRestoreRequest")
+	}
+	ASSERT_TRUE(t, req.snap.Table == "stocks", "table")
+	ASSERT_TRUE(t, len(req.snap.Records) == 1 && req.snap.Records[0].Vals[0] == "IBM", "records")
+	//
+	pc = newTokens()
+	lex(" restore ", pc)
+	expectedError(t, parse(pc))
+	pc = newTokens()
+	lex(` restore {"table":"stocks" `, pc)
+	expectedError(t, parse(pc))
+	pc = newTokens()
+	lex(` restore {"table":"../stocks"} `, pc)
+	expectedError(t, parse(pc))
+}
+
 // CLOSE
 func validateClose(t *testing.T, req request) {
 	switch req.(type) {
@@ -91,6 +134,61 @@ func TestParseCmdClose(t *testing.T) {
 	validateClose(t, req)
 }
 
+// POLICY
+func validatePolicy(t *testing.T, a request, policy slowConsumerPolicy, timeout time.Duration) {
+	switch a.(type) {
+	case *errorRequest:
+		e := a.(*errorRequest)
+		t.Errorf("parse error: " + e.err)
+
+	case *cmdPolicyRequest:
+		x := a.(*cmdPolicyRequest)
+		if x.policy != policy {
+			t.Errorf("parse error: policy do not match")
+		}
+		if x.timeout != timeout {
+			t.Errorf("parse error: timeout do not match")
+		}
+
+	default:
+		t.Errorf("parse error: invalid request type expected cmdPolicyRequest")
+	}
+}
+
+func TestParseCmdPolicy(t *testing.T) {
+	pc := newTokens()
+	lex(" policy disconnect ", pc)
+	validatePolicy(t, parse(pc), slowConsumerDisconnect, 0)
+	//
+	pc = newTokens()
+	lex(" policy block 250 ", pc)
+	validatePolicy(t, parse(pc), slowConsumerBlock, 250*time.Millisecond)
+	//
+	pc = newTokens()
+	lex(" policy drop oldest ", pc)
+	validatePolicy(t, parse(pc), slowConsumerDropOldest, 0)
+	//
+	pc = newTokens()
+	lex(" policy drop newest ", pc)
+	validatePolicy(t, parse(pc), slowConsumerDropNewest, 0)
+	//
+	pc = newTokens()
+	lex(" policy spill ", pc)
+	validatePolicy(t, parse(pc), slowConsumerSpill, 0)
+	//
+	pc = newTokens()
+	lex(" policy block ", pc)
+	expectedError(t, parse(pc))
+	//
+	pc = newTokens()
+	lex(" policy drop ", pc)
+	expectedError(t, parse(pc))
+	//
+	pc = newTokens()
+	lex(" policy spill now ", pc)
+	expectedError(t, parse(pc))
+}
+
 // INSERT
 
 func validateReturningColumns(t *testing.T, x *returningColumns, y *returningColumns) {
@@ -135,6 +233,9 @@ func validateInsert(t *testing.T, a request, y *sqlInsertRequest) {
 			}
 		}
 		validateReturningColumns(t, &x.returningColumns, &y.returningColumns)
+		if x.ephemeral != y.ephemeral {
+			t.Errorf("parse error: ephemeral does not match")
+		}
 	default:
 		t.Errorf("parse error: invalid request type expected sqlInsertRequest")
 	}
@@ -179,6 +280,18 @@ func TestParseSqlInsertStatement3(t *testing.T) {
 	validateInsert(t, x, &y)
 }
 
+func TestParseSqlInsertEphemeral(t *testing.T) {
+	pc := newTokens()
+	lex(" insert ephemeral into users (name, status) values (john, online) ", pc)
+	x := parse(pc)
+	var y sqlInsertRequest
+	y.table = "users"
+	y.addColVal("name", "john")
+	y.addColVal("status", "online")
+	y.ephemeral = true
+	validateInsert(t, x, &y)
+}
+
 func TestParseSqlInsertStatement4(t *testing.T) {
 	pc := newTokens()
 	lex(" insert ", pc)
@@ -626,6 +739,211 @@ func TestParseSqlSubscribeStatement4(t *testing.T) {
 	expectedError(t, x)
 }
 
+func TestParseSqlSubscribeColumns(t *testing.T) {
+	pc := newTokens()
+	lex(" subscribe ticker, bid from stocks where ticker = 'IBM'", pc)
+	x := parse(pc)
+	var y sqlSubscribeRequest
+	y.table = "stocks"
+	y.filter.addFilter("ticker", "IBM")
+	validateSubscribe(t, x, &y, false)
+	req, ok := x.(*sqlSubscribeRequest)
+	ASSERT_TRUE(t, ok && req.useColumns(), "parse error: expected projected columns")
+	ASSERT_TRUE(t, ok && len(req.cols) == 2 && req.cols[0] == "ticker" && req.cols[1] == "bid", "parse error: columns do not match")
+	//
+	pc = newTokens()
+	lex(" subscribe * from stocks", pc)
+	x = parse(pc)
+	req, ok = x.(*sqlSubscribeRequest)
+	ASSERT_TRUE(t, ok && !req.useColumns(), "parse error: expected all columns")
+	//
+	pc = newTokens()
+	lex(" subscribe ticker, from stocks", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+func TestParseSqlSubscribeFromSequence(t *testing.T) {
+	pc := newTokens()
+	lex(" subscribe * from stocks from sequence 12345", pc)
+	x := parse(pc)
+	var y sqlSubscribeRequest
+	y.table = "stocks"
+	validateSubscribe(t, x, &y, false)
+	req, ok := x.(*sqlSubscribeRequest)
+	ASSERT_TRUE(t, ok && req.resume && req.sequence == 12345, "parse error: sequence does not match")
+	//
+	pc = newTokens()
+	lex(" subscribe * from stocks where ticker = IBM from sequence 0", pc)
+	x = parse(pc)
+	y.filter.addFilter("ticker", "IBM")
+	validateSubscribe(t, x, &y, false)
+	req, ok = x.(*sqlSubscribeRequest)
+	ASSERT_TRUE(t, ok && req.resume && req.sequence == 0, "parse error: sequence does not match")
+	//
+	pc = newTokens()
+	lex(" subscribe * from stocks from sequence abc", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" subscribe * from stocks from 10", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+func TestParseSqlSubscribeConflate(t *testing.T) {
+	pc := newTokens()
+	lex(" subscribe * from stocks where ticker = IBM conflate", pc)
+	x := parse(pc)
+	var y sqlSubscribeRequest
+	y.table = "stocks"
+	y.filter.addFilter("ticker", "IBM")
+	validateSubscribe(t, x, &y, false)
+	req, ok := x.(*sqlSubscribeRequest)
+	ASSERT_TRUE(t, ok && req.conflate && !req.resume, "parse error: conflate does not match")
+	//
+	pc = newTokens()
+	lex(" subscribe * from stocks from sequence 10 conflate", pc)
+	x = parse(pc)
+	req, ok = x.(*sqlSubscribeRequest)
+	ASSERT_TRUE(t, ok && req.conflate && req.resume, "parse error: conflate does not match")
+	//
+	pc = newTokens()
+	lex(" subscribe * from stocks conflate now", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+func TestParseSqlSubscribeThrottle(t *testing.T) {
+	pc := newTokens()
+	lex(" subscribe * from stocks where ticker = IBM throttle 200ms", pc)
+	x := parse(pc)
+	var y sqlSubscribeRequest
+	y.table = "stocks"
+	y.filter.addFilter("ticker", "IBM")
+	validateSubscribe(t, x, &y, false)
+	req, ok := x.(*sqlSubscribeRequest)
+	ASSERT_TRUE(t, ok && req.throttle == 200*time.Millisecond, "parse error: throttle does not match")
+	//
+	pc = newTokens()
+	lex(" subscribe * from stocks throttle 1s conflate", pc)
+	x = parse(pc)
+	req, ok = x.(*sqlSubscribeRequest)
+	ASSERT_TRUE(t, ok && req.throttle == time.Second && req.conflate, "parse error: throttle does not match")
+	//
+	pc = newTokens()
+	lex(" subscribe * from stocks throttle 200", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" subscribe * from stocks throttle", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+func TestParseSqlSubscribeAggregates(t *testing.T) {
+	pc := newTokens()
+	lex(" subscribe count(*), sum(amount), avg(amount) from orders where status = open throttle 1s", pc)
+	x := parse(pc)
+	req, ok := x.(*sqlSubscribeRequest)
+	if !ok {
+		t.Errorf("parse error: invalid request type expected sqlSubscribeRequest")
+		return
+	}
+	ASSERT_TRUE(t, len(req.aggregates) == 3, "parse error: expected 3 aggregates")
+	ASSERT_TRUE(t, req.aggregates[0].fn == "count" && req.aggregates[0].col == "*", "parse error: count(*) does not match")
+	ASSERT_TRUE(t, req.aggregates[1].fn == "sum" && req.aggregates[1].col == "amount", "parse error: sum(amount) does not match")
+	ASSERT_TRUE(t, req.aggregates[2].fn == "avg" && req.aggregates[2].col == "amount", "parse error: avg(amount) does not match")
+	ASSERT_TRUE(t, req.filter.col == "status" && req.filter.val == "open", "parse error: filter does not match")
+	ASSERT_TRUE(t, req.throttle == time.Second, "parse error: throttle does not match")
+	//
+	pc = newTokens()
+	lex(" subscribe sum(*) from orders", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" subscribe count(*), amount from orders", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" subscribe count(amount from orders", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+func TestParseSqlSubscribeOrderBy(t *testing.T) {
+	pc := newTokens()
+	lex(" subscribe * from scores order by points desc limit 10", pc)
+	x := parse(pc)
+	req, ok := x.(*sqlSubscribeRequest)
+	ASSERT_TRUE(t, ok && req.orderBy == "points" && req.desc && req.limit == 10, "parse error: order by does not match")
+	//
+	pc = newTokens()
+	lex(" subscribe * from scores order by points limit 3 throttle 1s", pc)
+	x = parse(pc)
+	req, ok = x.(*sqlSubscribeRequest)
+	ASSERT_TRUE(t, ok && req.orderBy == "points" && !req.desc && req.limit == 3 && req.throttle == time.Second, "parse error: order by does not match")
+	//
+	pc = newTokens()
+	lex(" subscribe * from scores limit 10", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" subscribe * from scores order by points limit 0", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" subscribe * from scores order points", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+func TestParseSqlSubscribePredicate(t *testing.T) {
+	pc := newTokens()
+	lex(" subscribe * from orders where status = 'open' and amount > 1000", pc)
+	x := parse(pc)
+	switch x.(type) {
+	case *sqlSubscribeRequest:
+		y := x.(*sqlSubscribeRequest)
+		ASSERT_TRUE(t, y.table == "orders", "parse error: table names do not match")
+		ASSERT_TRUE(t, y.filter.col == "" && y.filter.predicate != nil, "parse error: expected predicate filter")
+		conds := y.filter.predicate.conditions
+		ASSERT_TRUE(t, len(conds) == 2, "parse error: expected 2 conditions")
+		ASSERT_TRUE(t, *conds[0] == sqlCondition{col: "status", op: "=", val: "open"}, "parse error: first condition does not match")
+		ASSERT_TRUE(t, *conds[1] == sqlCondition{col: "amount", op: ">", val: "1000"}, "parse error: second condition does not match")
+	default:
+		t.Errorf("parse error: invalid request type expected sqlSubscribeRequest")
+	}
+	// single non equal condition
+	pc = newTokens()
+	lex(" subscribe skip * from orders where amount >= 1000", pc)
+	x = parse(pc)
+	switch x.(type) {
+	case *sqlSubscribeRequest:
+		y := x.(*sqlSubscribeRequest)
+		ASSERT_TRUE(t, y.skip, "parse error: skip do not match")
+		ASSERT_TRUE(t, y.filter.predicate != nil && len(y.filter.predicate.conditions) == 1, "parse error: expected predicate filter")
+	default:
+		t.Errorf("parse error: invalid request type expected sqlSubscribeRequest")
+	}
+	//
+	pc = newTokens()
+	lex(" subscribe * from orders where amount > 1000 and", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" subscribe * from orders where amount ! 1000", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
 // SUBSCRIBE TOPIC
 func validateSubscribeTopic(t *testing.T, a request, y *sqlSubscribeTopicRequest) {
 	switch a.(type) {
@@ -648,11 +966,328 @@ func validateSubscribeTopic(t *testing.T, a request, y *sqlSubscribeTopicRequest
 
 func TestParseSqlSubscribeTopic(t *testing.T) {
 	pc := newTokens()
-	lex(" subscribe topic1 ", pc)
+	lex(" subscribe topic topic1 ", pc)
 	x := parse(pc)
 	var y sqlSubscribeTopicRequest
 	y.topic = "topic1"
 	validateSubscribeTopic(t, x, &y)
+	//
+	pc = newTokens()
+	lex(" subscribe topic ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+// UNSUBSCRIBE TOPIC
+func TestParseSqlUnsubscribeTopic(t *testing.T) {
+	pc := newTokens()
+	lex(" unsubscribe topic topic1 ", pc)
+	x := parse(pc)
+	switch x.(type) {
+	case *sqlUnsubscribeTopicRequest:
+		if x.(*sqlUnsubscribeTopicRequest).topic != "topic1" {
+			t.Errorf("parse error: topic names do not match")
+		}
+	default:
+		t.Errorf("parse error: invalid request type expected sqlUnsubscribeTopicRequest")
+	}
+}
+
+// SCHEMA
+func TestParseSqlSubscribeSchema(t *testing.T) {
+	pc := newTokens()
+	lex(" subscribe schema ", pc)
+	x := parse(pc)
+	if _, ok := x.(*sqlSubscribeSchemaRequest); !ok {
+		t.Errorf("parse error: invalid request type expected sqlSubscribeSchemaRequest")
+	}
+	//
+	pc = newTokens()
+	lex(" unsubscribe schema ", pc)
+	x = parse(pc)
+	if _, ok := x.(*sqlUnsubscribeSchemaRequest); !ok {
+		t.Errorf("parse error: invalid request type expected sqlUnsubscribeSchemaRequest")
+	}
+	//
+	pc = newTokens()
+	lex(" subscribe schema stocks ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+// ACK
+func TestParseSqlAck(t *testing.T) {
+	pc := newTokens()
+	lex(" ack durable worker 12 ", pc)
+	x := parse(pc)
+	switch x.(type) {
+	case *sqlAckRequest:
+		req := x.(*sqlAckRequest)
+		if req.durable != "worker" || req.delivery != 12 {
+			t.Errorf("parse error: durable name or delivery do not match")
+		}
+	default:
+		t.Errorf("parse error: invalid request type expected sqlAckRequest")
+	}
+	//
+	pc = newTokens()
+	lex(" ack durable worker ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+func TestParseSqlAckRecord(t *testing.T) {
+	pc := newTokens()
+	lex(" ack jobs 12 ", pc)
+	x := parse(pc)
+	switch x.(type) {
+	case *sqlAckRecordRequest:
+		req := x.(*sqlAckRecordRequest)
+		if req.table != "jobs" || req.id != "12" {
+			t.Errorf("parse error: table or record id do not match")
+		}
+	default:
+		t.Errorf("parse error: invalid request type expected sqlAckRecordRequest")
+	}
+	//
+	pc = newTokens()
+	lex(" nack jobs 12 ", pc)
+	x = parse(pc)
+	switch x.(type) {
+	case *sqlNackRecordRequest:
+		req := x.(*sqlNackRecordRequest)
+		if req.table != "jobs" || req.id != "12" {
+			t.Errorf("parse error: table or record id do not match")
+		}
+	default:
+		t.Errorf("parse error: invalid request type expected sqlNackRecordRequest")
+	}
+	//
+	pc = newTokens()
+	lex(" nack jobs ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+func TestParseSqlReserve(t *testing.T) {
+	pc := newTokens()
+	lex(" reserve front from jobs timeout 60s deadletter failed after 3 ", pc)
+	x := parse(pc)
+	switch x.(type) {
+	case *sqlReserveRequest:
+		req := x.(*sqlReserveRequest)
+		if req.table != "jobs" || !req.front || req.timeout != 60*time.Second {
+			t.Errorf("parse error: table, front or timeout do not match")
+		}
+		if req.deadLetter != "failed" || req.attempts != 3 {
+			t.Errorf("parse error: dead letter table or attempts do not match")
+		}
+	default:
+		t.Errorf("parse error: invalid request type expected sqlReserveRequest")
+	}
+	// timeout is required
+	pc = newTokens()
+	lex(" reserve front from jobs ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" reserve back from jobs timeout 60s deadletter jobs after 3 ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" reserve back from jobs timeout 60s deadletter failed after 0 ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+func TestParseSqlCreateTrigger(t *testing.T) {
+	pc := newTokens()
+	lex(" create trigger audit after insert on trades do insert into audit (sym) values (new.sym) ", pc)
+	x := parse(pc)
+	switch x.(type) {
+	case *sqlCreateTriggerRequest:
+		req := x.(*sqlCreateTriggerRequest)
+		if req.name != "audit" || req.action != "insert" || req.table != "trades" {
+			t.Errorf("parse error: name, action or table do not match")
+		}
+		if req.statement != "insert into audit (sym) values (new.sym)" {
+			t.Errorf("parse error: statement does not match")
+		}
+	default:
+		t.Errorf("parse error: invalid request type expected sqlCreateTriggerRequest")
+	}
+	// old values are not available after insert
+	pc = newTokens()
+	lex(" create trigger audit after insert on trades do insert into audit (sym) values (old.sym) ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	// new values are not available after delete
+	pc = newTokens()
+	lex(" create trigger audit after delete on trades do delete from positions where sym = new.sym ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" create trigger audit after insert on trades do select * from positions ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" create trigger audit after insert on trades do ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+func TestParseSqlDropTrigger(t *testing.T) {
+	pc := newTokens()
+	lex(" drop trigger audit ", pc)
+	x := parse(pc)
+	switch x.(type) {
+	case *sqlDropTriggerRequest:
+		if x.(*sqlDropTriggerRequest).name != "audit" {
+			t.Errorf("parse error: trigger name does not match")
+		}
+	default:
+		t.Errorf("parse error: invalid request type expected sqlDropTriggerRequest")
+	}
+	//
+	pc = newTokens()
+	lex(" drop table stocks ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" drop trigger audit now ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+func TestParseSqlSubscribeWithOldValues(t *testing.T) {
+	pc := newTokens()
+	lex(" subscribe * from trades where sym = IBM with old values ", pc)
+	x := parse(pc)
+	switch x.(type) {
+	case *sqlSubscribeRequest:
+		if !x.(*sqlSubscribeRequest).oldValues {
+			t.Errorf("parse error: expected old values")
+		}
+	default:
+		t.Errorf("parse error: invalid request type expected sqlSubscribeRequest")
+	}
+	//
+	pc = newTokens()
+	lex(" subscribe * from trades with old ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" subscribe * from trades conflate with old values ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+func TestParseSqlSubscribeDurable(t *testing.T) {
+	pc := newTokens()
+	lex(" subscribe * from jobs where name = job1 durable worker ", pc)
+	x := parse(pc)
+	switch x.(type) {
+	case *sqlSubscribeRequest:
+		if x.(*sqlSubscribeRequest).durable != "worker" {
+			t.Errorf("parse error: durable names do not match")
+		}
+	default:
+		t.Errorf("parse error: invalid request type expected sqlSubscribeRequest")
+	}
+	//
+	pc = newTokens()
+	lex(" subscribe * from jobs durable worker conflate ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+// SHOW SUBSCRIPTIONS
+func TestParseSqlShowSubscriptions(t *testing.T) {
+	pc := newTokens()
+	lex(" show subscriptions ", pc)
+	x := parse(pc)
+	if _, ok := x.(*sqlShowSubscriptionsRequest); !ok || x.getTableName() != "" {
+		t.Errorf("parse error: invalid request expected sqlShowSubscriptionsRequest without table")
+	}
+	//
+	pc = newTokens()
+	lex(" show subscriptions from stocks ", pc)
+	x = parse(pc)
+	if _, ok := x.(*sqlShowSubscriptionsRequest); !ok || x.getTableName() != "stocks" {
+		t.Errorf("parse error: invalid request expected sqlShowSubscriptionsRequest for stocks")
+	}
+	//
+	pc = newTokens()
+	lex(" show subscriptions stocks ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+// KILL SUBSCRIPTION
+func TestParseSqlKillSubscription(t *testing.T) {
+	pc := newTokens()
+	lex(" kill subscription 12 ", pc)
+	x := parse(pc)
+	switch x.(type) {
+	case *sqlKillSubscriptionRequest:
+		if x.(*sqlKillSubscriptionRequest).pubsubid != 12 {
+			t.Errorf("parse error: pubsubid do not match")
+		}
+	default:
+		t.Errorf("parse error: invalid request type expected sqlKillSubscriptionRequest")
+	}
+	//
+	pc = newTokens()
+	lex(" kill subscription abc ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" kill subscription ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+// PUBLISH
+func validatePublish(t *testing.T, a request, y *sqlPublishRequest) {
+	switch a.(type) {
+	case *errorRequest:
+		e := a.(*errorRequest)
+		t.Errorf("parse error: " + e.err)
+
+	case *sqlPublishRequest:
+		x := a.(*sqlPublishRequest)
+		if x.topic != y.topic {
+			t.Errorf("parse error: topic names do not match " + x.topic)
+		}
+		if x.message != y.message {
+			t.Errorf("parse error: messages do not match " + x.message)
+		}
+
+	default:
+		t.Errorf("parse error: invalid request type expected sqlPublishRequest")
+	}
+}
+
+func TestParseSqlPublish(t *testing.T) {
+	pc := newTokens()
+	lex(" publish topic1 'hello world' ", pc)
+	x := parse(pc)
+	var y sqlPublishRequest
+	y.topic = "topic1"
+	y.message = "hello world"
+	validatePublish(t, x, &y)
+	//
+	pc = newTokens()
+	lex(" publish topic1 ", pc)
+	x = parse(pc)
+	expectedError(t, x)
 }
 
 // UNSUBSCRIBE
@@ -836,6 +1471,12 @@ func validatePush(t *testing.T, a request, y *sqlPushRequest) {
 		if x.front != y.front {
 			t.Error("front does not match")
 		}
+		if x.delay != y.delay || !x.at.Equal(y.at) {
+			t.Error("delay or at do not match")
+		}
+		if x.priority != y.priority {
+			t.Error("priority does not match")
+		}
 	default:
 		t.Errorf("invalid request expected sqlPushRequest")
 		return
@@ -906,6 +1547,57 @@ func TestParseSqlPushStatement5(t *testing.T) {
 	validatePush(t, x, &y)
 }
 
+func TestParseSqlPushStatement6(t *testing.T) {
+	pc := newTokens()
+	lex(" push back into jobs (name) values (job1) delay 5m returning * ", pc)
+	x := parse(pc)
+	var y sqlPushRequest
+	y.table = "jobs"
+	y.sqlInsertRequest.addColVal("name", "job1")
+	y.delay = 5 * time.Minute
+	y.use = true
+	validatePush(t, x, &y)
+	//
+	pc = newTokens()
+	lex(" push into jobs (name) values (job1) at '2026-11-01T00:00:00Z' ", pc)
+	x = parse(pc)
+	y.delay = 0
+	y.at = time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	y.use = false
+	validatePush(t, x, &y)
+	//
+	pc = newTokens()
+	lex(" push into jobs (name) values (job1) at tomorrow ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" insert into jobs (name) values (job1) delay 5m ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+func TestParseSqlPushStatement7(t *testing.T) {
+	pc := newTokens()
+	lex(" push into jobs priority 5 (name) values (job1) ", pc)
+	x := parse(pc)
+	var y sqlPushRequest
+	y.table = "jobs"
+	y.sqlInsertRequest.addColVal("name", "job1")
+	y.priority = 5
+	validatePush(t, x, &y)
+	//
+	pc = newTokens()
+	lex(" push into jobs priority 0 (name) values (job1) ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" push into jobs priority high (name) values (job1) ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
 // POP
 
 func validatePop(t *testing.T, a request, y *sqlPopRequest) {
@@ -919,6 +1611,12 @@ func validatePop(t *testing.T, a request, y *sqlPopRequest) {
 		if x.front != y.front {
 			t.Error("front does not match")
 		}
+		if x.wait != y.wait {
+			t.Error("wait does not match")
+		}
+		if x.count != y.count {
+			t.Error("count does not match")
+		}
 	default:
 		t.Errorf("invalid request expected sqlPopRequest")
 		return
@@ -1003,6 +1701,45 @@ func TestParseSqlPopStatement7(t *testing.T) {
 	validatePop(t, x, &y)
 }
 
+func TestParseSqlPopStatement8(t *testing.T) {
+	pc := newTokens()
+	lex(" pop front from jobs wait 30s ", pc)
+	x := parse(pc)
+	var y sqlPopRequest
+	y.table = "jobs"
+	y.front = true
+	y.wait = 30 * time.Second
+	validatePop(t, x, &y)
+	//
+	pc = newTokens()
+	lex(" pop front from jobs wait forever ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+	//
+	pc = newTokens()
+	lex(" select * from jobs wait 30s ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
+
+func TestParseSqlPopStatement9(t *testing.T) {
+	pc := newTokens()
+	lex(" pop front 50 from jobs ", pc)
+	x := parse(pc)
+	var y sqlPopRequest
+	y.table = "jobs"
+	y.front = true
+	y.count = 50
+	validatePop(t, x, &y)
+	//
+	pc = newTokens()
+	lex(" pop front 50 ticker from jobs wait 5s ", pc)
+	x = parse(pc)
+	y.wait = 5 * time.Second
+	y.sqlSelectRequest.addColumn("ticker")
+	validatePop(t, x, &y)
+}
+
 // PEEK
 
 func validatePeek(t *testing.T, a request, y *sqlPeekRequest) {
@@ -1016,6 +1753,9 @@ func validatePeek(t *testing.T, a request, y *sqlPeekRequest) {
 		if x.front != y.front {
 			t.Error("front does not match")
 		}
+		if x.count != y.count {
+			t.Error("count does not match")
+		}
 	default:
 		t.Errorf("invalid request expected sqlPeekRequest")
 		return
@@ -1086,3 +1826,18 @@ func TestParseSqlPeekStatement6(t *testing.T) {
 	y.sqlSelectRequest.addColumn("ask")
 	validatePeek(t, x, &y)
 }
+
+func TestParseSqlPeekStatement7(t *testing.T) {
+	pc := newTokens()
+	lex(" peek back 20 from events ", pc)
+	x := parse(pc)
+	var y sqlPeekRequest
+	y.table = "events"
+	y.count = 20
+	validatePeek(t, x, &y)
+	//
+	pc = newTokens()
+	lex(" peek back 0 from events ", pc)
+	x = parse(pc)
+	expectedError(t, x)
+}
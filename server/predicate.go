@@ -0,0 +1,82 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"strconv"
+	"strings"
+)
+
+// condition is a where clause comparison bound to the table column.
+type condition struct {
+	col *column
+	op  string
+	val string
+}
+
+// Compares two values numerically when both are numbers, otherwise as strings.
+func compareValues(a string, b string) int {
+	x, errx := strconv.ParseFloat(a, 64)
+	y, erry := strconv.ParseFloat(b, 64)
+	if errx != nil || erry != nil {
+		return strings.Compare(a, b)
+	}
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// Returns true when record value satisfies the condition.
+func (this *condition) match(rec *record) bool {
+	c := compareValues(rec.getValue(this.col.ordinal), this.val)
+	switch this.op {
+	case "=":
+		return c == 0
+	case "!=", "<>":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// predicatePubsub delivers record changes to a subscription with arbitrary where clause.
+// Records enter and leave the result set as they are inserted, updated and deleted.
+type predicatePubsub struct {
+	pubsub
+	conditions []condition
+}
+
+// Returns true when record satisfies all conditions.
+func (this *predicatePubsub) match(rec *record) bool {
+	for idx := range this.conditions {
+		if !this.conditions[idx].match(rec) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import "container/heap"
+
+// priorityHeap is a max heap of records pushed with priority.
+// Records with the same priority are ordered by id so that the oldest record comes first.
+type priorityHeap []*record
+
+func (this priorityHeap) Len() int {
+	return len(this)
+}
+
+func (this priorityHeap) Less(i, j int) bool {
+	return this.less(this[i], this[j])
+}
+
+// Determines if record a is popped before record b.
+func (this priorityHeap) less(a *record, b *record) bool {
+	if a.priority == b.priority {
+		return a.heapId < b.heapId
+	}
+	return a.priority > b.priority
+}
+
+func (this priorityHeap) Swap(i, j int) {
+	this[i], this[j] = this[j], this[i]
+	this[i].heapIdx = i
+	this[j].heapIdx = j
+}
+
+func (this *priorityHeap) Push(x interface{}) {
+	rec := x.(*record)
+	rec.heapIdx = len(*this)
+	rec.heapId = rec.id()
+	*this = append(*this, rec)
+}
+
+func (this *priorityHeap) Pop() interface{} {
+	old := *this
+	n := len(old)
+	rec := old[n-1]
+	old[n-1] = nil
+	rec.heapIdx = -1
+	*this = old[:n-1]
+	return rec
+}
+
+// Adds record pushed with priority.
+func (this *priorityHeap) add(rec *record) {
+	heap.Push(this, rec)
+}
+
+// Removes record from the heap.
+func (this *priorityHeap) remove(rec *record) {
+	if rec.heapIdx >= 0 && rec.heapIdx < len(*this) && (*this)[rec.heapIdx] == rec {
+		heap.Remove(this, rec.heapIdx)
+	}
+}
+
+// Returns record with the highest priority, nil when the heap is empty.
+func (this priorityHeap) top() *record {
+	if len(this) == 0 {
+		return nil
+	}
+	return this[0]
+}
+
+// Returns up to count records with the highest priority in the order they are popped.
+// Heap is walked from the top without being modified, only children of returned records are considered.
+func (this priorityHeap) first(count int) []*record {
+	records := make([]*record, 0, count)
+	if len(this) == 0 {
+		return records
+	}
+	frontier := &priorityFrontier{records: this, indexes: []int{0}}
+	for len(records) < count && frontier.Len() > 0 {
+		idx := heap.Pop(frontier).(int)
+		records = append(records, this[idx])
+		for child := 2*idx + 1; child <= 2*idx+2 && child < len(this); child++ {
+			heap.Push(frontier, child)
+		}
+	}
+	return records
+}
+
+// priorityFrontier is a heap of priority heap indexes of records that can be returned next.
+type priorityFrontier struct {
+	records priorityHeap
+	indexes []int
+}
+
+func (this *priorityFrontier) Len() int {
+	return len(this.indexes)
+}
+
+func (this *priorityFrontier) Less(i, j int) bool {
+	return this.records.less(this.records[this.indexes[i]], this.records[this.indexes[j]])
+}
+
+func (this *priorityFrontier) Swap(i, j int) {
+	this.indexes[i], this.indexes[j] = this.indexes[j], this.indexes[i]
+}
+
+func (this *priorityFrontier) Push(x interface{}) {
+	this.indexes = append(this.indexes, x.(int))
+}
+
+func (this *priorityFrontier) Pop() interface{} {
+	n := len(this.indexes)
+	idx := this.indexes[n-1]
+	this.indexes = this.indexes[:n-1]
+	return idx
+}
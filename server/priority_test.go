@@ -0,0 +1,54 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import "sort"
+import "testing"
+
+func TestPriorityHeapFirst(t *testing.T) {
+	var prioritized priorityHeap
+	var sorted []*record
+	for id := 0; id < 50; id++ {
+		rec := newRecord(1, id)
+		rec.priority = id*7%5 + 1
+		prioritized.add(rec)
+		sorted = append(sorted, rec)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return prioritized.less(sorted[i], sorted[j])
+	})
+	for _, count := range []int{1, 3, 10, 50, 60} {
+		records := prioritized.first(count)
+		expected := sorted
+		if count < len(sorted) {
+			expected = sorted[:count]
+		}
+		if len(records) != len(expected) {
+			t.Fatalf("expected %d records but got %d", len(expected), len(records))
+		}
+		for idx, rec := range records {
+			if rec != expected[idx] {
+				t.Errorf("expected record %d at %d but got %d", expected[idx].id(), idx, rec.id())
+			}
+		}
+	}
+	// heap is not modified
+	for idx, rec := range prioritized {
+		ASSERT_TRUE(t, rec.heapIdx == idx, "expected heap index")
+	}
+	ASSERT_TRUE(t, len(priorityHeap(nil).first(5)) == 0, "expected no records")
+}
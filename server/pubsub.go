@@ -16,7 +16,11 @@
 
 package server
 
-import "fmt"
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
 
 // pubsub
 type pubsub struct {
@@ -73,6 +77,23 @@ type subscription struct {
 	next   *subscription // next node
 	sender *responseSender
 	id     uint64
+	// projected columns, nil when all columns are published
+	columns []*column
+	// pending updates for the same record are collapsed
+	conflate bool
+	// update events carry previous values of updated columns and delete events carry the whole record
+	oldValues bool
+	// minimum interval between batches, 0 when not throttled
+	throttle time.Duration
+	// events are tagged with the table name for wildcard subscriptions
+	table string
+	// events are retained until acknowledged for subscriptions in ack mode
+	durable *durableSubscription
+	// set when the subscription is deactivated or killed, read by other goroutines
+	deactivated int32
+	// number of delivered and dropped responses
+	delivered uint64
+	dropped   uint64
 }
 
 // factory
@@ -84,14 +105,88 @@ func newSubscription(sender *responseSender, id uint64) *subscription {
 	}
 }
 
+// Returns updated columns that are part of the projection with id column always first.
+// Returns nil when update does not touch any projected column.
+func (this *subscription) project(cols []*column) []*column {
+	if this.columns == nil {
+		return cols
+	}
+	projected := make([]*column, 1, len(cols))
+	projected[0] = cols[0]
+	for _, col := range cols[1:] {
+		for _, proj := range this.columns {
+			if col == proj {
+				projected = append(projected, col)
+				break
+			}
+		}
+	}
+	if len(projected) == 1 {
+		return nil
+	}
+	return projected
+}
+
+// Sends the response to the subscriber, throttled subscription batches responses.
+// Durable subscription stays active after its connection is closed.
+func (this *subscription) send(res response) bool {
+	return this.sendTo(this.sender, res)
+}
+
+// Sends the response to the sender the subscription had when it was visited,
+// used by publishers that send after releasing the lock guarding the subscription.
+func (this *subscription) sendTo(sender *responseSender, res response) bool {
+	if this.durable != nil {
+		atomic.AddUint64(&this.delivered, 1)
+		this.durable.send(res)
+		return true
+	}
+	if this.throttle > 0 {
+		atomic.AddUint64(&this.delivered, 1)
+		return sender.sendThrottled(this.id, this.throttle, res)
+	}
+	sent, dropped := sender.sendTracked(res)
+	if dropped {
+		atomic.AddUint64(&this.dropped, 1)
+	} else if sent {
+		atomic.AddUint64(&this.delivered, 1)
+	}
+	return sent
+}
+
+// Returns number of responses delivered to the sender.
+func (this *subscription) deliveredCount() uint64 {
+	return atomic.LoadUint64(&this.delivered)
+}
+
+// Returns number of responses dropped by slow consumer policy.
+func (this *subscription) droppedCount() uint64 {
+	return atomic.LoadUint64(&this.dropped)
+}
+
 //
 func (this *subscription) active() bool {
-	return this.sender != nil
+	return this.sender != nil && !this.closed()
 }
 
 //
 func (this *subscription) deactivate() {
+	// pending batch of throttled subscription is not delivered after unsubscribe
+	if this.throttle > 0 && this.sender != nil {
+		this.sender.cancelThrottled(this.id)
+	}
 	this.sender = nil
+	atomic.StoreInt32(&this.deactivated, 1)
+}
+
+// Kills the subscription from another goroutine, it is removed when its owner visits it next time.
+func (this *subscription) kill() {
+	atomic.StoreInt32(&this.deactivated, 1)
+}
+
+// Determines if the subscription was deactivated or killed.
+func (this *subscription) closed() bool {
+	return atomic.LoadInt32(&this.deactivated) != 0
 }
 
 //
@@ -117,6 +212,12 @@ func (this *mapSubscriptionByConnection) add(connectionId uint64, sub *subscript
 	mapsub[sub.id] = sub
 }
 
+// Moves subscription to another connection.
+func (this *mapSubscriptionByConnection) move(connectionId uint64, sub *subscription) {
+	delete(this.getOrAdd(sub.sender.connectionId), sub.id)
+	this.add(connectionId, sub)
+}
+
 func (this *mapSubscriptionByConnection) deactivate(connectionId uint64, pubsubid uint64) bool {
 	mapsub := this.getOrAdd(connectionId)
 	sub := mapsub[pubsubid]
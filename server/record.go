@@ -35,6 +35,16 @@ type record struct {
 	links  []link
 	prev   *record
 	next   *record
+	// ephemeral records are deleted when owning connection closes
+	ephemeral    bool
+	connectionId uint64
+	// number of times the record was reserved
+	deliveries int
+	// records pushed with priority are kept in a heap at heapIdx,
+	// heapId is the record id parsed when it was added to the heap
+	priority int
+	heapIdx  int
+	heapId   int
 }
 
 // record factory
@@ -53,6 +63,15 @@ func (this *record) free() {
 	this.next = nil
 }
 
+// Returns detached copy of record values.
+func (this *record) copyValues() *record {
+	values := make([]string, len(this.values))
+	copy(values, this.values)
+	return &record{
+		values: values,
+	}
+}
+
 // Returns record index in a table.
 func (r *record) id() int {
 	id, err := strconv.Atoi(r.values[0])
@@ -0,0 +1,151 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// subscriptionInfo describes a registered subscription.
+// Table is empty for topic and schema subscriptions.
+// Sender is kept since subscription releases its sender when deactivated.
+type subscriptionInfo struct {
+	sub    *subscription
+	sender *responseSender
+	table  string
+	filter string
+}
+
+// Determines if the subscription was not deactivated and its connection is still open.
+func (this *subscriptionInfo) alive() bool {
+	return !this.sub.closed() && !this.sender.quit.Done()
+}
+
+// subscriptionRegistry keeps track of subscriptions of all connections so that they can be listed and killed.
+// It is owned by dataService and shared with tables, access is guarded by the mutex.
+type subscriptionRegistry struct {
+	mutex sync.Mutex
+	infos map[uint64][]*subscriptionInfo
+}
+
+// subscriptionRegistry factory
+func newSubscriptionRegistry() *subscriptionRegistry {
+	return &subscriptionRegistry{
+		infos: make(map[uint64][]*subscriptionInfo),
+	}
+}
+
+// Registers the subscription, wildcard subscriptions register once per matching table under the same pubsubid.
+func (this *subscriptionRegistry) add(sub *subscription, table string, filter string) {
+	if this == nil {
+		return
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	info := &subscriptionInfo{
+		sub:    sub,
+		sender: sub.sender,
+		table:  table,
+		filter: filter,
+	}
+	this.infos[sub.id] = append(this.infos[sub.id], info)
+}
+
+// Removes subscriptions that are no longer active.
+func (this *subscriptionRegistry) purge() {
+	for pubsubid, infos := range this.infos {
+		alive := infos[:0]
+		for _, info := range infos {
+			if info.alive() {
+				alive = append(alive, info)
+			}
+		}
+		if len(alive) == 0 {
+			delete(this.infos, pubsubid)
+		} else {
+			this.infos[pubsubid] = alive
+		}
+	}
+}
+
+// Returns active subscriptions ordered by pubsubid, subscriptions are limited to the table when it is not empty.
+func (this *subscriptionRegistry) list(table string) []*subscriptionInfo {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.purge()
+	var infos []*subscriptionInfo
+	for _, registered := range this.infos {
+		for _, info := range registered {
+			if len(table) == 0 || info.table == table {
+				infos = append(infos, info)
+			}
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].sub.id != infos[j].sub.id {
+			return infos[i].sub.id < infos[j].sub.id
+		}
+		return infos[i].table < infos[j].table
+	})
+	return infos
+}
+
+// Kills every subscription registered under the pubsubid.
+// Returns sender of the owning connection or nil when subscription does not exist.
+func (this *subscriptionRegistry) kill(pubsubid uint64) *responseSender {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.purge()
+	infos := this.infos[pubsubid]
+	if len(infos) == 0 {
+		return nil
+	}
+	for _, info := range infos {
+		info.sub.kill()
+	}
+	delete(this.infos, pubsubid)
+	return infos[0].sender
+}
+
+// Returns show subscriptions response listing the subscriptions.
+func newShowSubscriptionsResponse(infos []*subscriptionInfo) *sqlActionDataResponse {
+	res := &sqlActionDataResponse{
+		action: "show",
+	}
+	names := []string{"pubsubid", "connection", "table", "filter", "delivered", "dropped"}
+	res.columns = make([]*column, len(names))
+	for idx, name := range names {
+		res.columns[idx] = newColumn(name, idx)
+	}
+	res.records = make([]*record, 0, len(infos))
+	for _, info := range infos {
+		rec := &record{
+			values: []string{
+				strconv.FormatUint(info.sub.id, 10),
+				strconv.FormatUint(info.sender.connectionId, 10),
+				info.table,
+				info.filter,
+				strconv.FormatUint(info.sub.deliveredCount(), 10),
+				strconv.FormatUint(info.sub.droppedCount(), 10),
+			},
+		}
+		res.records = append(res.records, rec)
+	}
+	return res
+}
@@ -16,6 +16,11 @@
 
 package server
 
+import (
+	"strings"
+	"time"
+)
+
 type requestType uint8
 
 const (
@@ -52,10 +57,20 @@ func (this *errorRequest) isStreaming() bool {
 }
 
 // sqlRequest is a generic sql request.
+// Depth is the number of triggers that led to the request.
 type sqlRequest struct {
 	request
 	table     string
 	streaming bool
+	depth     int
+}
+
+func (this *sqlRequest) triggerDepth() int {
+	return this.depth
+}
+
+func (this *sqlRequest) setTriggerDepth(depth int) {
+	this.depth = depth
 }
 
 func (this *sqlRequest) setStreaming() {
@@ -106,15 +121,52 @@ type cmdCloseRequest struct {
 	cmdRequest
 }
 
+// cmdSnapshotRequest writes snapshot of all tables to the snapshot file.
+type cmdSnapshotRequest struct {
+	cmdRequest
+}
+
+// cmdBackupRequest streams dump of all tables to the client.
+type cmdBackupRequest struct {
+	cmdRequest
+}
+
+// cmdRestoreRequest creates table from the dump streamed by backup.
+type cmdRestoreRequest struct {
+	cmdRequest
+	snap *tableSnapshot
+}
+
+// cmdPolicyRequest sets slow consumer policy for the client connection.
+type cmdPolicyRequest struct {
+	cmdRequest
+	policy  slowConsumerPolicy
+	timeout time.Duration
+}
+
 // columnValue is a pair of column and value
 type columnValue struct {
 	col string
 	val string
 }
 
+// sqlCondition is a single where clause comparison: col op val.
+type sqlCondition struct {
+	col string
+	op  string
+	val string
+}
+
+// sqlPredicate is a where clause with conditions joined by and.
+type sqlPredicate struct {
+	conditions []*sqlCondition
+}
+
 // Temporarely stub for sqlFilter type that will be more capble in future versions.
+// Predicate is set when where clause can not be expressed as a single col = val pair.
 type sqlFilter struct {
 	columnValue
+	predicate *sqlPredicate
 }
 
 // Adds col = val to sqlFilter.
@@ -123,11 +175,29 @@ func (this *sqlFilter) addFilter(col string, val string) {
 	this.val = val
 }
 
+// Returns where clause of the filter, empty string when there is no filter.
+func (this *sqlFilter) String() string {
+	if this.predicate != nil {
+		conditions := make([]string, len(this.predicate.conditions))
+		for idx, cond := range this.predicate.conditions {
+			conditions[idx] = cond.col + " " + cond.op + " " + cond.val
+		}
+		return strings.Join(conditions, " and ")
+	}
+	if len(this.col) == 0 {
+		return ""
+	}
+	return this.col + " = " + this.val
+}
+
 // sqlInsertRequest is a request for sql insert statement.
+// Ephemeral records are owned by the inserting connection and are deleted when it closes.
 type sqlInsertRequest struct {
 	sqlRequest
 	returningColumns
-	colVals []*columnValue
+	colVals      []*columnValue
+	ephemeral    bool
+	connectionId uint64
 }
 
 // sqlPushRequest is a request for sql push statement.
@@ -137,9 +207,14 @@ func newSqlPushRequest() *sqlPushRequest {
 	return req
 }
 
+// Pushed record becomes visible after the delay or at the specified time when either is set.
+// Records pushed with priority are popped from the front before records without priority.
 type sqlPushRequest struct {
 	sqlInsertRequest
-	front bool
+	front    bool
+	delay    time.Duration
+	at       time.Time
+	priority int
 }
 
 // Adds column to columnValue slice.
@@ -194,9 +269,11 @@ func newSqlPeekRequest() *sqlPeekRequest {
 	return req
 }
 
+// Count is the maximum number of records to peek, 0 means a single record.
 type sqlPeekRequest struct {
 	sqlSelectRequest
 	front bool
+	count int
 }
 
 // sqlPopRequest is a request for sql pop statement.
@@ -206,9 +283,36 @@ func newSqlPopRequest() *sqlPopRequest {
 	return req
 }
 
+// Pop request with wait time waits for a record when the table is empty.
+// Count is the maximum number of records to pop, 0 means a single record.
 type sqlPopRequest struct {
 	sqlSelectRequest
 	front bool
+	wait  time.Duration
+	count int
+}
+
+// sqlReserveRequest is a request for sql reserve statement.
+// Reserved record is hidden from pop and peek until it is acknowledged or the timeout expires.
+// Record that was reserved attempts times is moved to dead letter table instead of reappearing.
+type sqlReserveRequest struct {
+	sqlRequest
+	front      bool
+	timeout    time.Duration
+	deadLetter string
+	attempts   int
+}
+
+// sqlAckRecordRequest is a request for sql ack statement that deletes reserved record.
+type sqlAckRecordRequest struct {
+	sqlRequest
+	id string
+}
+
+// sqlNackRecordRequest is a request for sql nack statement that returns reserved record to the front.
+type sqlNackRecordRequest struct {
+	sqlRequest
+	id string
 }
 
 // sqlUpdateRequest is a request for sql update statement.
@@ -246,11 +350,46 @@ type sqlTagRequest struct {
 }
 
 // sqlSubscribeRequest is a request for sql subscribe statement.
+// Returning columns hold the subscription projection, all columns are published when not used.
+// Resumed subscription receives only changes that followed the sequence number.
+// Conflated subscription collapses pending updates for the same record.
+// Throttled subscription receives batched responses at most once per interval.
+// Pubsubid is assigned by dataService to table subscriptions of a wildcard subscription.
+// Aggregate subscription receives aggregate values instead of records.
+// Ordered subscription receives changes of the first limit records ordered by a column.
+// Durable subscription is in ack mode, dataService resolves durable name to durableSub.
 type sqlSubscribeRequest struct {
 	sqlRequest
-	skip   bool
-	filter sqlFilter
-	sender *responseSender
+	returningColumns
+	skip       bool
+	filter     sqlFilter
+	sender     *responseSender
+	resume     bool
+	sequence   uint64
+	conflate   bool
+	throttle   time.Duration
+	pubsubid   uint64
+	aggregates []*sqlAggregate
+	orderBy    string
+	desc       bool
+	limit      int
+	durable    string
+	durableSub *durableSubscription
+	oldValues  bool
+}
+
+// sqlAggregate is an aggregate function over a column, column is * for count(*).
+type sqlAggregate struct {
+	fn  string
+	col string
+}
+
+// sqlAckRequest is a request for sql ack statement.
+// Acknowledges events of durable subscription up to and including the delivery sequence.
+type sqlAckRequest struct {
+	sqlRequest
+	durable  string
+	delivery uint64
 }
 
 // sqlUnsubscribeRequest is a request for sql unsubscribe statement.
@@ -260,6 +399,18 @@ type sqlUnsubscribeRequest struct {
 	filter       sqlFilter
 }
 
+// sqlConnectionClosedRequest is an internal request issued when a client connection closes.
+// It is forwarded to every table so that ephemeral records owned by the connection are deleted.
+type sqlConnectionClosedRequest struct {
+	sqlRequest
+	connectionId uint64
+}
+
+// sqlSnapshotRequest is an internal request forwarded to every table to serialize its state.
+type sqlSnapshotRequest struct {
+	sqlRequest
+	writer *snapshotWriter
+}
 
 // sqlSubscribeTopicRequest is a request for sql subscribe topic statement.
 type sqlSubscribeTopicRequest struct {
@@ -268,3 +419,59 @@ type sqlSubscribeTopicRequest struct {
 	sender *responseSender
 }
 
+// sqlUnsubscribeTopicRequest is a request for sql unsubscribe topic statement.
+type sqlUnsubscribeTopicRequest struct {
+	sqlRequest
+	topic        string
+	connectionId uint64
+}
+
+// sqlSubscribeSchemaRequest is a request for sql subscribe schema statement.
+type sqlSubscribeSchemaRequest struct {
+	sqlRequest
+	sender *responseSender
+}
+
+// sqlUnsubscribeSchemaRequest is a request for sql unsubscribe schema statement.
+type sqlUnsubscribeSchemaRequest struct {
+	sqlRequest
+	connectionId uint64
+}
+
+// sqlCreateTriggerRequest is a request for sql create trigger statement.
+// Trigger is created by the data service before the request is forwarded to the table.
+type sqlCreateTriggerRequest struct {
+	sqlRequest
+	name      string
+	action    string
+	statement string
+	trigger   *trigger
+}
+
+// sqlDropTriggerRequest is a request for sql drop trigger statement.
+type sqlDropTriggerRequest struct {
+	sqlRequest
+	name    string
+	trigger *trigger
+}
+
+// sqlShowSubscriptionsRequest is a request for show subscriptions statement.
+// Subscriptions of all tables, topics and schema are listed when table is empty.
+type sqlShowSubscriptionsRequest struct {
+	sqlRequest
+}
+
+// sqlKillSubscriptionRequest is a request for kill subscription statement.
+// Kills subscription of any connection.
+type sqlKillSubscriptionRequest struct {
+	sqlRequest
+	pubsubid uint64
+}
+
+// sqlPublishRequest is a request for sql publish statement.
+type sqlPublishRequest struct {
+	sqlRequest
+	topic   string
+	message string
+}
+
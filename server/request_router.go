@@ -48,16 +48,28 @@ func (this *requestRouter) route(item *requestItem) {
 }
 
 func (this *requestRouter) onCmd(item *requestItem) {
-	switch item.req.(type) {
+	switch req := item.req.(type) {
 	case *cmdCloseRequest:
 		logInfo("client connection:", item.sender.connectionId, "requested to disconnect ")
 		item.sender.disconnecting = true
 		item.sender.quit.Quit(0)
+	case *cmdPolicyRequest:
+		this.onPolicy(item, req)
+	case *cmdSnapshotRequest, *cmdBackupRequest, *cmdRestoreRequest:
+		this.dataSrv.acceptRequest(item)
 	default:
 		this.onControllerCmd(item)
 	}
 }
 
+// Sets slow consumer policy for the requesting connection.
+func (this *requestRouter) onPolicy(item *requestItem, req *cmdPolicyRequest) {
+	item.sender.setPolicy(req.policy, req.timeout)
+	res := newOkResponse("policy")
+	res.requestId = item.getRequestId()
+	item.sender.send(res)
+}
+
 func (this *requestRouter) onControllerCmd(item *requestItem) {
 	if this.controllerRequests != nil {
 		this.controllerRequests <- item
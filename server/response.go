@@ -18,6 +18,7 @@ package server
 
 import "strconv"
 import "fmt"
+import "time"
 
 type responseStatusType int8
 
@@ -109,7 +110,12 @@ func (this *okResponse) toNetworkReadyJSON() ([]byte, bool) {
 // cmdStatusResponse
 type cmdStatusResponse struct {
 	requestIdResponse
-	connections int
+	connections    int
+	dropped        uint64
+	spilled        uint64
+	walSize        int64
+	lastSnapshot   time.Time
+	replayDuration time.Duration
 }
 
 func newCmdStatusResponse(connections int) *cmdStatusResponse {
@@ -126,10 +132,104 @@ func (this *cmdStatusResponse) toNetworkReadyJSON() ([]byte, bool) {
 	action(builder, "status")
 	builder.valueSeparator()
 	builder.nameIntValue("connections", this.connections)
+	builder.valueSeparator()
+	builder.nameValue("dropped", strconv.FormatUint(this.dropped, 10))
+	builder.valueSeparator()
+	builder.nameValue("spilled", strconv.FormatUint(this.spilled, 10))
+	builder.valueSeparator()
+	builder.nameValue("walsize", strconv.FormatInt(this.walSize, 10))
+	builder.valueSeparator()
+	lastSnapshot := ""
+	if !this.lastSnapshot.IsZero() {
+		lastSnapshot = this.lastSnapshot.Format(time.RFC3339)
+	}
+	builder.nameValue("lastsnapshot", lastSnapshot)
+	builder.valueSeparator()
+	builder.nameValue("replayduration", this.replayDuration.String())
+	builder.endObject()
+	return builder.getNetworkBytes(this.requestId), false
+}
+
+// cmdBackupResponse is a part of the backup stream.
+// The stream starts with number of tables followed by dump of every table.
+type cmdBackupResponse struct {
+	requestIdResponse
+	tables   int
+	table    string
+	snapshot []byte
+}
+
+func newCmdBackupResponse(tables int) *cmdBackupResponse {
+	return &cmdBackupResponse{
+		tables: tables,
+	}
+}
+
+func newCmdBackupTableResponse(serialized *serializedSnapshot) *cmdBackupResponse {
+	return &cmdBackupResponse{
+		table:    serialized.table,
+		snapshot: serialized.bytes,
+	}
+}
+
+func (this *cmdBackupResponse) toNetworkReadyJSON() ([]byte, bool) {
+	builder := networkReadyJSONBuilder()
+	builder.beginObject()
+	ok(builder)
+	builder.valueSeparator()
+	action(builder, "backup")
+	builder.valueSeparator()
+	if this.snapshot == nil {
+		builder.nameIntValue("tables", this.tables)
+	} else {
+		builder.nameValue("table", this.table)
+		builder.valueSeparator()
+		builder.nameRawValue("snapshot", this.snapshot)
+	}
 	builder.endObject()
 	return builder.getNetworkBytes(this.requestId), false
 }
 
+// gapResponse notifies client that responses were dropped because it could not keep up
+type gapResponse struct {
+	requestIdResponse
+	dropped uint64
+}
+
+func newGapResponse(dropped uint64) *gapResponse {
+	return &gapResponse{
+		dropped: dropped,
+	}
+}
+
+func (this *gapResponse) toNetworkReadyJSON() ([]byte, bool) {
+	builder := networkReadyJSONBuilder()
+	builder.beginObject()
+	ok(builder)
+	builder.valueSeparator()
+	action(builder, "gap")
+	builder.valueSeparator()
+	builder.nameValue("dropped", strconv.FormatUint(this.dropped, 10))
+	builder.endObject()
+	return builder.getNetworkBytes(0), false
+}
+
+// spilledResponse is a network ready response restored from the spill buffer
+type spilledResponse struct {
+	requestIdResponse
+	msg []byte
+}
+
+func newSpilledResponse(msg []byte) *spilledResponse {
+	return &spilledResponse{
+		msg: msg,
+	}
+}
+
+func (this *spilledResponse) toNetworkReadyJSON() ([]byte, bool) {
+	return this.msg, false
+}
+
 // sqlSelectResponse is a response for sql select statement
 type sqlSelectResponse struct {
 	requestIdResponse
@@ -300,6 +400,44 @@ func (this *sqlActionDataResponse) toNetworkReadyJSON() ([]byte, bool) {
 	return builder.getNetworkBytes(this.requestId), more
 }
 
+// sqlScheduledPushResponse is a response for push request that is due later
+type sqlScheduledPushResponse struct {
+	requestIdResponse
+	due time.Time
+}
+
+func (this *sqlScheduledPushResponse) toNetworkReadyJSON() ([]byte, bool) {
+	builder := networkReadyJSONBuilder()
+	builder.beginObject()
+	ok(builder)
+	builder.valueSeparator()
+	action(builder, "push")
+	builder.valueSeparator()
+	builder.nameValue("scheduled", this.due.UTC().Format(time.RFC3339Nano))
+	builder.endObject()
+	return builder.getNetworkBytes(this.requestId), false
+}
+
+// sqlReserveResponse holds reserved record and number of times it was delivered
+type sqlReserveResponse struct {
+	sqlSelectResponse
+	deliveries int
+}
+
+func (this *sqlReserveResponse) toNetworkReadyJSON() ([]byte, bool) {
+	builder := networkReadyJSONBuilder()
+	builder.beginObject()
+	ok(builder)
+	builder.valueSeparator()
+	action(builder, "reserve")
+	builder.valueSeparator()
+	builder.nameIntValue("deliveries", this.deliveries)
+	builder.valueSeparator()
+	more := this.data(builder, false)
+	builder.endObject()
+	return builder.getNetworkBytes(this.requestId), more
+}
+
 // sqlSubscribeResponse
 type sqlSubscribeResponse struct {
 	requestIdResponse
@@ -325,9 +463,31 @@ func newSubscribeResponse(sub *subscription) response {
 }
 
 // sqlPubSubResponse
+// Sequence is the table change sequence number of the last published change.
+// Table is set for events of wildcard subscriptions.
+// Delivery is set for events of durable subscriptions that have to be acknowledged.
 type sqlPubSubResponse struct {
 	sqlSelectResponse
 	pubsubid uint64
+	sequence uint64
+	table    string
+	delivery uint64
+}
+
+// pubsubResponse is implemented by table events.
+type pubsubResponse interface {
+	response
+	pubsubResponse() *sqlPubSubResponse
+}
+
+func (this *sqlPubSubResponse) pubsubResponse() *sqlPubSubResponse {
+	return this
+}
+
+// Determines if two events can be merged into one.
+// Events of durable subscriptions are acknowledged individually and are never merged.
+func (this *sqlPubSubResponse) mergeable(res *sqlPubSubResponse) bool {
+	return this.pubsubid == res.pubsubid && this.table == res.table && this.delivery == 0 && res.delivery == 0
 }
 
 func (this *sqlPubSubResponse) toNetworkReadyJSONHelper(act string) ([]byte, bool) {
@@ -341,19 +501,30 @@ func (this *sqlPubSubResponse) toNetworkReadyJSONHelper(act string) ([]byte, boo
 	builder.valueSeparator()
 	builder.nameValue("pubsubid", strconv.FormatUint(this.pubsubid, 10))
 	builder.valueSeparator()
+	if len(this.table) > 0 {
+		builder.nameValue("table", this.table)
+		builder.valueSeparator()
+	}
+	builder.nameValue("sequence", strconv.FormatUint(this.sequence, 10))
+	builder.valueSeparator()
+	if this.delivery > 0 {
+		builder.nameValue("delivery", strconv.FormatUint(this.delivery, 10))
+		builder.valueSeparator()
+	}
 	more := this.data(builder, true)
 	builder.endObject()
 	return builder.getNetworkBytes(0), more
 }
 
 func mergeHelper(res1 *sqlPubSubResponse, res2 *sqlPubSubResponse) bool {
-	if res1.pubsubid != res2.pubsubid {
+	if !res1.mergeable(res2) {
 		return false
 	}
 	if len(res1.columns) != len(res2.columns) {
 		return false
 	}
 	res1.records = append(res1.records, res2.records...)
+	res1.sequence = res2.sequence
 	return true
 }
 
@@ -429,9 +600,47 @@ func (this *sqlActionRemoveResponse) merge(res response) bool {
 	return false
 }
 
+// sqlActionReservedResponse notifies subscribers that record was reserved and is hidden from pop and peek
+type sqlActionReservedResponse struct {
+	sqlPubSubResponse
+}
+
+func (this *sqlActionReservedResponse) toNetworkReadyJSON() ([]byte, bool) {
+	return this.toNetworkReadyJSONHelper("reserved")
+}
+
+func (this *sqlActionReservedResponse) merge(res response) bool {
+	switch res.(type) {
+	case *sqlActionReservedResponse:
+		source := res.(*sqlActionReservedResponse)
+		return mergeHelper(&this.sqlPubSubResponse, &source.sqlPubSubResponse)
+	}
+	return false
+}
+
+// sqlActionReleasedResponse notifies subscribers that reserved record was not acknowledged and reappeared
+type sqlActionReleasedResponse struct {
+	sqlPubSubResponse
+}
+
+func (this *sqlActionReleasedResponse) toNetworkReadyJSON() ([]byte, bool) {
+	return this.toNetworkReadyJSONHelper("released")
+}
+
+func (this *sqlActionReleasedResponse) merge(res response) bool {
+	switch res.(type) {
+	case *sqlActionReleasedResponse:
+		source := res.(*sqlActionReleasedResponse)
+		return mergeHelper(&this.sqlPubSubResponse, &source.sqlPubSubResponse)
+	}
+	return false
+}
+
 // sqlActionUpdateResponse
+// Conflated response holds the latest values of each updated record.
 type sqlActionUpdateResponse struct {
 	sqlPubSubResponse
+	conflate bool
 }
 
 func (this *sqlActionUpdateResponse) toNetworkReadyJSON() ([]byte, bool) {
@@ -442,7 +651,7 @@ func (this *sqlActionUpdateResponse) merge(res response) bool {
 	switch res.(type) {
 	case *sqlActionUpdateResponse:
 		source := res.(*sqlActionUpdateResponse)
-		if this.pubsubid != source.pubsubid {
+		if !this.mergeable(&source.sqlPubSubResponse) {
 			return false
 		}
 		if len(this.columns) != len(source.columns) {
@@ -454,20 +663,178 @@ func (this *sqlActionUpdateResponse) merge(res response) bool {
 				return false
 			}
 		}
-		this.records = append(this.records, source.records...)
+		if this.conflate && source.conflate {
+			this.conflateRecords(source.records)
+		} else {
+			this.records = append(this.records, source.records...)
+		}
+		this.sequence = source.sequence
 		return true
 	}
 	return false
 }
 
-func newSqlActionUpdateResponse(pubsubid uint64, cols []*column, rec *record) *sqlActionUpdateResponse {
+// Replaces values of already pending records with the same id and appends the rest.
+// Id is always the first column.
+func (this *sqlActionUpdateResponse) conflateRecords(records []*record) {
+	for _, source := range records {
+		conflated := false
+		for _, rec := range this.records {
+			if rec.getValue(0) == source.getValue(0) {
+				rec.values = source.values
+				conflated = true
+				break
+			}
+		}
+		if !conflated {
+			this.records = append(this.records, source)
+		}
+	}
+}
+
+func newSqlActionUpdateResponse(pubsubid uint64, sequence uint64, cols []*column, rec *record) *sqlActionUpdateResponse {
 	var res sqlActionUpdateResponse
 	res.columns = cols
 	res.pubsubid = pubsubid
+	res.sequence = sequence
 	res.copyRecordData(rec)
 	return &res
 }
 
+// Adds previous values of updated columns as old.column columns.
+// Id is always the first column and is not repeated.
+func (this *sqlActionUpdateResponse) addOldValues(old *record) {
+	columns := make([]*column, len(this.columns), 2*len(this.columns)-1)
+	copy(columns, this.columns)
+	for _, col := range this.columns[1:] {
+		columns = append(columns, &column{name: "old." + col.name, ordinal: col.ordinal})
+	}
+	for _, rec := range this.records {
+		for _, col := range this.columns[1:] {
+			rec.values = append(rec.values, old.getValue(col.ordinal))
+		}
+	}
+	this.columns = columns
+}
+
+// sqlActionAggregateResponse holds current values of subscribed aggregates
+type sqlActionAggregateResponse struct {
+	sqlPubSubResponse
+}
+
+func (this *sqlActionAggregateResponse) toNetworkReadyJSON() ([]byte, bool) {
+	return this.toNetworkReadyJSONHelper("aggregate")
+}
+
+// Newer aggregate values replace pending ones.
+func (this *sqlActionAggregateResponse) merge(res response) bool {
+	switch res.(type) {
+	case *sqlActionAggregateResponse:
+		source := res.(*sqlActionAggregateResponse)
+		if !this.mergeable(&source.sqlPubSubResponse) {
+			return false
+		}
+		this.records = source.records
+		this.sequence = source.sequence
+		return true
+	}
+	return false
+}
+
+// sqlActionPublishResponse is a message published to a topic subscriber
+type sqlActionPublishResponse struct {
+	requestIdResponse
+	pubsubid uint64
+	topic    string
+	message  string
+}
+
+func newActionPublishResponse(pubsubid uint64, topic string, message string) *sqlActionPublishResponse {
+	return &sqlActionPublishResponse{
+		pubsubid: pubsubid,
+		topic:    topic,
+		message:  message,
+	}
+}
+
+func (this *sqlActionPublishResponse) toNetworkReadyJSON() ([]byte, bool) {
+	builder := networkReadyJSONBuilder()
+	builder.beginObject()
+	ok(builder)
+	builder.valueSeparator()
+	action(builder, "publish")
+	builder.valueSeparator()
+	builder.nameValue("pubsubid", strconv.FormatUint(this.pubsubid, 10))
+	builder.valueSeparator()
+	builder.nameValue("topic", this.topic)
+	builder.valueSeparator()
+	builder.nameValue("data", this.message)
+	builder.endObject()
+	return builder.getNetworkBytes(0), false
+}
+
+// sqlActionSchemaResponse is a table lifecycle or schema change event published to a schema subscriber
+type sqlActionSchemaResponse struct {
+	requestIdResponse
+	pubsubid uint64
+	event    string
+	table    string
+	column   string
+}
+
+func newActionSchemaResponse(pubsubid uint64, event string, table string, column string) *sqlActionSchemaResponse {
+	return &sqlActionSchemaResponse{
+		pubsubid: pubsubid,
+		event:    event,
+		table:    table,
+		column:   column,
+	}
+}
+
+func (this *sqlActionSchemaResponse) toNetworkReadyJSON() ([]byte, bool) {
+	builder := networkReadyJSONBuilder()
+	builder.beginObject()
+	ok(builder)
+	builder.valueSeparator()
+	action(builder, "schema")
+	builder.valueSeparator()
+	builder.nameValue("pubsubid", strconv.FormatUint(this.pubsubid, 10))
+	builder.valueSeparator()
+	builder.nameValue("event", this.event)
+	builder.valueSeparator()
+	builder.nameValue("table", this.table)
+	if len(this.column) > 0 {
+		builder.valueSeparator()
+		builder.nameValue("column", this.column)
+	}
+	builder.endObject()
+	return builder.getNetworkBytes(0), false
+}
+
+// sqlActionKillResponse notifies a subscriber that its subscription was killed by another connection
+type sqlActionKillResponse struct {
+	requestIdResponse
+	pubsubid uint64
+}
+
+func newActionKillResponse(pubsubid uint64) *sqlActionKillResponse {
+	return &sqlActionKillResponse{
+		pubsubid: pubsubid,
+	}
+}
+
+func (this *sqlActionKillResponse) toNetworkReadyJSON() ([]byte, bool) {
+	builder := networkReadyJSONBuilder()
+	builder.beginObject()
+	ok(builder)
+	builder.valueSeparator()
+	action(builder, "kill")
+	builder.valueSeparator()
+	builder.nameValue("pubsubid", strconv.FormatUint(this.pubsubid, 10))
+	builder.endObject()
+	return builder.getNetworkBytes(0), false
+}
+
 // sqlUnsubscribeResponse
 type sqlUnsubscribeResponse struct {
 	requestIdResponse
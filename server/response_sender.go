@@ -16,13 +16,71 @@
 
 package server
 
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// slowConsumerPolicy determines what happens when a client connection can not keep up with responses.
+type slowConsumerPolicy int32
+
+const (
+	slowConsumerDisconnect slowConsumerPolicy = iota // close the connection
+	slowConsumerBlock                                // block until timeout then close the connection
+	slowConsumerDropOldest                           // drop the oldest queued response
+	slowConsumerDropNewest                           // drop the new response and notify client about the gap
+	slowConsumerSpill                                // spill responses to bounded disk buffer
+)
+
+// Converts policy name to slowConsumerPolicy.
+func parseSlowConsumerPolicy(name string) (slowConsumerPolicy, bool) {
+	switch name {
+	case "disconnect":
+		return slowConsumerDisconnect, true
+	case "block":
+		return slowConsumerBlock, true
+	case "dropoldest":
+		return slowConsumerDropOldest, true
+	case "dropnewest":
+		return slowConsumerDropNewest, true
+	case "spill":
+		return slowConsumerSpill, true
+	}
+	return slowConsumerDisconnect, false
+}
+
 // responseSender is a wrapper around client channel for forwarding reponses back to a client connection.
 // It correctly reacts to the client connection close notification.
+// When the channel is full responses are handled according to slow consumer policy.
+// Conflated updates are held back and collapsed instead.
+// Responses for throttled subscriptions are merged and flushed at most once per interval.
 type responseSender struct {
 	sender        chan response // channel to publish responses to
 	connectionId  uint64
 	quit          *Quitter
 	disconnecting bool
+	// slow consumer policy
+	policy  int32
+	timeout int64
+	// number of dropped and spilled responses
+	dropped uint64
+	spilled uint64
+	// guards gap, spill and conflated
+	mutex     sync.Mutex
+	gap       uint64
+	spill     *spillBuffer
+	conflated []*sqlActionUpdateResponse
+	// guards throttled
+	throttleMutex sync.Mutex
+	throttled     map[uint64]*throttledResponses
+}
+
+// throttledResponses accumulates responses for a throttled subscription until the interval expires.
+type throttledResponses struct {
+	interval time.Duration
+	pending  []response
+	timer    *time.Timer
 }
 
 // Returns new responseSender.
@@ -32,26 +90,394 @@ func newResponseSenderStub(connectionId uint64) *responseSender {
 		connectionId:  connectionId,
 		quit:          NewQuitter(),
 		disconnecting: false,
+		policy:        int32(config.SLOW_CONSUMER_POLICY),
+		timeout:       int64(config.SLOW_CONSUMER_TIMEOUT * time.Millisecond),
 	}
 }
 
+// Sets slow consumer policy, timeout is only used by block policy.
+func (this *responseSender) setPolicy(policy slowConsumerPolicy, timeout time.Duration) {
+	atomic.StoreInt64(&this.timeout, int64(timeout))
+	atomic.StoreInt32(&this.policy, int32(policy))
+}
+
+func (this *responseSender) getPolicy() slowConsumerPolicy {
+	return slowConsumerPolicy(atomic.LoadInt32(&this.policy))
+}
+
+// Returns number of dropped responses.
+func (this *responseSender) droppedCount() uint64 {
+	return atomic.LoadUint64(&this.dropped)
+}
+
+// Returns number of responses spilled to disk.
+func (this *responseSender) spilledCount() uint64 {
+	return atomic.LoadUint64(&this.spilled)
+}
+
 // send sends the response to the client
+// Returns false when the connection is closed or is being closed.
 func (this *responseSender) send(res response) bool {
+	sent, _ := this.sendTracked(res)
+	return sent
+}
+
+// sendTracked sends the response to the client and also reports if the response was dropped.
+// Returns false when the connection is closed or is being closed.
+func (this *responseSender) sendTracked(res response) (bool, bool) {
+	if update, ok := res.(*sqlActionUpdateResponse); ok && update.conflate {
+		return this.sendConflated(update), false
+	}
+	// pending conflated updates go first
+	this.mutex.Lock()
+	if !this.trySendConflated() {
+		this.dropConflated(res)
+	}
+	this.mutex.Unlock()
+	switch this.getPolicy() {
+	case slowConsumerBlock:
+		return this.sendBlock(res), false
+	case slowConsumerDropOldest:
+		return this.sendDropOldest(res), false
+	case slowConsumerDropNewest:
+		return this.sendDropNewest(res)
+	case slowConsumerSpill:
+		return this.sendSpill(res), false
+	}
 	select {
 	case this.sender <- res:
 		debug("response was sent")
+		return !this.quit.Done(), false
+	case <-this.quit.GetChan():
+		debug("connection is closed")
+	default:
+		this.full()
+	}
+	return false, false
+}
+
+// Notifies client connection that it needs to close due to inability to
+// send responses in a timely manner.
+func (this *responseSender) full() {
+	logWarn("sender queue is full for connection: ", this.connectionId)
+	this.quit.Quit(0)
+}
+
+// Blocks until there is room in the queue or the timeout expires.
+func (this *responseSender) sendBlock(res response) bool {
+	select {
+	case this.sender <- res:
+		return !this.quit.Done()
+	default:
+	}
+	timer := time.NewTimer(time.Duration(atomic.LoadInt64(&this.timeout)))
+	defer timer.Stop()
+	select {
+	case this.sender <- res:
+		return !this.quit.Done()
+	case <-this.quit.GetChan():
+		debug("connection is closed")
+	case <-timer.C:
+		this.full()
+	}
+	return false
+}
+
+// Blocks until there is room in the queue or either the connection or the server quits.
+// It is used by streams that are sent outside of event loops regardless of slow consumer policy.
+func (this *responseSender) sendWait(res response, quit *Quitter) bool {
+	select {
+	case this.sender <- res:
 		return !this.quit.Done()
 	case <-this.quit.GetChan():
 		debug("connection is closed")
+	case <-quit.GetChan():
+	}
+	return false
+}
+
+// Drops the oldest queued responses to make room for the new one.
+func (this *responseSender) sendDropOldest(res response) bool {
+	for {
+		select {
+		case this.sender <- res:
+			return !this.quit.Done()
+		case <-this.quit.GetChan():
+			debug("connection is closed")
+			return false
+		default:
+		}
+		select {
+		case <-this.sender:
+			atomic.AddUint64(&this.dropped, 1)
+		default:
+		}
+	}
+}
+
+// Drops the new response when the queue is full.
+// Client is notified about number of dropped responses once there is room in the queue.
+// Second return value is true when the response was dropped.
+func (this *responseSender) sendDropNewest(res response) (bool, bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.quit.Done() {
+		return false, false
+	}
+	if this.trySendGap() {
+		select {
+		case this.sender <- res:
+			return true, false
+		default:
+		}
+	}
+	this.gap++
+	atomic.AddUint64(&this.dropped, 1)
+	return true, true
+}
+
+// Tries to notify client about dropped responses.
+// Returns true when there is no pending gap notification.
+func (this *responseSender) trySendGap() bool {
+	if this.gap == 0 {
+		return true
+	}
+	select {
+	case this.sender <- newGapResponse(this.gap):
+		this.gap = 0
+		return true
 	default:
-		logWarn("sender queue is full for connection: ", this.connectionId)
-		// notify client connection that it needs to close due to inability to
-		// send responses in a timely manner
-		this.quit.Quit(0)
 	}
 	return false
 }
 
+// Spills the response to disk buffer when the queue is full or earlier responses are still spilled.
+// Connection is closed when the disk buffer is full.
+func (this *responseSender) sendSpill(res response) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.quit.Done() {
+		return false
+	}
+	if this.spill == nil || this.spill.empty() {
+		select {
+		case this.sender <- res:
+			return true
+		default:
+		}
+	}
+	if this.spill == nil {
+		spill, err := newSpillBuffer(int64(config.SPILL_BUFFER_SIZE))
+		if err != nil {
+			logError("failed to create spill buffer for connection:", this.connectionId, err.Error())
+			this.quit.Quit(0)
+			return false
+		}
+		this.spill = spill
+	}
+	if err := this.spill.write(res); err != nil {
+		logWarn("failed to spill response for connection:", this.connectionId, err.Error())
+		this.quit.Quit(0)
+		return false
+	}
+	atomic.AddUint64(&this.spilled, 1)
+	return true
+}
+
+// Collapses the update with pending updates of the same subscription when the queue is full.
+func (this *responseSender) sendConflated(res *sqlActionUpdateResponse) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.quit.Done() {
+		return false
+	}
+	if this.trySendConflated() {
+		select {
+		case this.sender <- res:
+			return true
+		default:
+		}
+	}
+	for i := len(this.conflated) - 1; i >= 0; i-- {
+		if this.conflated[i].merge(res) {
+			return true
+		}
+	}
+	this.conflated = append(this.conflated, res)
+	return true
+}
+
+// Tries to move pending conflated updates into the queue.
+// Returns true when there are no pending conflated updates.
+func (this *responseSender) trySendConflated() bool {
+	for len(this.conflated) > 0 {
+		select {
+		case this.sender <- this.conflated[0]:
+			this.conflated[0] = nil
+			this.conflated = this.conflated[1:]
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Drops pending conflated updates of records that are deleted or removed by the response,
+// otherwise the client would receive them after the record is gone.
+func (this *responseSender) dropConflated(res response) {
+	var gone *sqlPubSubResponse
+	switch res.(type) {
+	case *sqlActionDeleteResponse:
+		gone = &res.(*sqlActionDeleteResponse).sqlPubSubResponse
+	case *sqlActionRemoveResponse:
+		gone = &res.(*sqlActionRemoveResponse).sqlPubSubResponse
+	default:
+		return
+	}
+	conflated := this.conflated[:0]
+	for _, update := range this.conflated {
+		if update.pubsubid == gone.pubsubid {
+			update.records = dropRecordsById(update.records, gone.records)
+			if len(update.records) == 0 {
+				continue
+			}
+		}
+		conflated = append(conflated, update)
+	}
+	for i := len(conflated); i < len(this.conflated); i++ {
+		this.conflated[i] = nil
+	}
+	this.conflated = conflated
+}
+
+// Returns records without the ones that have the same id as any of the dropped records.
+// Id is always the first column.
+func dropRecordsById(records []*record, dropped []*record) []*record {
+	kept := records[:0]
+	for _, rec := range records {
+		found := false
+		for _, drop := range dropped {
+			if rec.getValue(0) == drop.getValue(0) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			kept = append(kept, rec)
+		}
+	}
+	return kept
+}
+
+// Moves pending gap notification, conflated updates and spilled responses back into the queue while there is room.
+// Called by the connection writer after it takes responses off the queue.
+func (this *responseSender) refill() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if !this.trySendGap() || !this.trySendConflated() || this.spill == nil {
+		return
+	}
+	for !this.spill.empty() {
+		msg, err := this.spill.peek()
+		if err != nil {
+			logWarn("failed to read spilled response for connection:", this.connectionId, err.Error())
+			this.quit.Quit(0)
+			return
+		}
+		select {
+		case this.sender <- newSpilledResponse(msg):
+			this.spill.pop()
+		default:
+			return
+		}
+	}
+}
+
+// Sends the response immediately when the subscription has not sent anything within the interval,
+// otherwise merges it with pending responses that are flushed when the interval expires.
+// Responses are sent after throttleMutex is released since send may block under block slow consumer policy.
+func (this *responseSender) sendThrottled(pubsubid uint64, interval time.Duration, res response) bool {
+	this.throttleMutex.Lock()
+	if this.quit.Done() {
+		this.throttleMutex.Unlock()
+		return false
+	}
+	if this.throttled == nil {
+		this.throttled = make(map[uint64]*throttledResponses)
+	}
+	throttled := this.throttled[pubsubid]
+	if throttled == nil {
+		throttled = &throttledResponses{interval: interval}
+		this.throttled[pubsubid] = throttled
+		throttled.timer = time.AfterFunc(interval, func() { this.flushThrottled(pubsubid) })
+		this.throttleMutex.Unlock()
+		return this.send(res)
+	}
+	if last := len(throttled.pending) - 1; last < 0 || !throttled.pending[last].merge(res) {
+		throttled.pending = append(throttled.pending, res)
+	}
+	this.throttleMutex.Unlock()
+	return true
+}
+
+// Sends merged pending responses of the throttled subscription.
+// Subscription that has nothing pending when the interval expires is no longer throttled
+// until it sends again.
+// Timer is reset after pending responses are sent so that flushes of the subscription do not overlap.
+func (this *responseSender) flushThrottled(pubsubid uint64) {
+	this.throttleMutex.Lock()
+	throttled := this.throttled[pubsubid]
+	if throttled == nil {
+		this.throttleMutex.Unlock()
+		return
+	}
+	if len(throttled.pending) == 0 || this.quit.Done() {
+		delete(this.throttled, pubsubid)
+		this.throttleMutex.Unlock()
+		return
+	}
+	pending := throttled.pending
+	throttled.pending = nil
+	this.throttleMutex.Unlock()
+	for _, res := range pending {
+		if !this.send(res) {
+			break
+		}
+	}
+	this.throttleMutex.Lock()
+	defer this.throttleMutex.Unlock()
+	if this.throttled[pubsubid] == throttled {
+		throttled.timer.Reset(throttled.interval)
+	}
+}
+
+// Discards pending responses of the throttled subscription that was unsubscribed.
+func (this *responseSender) cancelThrottled(pubsubid uint64) {
+	this.throttleMutex.Lock()
+	defer this.throttleMutex.Unlock()
+	if throttled := this.throttled[pubsubid]; throttled != nil {
+		throttled.timer.Stop()
+		delete(this.throttled, pubsubid)
+	}
+}
+
+// Releases resources held by the sender after the connection is closed.
+func (this *responseSender) release() {
+	this.throttleMutex.Lock()
+	for _, throttled := range this.throttled {
+		throttled.timer.Stop()
+	}
+	this.throttled = nil
+	this.throttleMutex.Unlock()
+	//
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.spill != nil {
+		this.spill.close()
+		this.spill = nil
+	}
+}
+
 // tryRecv attemps to receive a response from the client.
 func (this *responseSender) tryRecv() response {
 	select {
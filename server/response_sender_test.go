@@ -0,0 +1,191 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestResponseSender(size int, policy slowConsumerPolicy, timeout time.Duration) *responseSender {
+	sender := newResponseSenderStub(1)
+	sender.sender = make(chan response, size)
+	sender.setPolicy(policy, timeout)
+	return sender
+}
+
+func TestResponseSenderDisconnect(t *testing.T) {
+	sender := newTestResponseSender(1, slowConsumerDisconnect, 0)
+	if !sender.send(newOkResponse("test")) {
+		t.Error("expected send to succeed")
+	}
+	if sender.send(newOkResponse("test")) {
+		t.Error("expected send to fail")
+	}
+	if !sender.quit.Done() {
+		t.Error("expected connection to quit")
+	}
+}
+
+func TestResponseSenderBlock(t *testing.T) {
+	sender := newTestResponseSender(1, slowConsumerBlock, 50*time.Millisecond)
+	sender.send(newOkResponse("1"))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		sender.testRecv()
+	}()
+	if !sender.send(newOkResponse("2")) {
+		t.Error("expected blocked send to succeed")
+	}
+	if sender.send(newOkResponse("3")) {
+		t.Error("expected blocked send to time out")
+	}
+	if !sender.quit.Done() {
+		t.Error("expected connection to quit")
+	}
+}
+
+func TestResponseSenderDropOldest(t *testing.T) {
+	sender := newTestResponseSender(2, slowConsumerDropOldest, 0)
+	for _, act := range []string{"1", "2", "3", "4"} {
+		if !sender.send(newOkResponse(act)) {
+			t.Error("expected send to succeed")
+		}
+	}
+	if sender.droppedCount() != 2 {
+		t.Error("expected 2 dropped responses but got", sender.droppedCount())
+	}
+	if res := sender.testRecv().(*okResponse); res.action != "3" {
+		t.Error("expected response 3 but got", res.action)
+	}
+	if res := sender.testRecv().(*okResponse); res.action != "4" {
+		t.Error("expected response 4 but got", res.action)
+	}
+}
+
+func TestResponseSenderDropNewest(t *testing.T) {
+	sender := newTestResponseSender(1, slowConsumerDropNewest, 0)
+	for _, act := range []string{"1", "2", "3"} {
+		if !sender.send(newOkResponse(act)) {
+			t.Error("expected send to succeed")
+		}
+	}
+	if sender.droppedCount() != 2 {
+		t.Error("expected 2 dropped responses but got", sender.droppedCount())
+	}
+	if res := sender.testRecv().(*okResponse); res.action != "1" {
+		t.Error("expected response 1 but got", res.action)
+	}
+	sender.refill()
+	gap, ok := sender.testRecv().(*gapResponse)
+	if !ok || gap.dropped != 2 {
+		t.Error("expected gap response with 2 dropped responses")
+	}
+	sender.send(newOkResponse("4"))
+	if res := sender.testRecv().(*okResponse); res.action != "4" {
+		t.Error("expected response 4 but got", res.action)
+	}
+}
+
+func TestResponseSenderSpill(t *testing.T) {
+	sender := newTestResponseSender(1, slowConsumerSpill, 0)
+	defer sender.release()
+	for _, act := range []string{"1", "2", "3"} {
+		if !sender.send(newOkResponse(act)) {
+			t.Error("expected send to succeed")
+		}
+	}
+	if sender.spilledCount() != 2 {
+		t.Error("expected 2 spilled responses but got", sender.spilledCount())
+	}
+	sender.testRecv()
+	for _, act := range []string{"2", "3"} {
+		sender.refill()
+		res, ok := sender.testRecv().(*spilledResponse)
+		if !ok {
+			t.Error("expected spilled response")
+			return
+		}
+		expected, _ := newOkResponse(act).toNetworkReadyJSON()
+		if string(res.msg) != string(expected) {
+			t.Error("expected", string(expected), "but got", string(res.msg))
+		}
+	}
+	if sender.tryRecv() != nil {
+		t.Error("expected empty queue")
+	}
+}
+
+func TestResponseSenderBlockedThrottleFlush(t *testing.T) {
+	sender := newTestResponseSender(2, slowConsumerBlock, time.Second)
+	defer sender.release()
+	sender.sendThrottled(2, time.Hour, newOkResponse("x"))
+	sender.sendThrottled(1, 10*time.Millisecond, newOkResponse("a"))
+	sender.sendThrottled(1, 10*time.Millisecond, newOkResponse("b"))
+	// flush of the first subscription blocks on the full queue
+	time.Sleep(50 * time.Millisecond)
+	started := time.Now()
+	sender.sendThrottled(2, time.Hour, newOkResponse("y"))
+	if time.Since(started) > 500*time.Millisecond {
+		t.Error("expected throttled send to not wait for blocked flush")
+	}
+	sender.testRecv()
+	sender.testRecv()
+	var res response
+	for i := 0; i < 100 && res == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		res = sender.tryRecv()
+	}
+	if ok, _ := res.(*okResponse); ok == nil || ok.action != "b" {
+		t.Error("expected flushed response b")
+	}
+}
+
+func TestResponseSenderConflatedDelete(t *testing.T) {
+	sender := newTestResponseSender(1, slowConsumerSpill, 0)
+	defer sender.release()
+	cols := []*column{&column{name: "id", ordinal: 0}, &column{name: "bid", ordinal: 1}}
+	newUpdate := func(id string, bid string) *sqlActionUpdateResponse {
+		res := newSqlActionUpdateResponse(1, 0, cols, &record{values: []string{id, bid}})
+		res.conflate = true
+		return res
+	}
+	sender.send(newOkResponse("1"))
+	// updates are held back while the queue is full
+	sender.send(newUpdate("0", "12"))
+	sender.send(newUpdate("1", "30"))
+	sender.send(newUpdate("0", "13"))
+	// delete of record 0 discards its pending update
+	deleted := new(sqlActionDeleteResponse)
+	deleted.pubsubid = 1
+	deleted.columns = cols[:1]
+	deleted.copyRecordData(&record{values: []string{"0", "13"}})
+	sender.send(deleted)
+	sender.testRecv()
+	sender.refill()
+	update, ok := sender.testRecv().(*sqlActionUpdateResponse)
+	if !ok || len(update.records) != 1 || update.records[0].getValue(0) != "1" {
+		t.Error("expected pending update of record 1 only")
+	}
+	sender.refill()
+	if _, ok := sender.testRecv().(*spilledResponse); !ok {
+		t.Error("expected spilled delete response")
+	}
+	if sender.tryRecv() != nil {
+		t.Error("expected empty queue")
+	}
+}
@@ -18,6 +18,7 @@ package server
 
 import "testing"
 import "encoding/json"
+import "time"
 
 //import "fmt"
 
@@ -41,3 +42,18 @@ func TestOkResponseJSON(t *testing.T) {
 	res := &okResponse{}
 	validateResponseJSON(t, res)
 }
+
+func TestCmdStatusResponseJSON(t *testing.T) {
+	res := newCmdStatusResponse(3)
+	validateResponseJSON(t, res)
+	res.walSize = 1024
+	res.lastSnapshot = time.Now()
+	res.replayDuration = 15 * time.Millisecond
+	validateResponseJSON(t, res)
+}
+
+func TestCmdBackupResponseJSON(t *testing.T) {
+	validateResponseJSON(t, newCmdBackupResponse(2))
+	serialized := &serializedSnapshot{table: "stocks", bytes: []byte(`{"table":"stocks","records":[]}`)}
+	validateResponseJSON(t, newCmdBackupTableResponse(serialized))
+}
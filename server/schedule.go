@@ -0,0 +1,91 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"container/heap"
+	"time"
+)
+
+// scheduledPush is a push request waiting for its due time.
+type scheduledPush struct {
+	req *sqlPushRequest
+	due time.Time
+	// preserves push order of requests with the same due time
+	seq uint64
+	// sequence of the write-ahead log entry that scheduled the push
+	logged uint64
+}
+
+// scheduleHeap is a min heap of scheduled pushes ordered by due time.
+type scheduleHeap []*scheduledPush
+
+func (this scheduleHeap) Len() int {
+	return len(this)
+}
+
+func (this scheduleHeap) Less(i, j int) bool {
+	if this[i].due.Equal(this[j].due) {
+		return this[i].seq < this[j].seq
+	}
+	return this[i].due.Before(this[j].due)
+}
+
+func (this scheduleHeap) Swap(i, j int) {
+	this[i], this[j] = this[j], this[i]
+}
+
+func (this *scheduleHeap) Push(x interface{}) {
+	*this = append(*this, x.(*scheduledPush))
+}
+
+func (this *scheduleHeap) Pop() interface{} {
+	old := *this
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*this = old[:n-1]
+	return item
+}
+
+// schedule keeps push requests until they are due.
+type schedule struct {
+	pushes scheduleHeap
+	seq    uint64
+}
+
+// Adds push request due at the specified time.
+func (this *schedule) add(req *sqlPushRequest, due time.Time, logged uint64) {
+	this.seq++
+	heap.Push(&this.pushes, &scheduledPush{req: req, due: due, seq: this.seq, logged: logged})
+}
+
+// Returns the earliest due time, zero time when nothing is scheduled.
+func (this *schedule) next() time.Time {
+	if len(this.pushes) == 0 {
+		return time.Time{}
+	}
+	return this.pushes[0].due
+}
+
+// Removes and returns the earliest scheduled push that is due, nil when none is due.
+func (this *schedule) due(now time.Time) *scheduledPush {
+	if len(this.pushes) == 0 || this.pushes[0].due.After(now) {
+		return nil
+	}
+	return heap.Pop(&this.pushes).(*scheduledPush)
+}
@@ -0,0 +1,96 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// schemaBroker publishes table lifecycle and schema change events to schema subscribers.
+// It is owned by dataService and shared with tables, access is guarded by the mutex.
+type schemaBroker struct {
+	mutex         sync.Mutex
+	pubsub        pubsub
+	subscriptions mapSubscriptionByConnection
+	registry      *subscriptionRegistry
+}
+
+// schemaBroker factory
+func newSchemaBroker() *schemaBroker {
+	return &schemaBroker{
+		subscriptions: make(mapSubscriptionByConnection),
+	}
+}
+
+// Processes sql subscribe schema request.
+// On success returns sqlSubscribeResponse.
+func (this *schemaBroker) subscribe(req *sqlSubscribeSchemaRequest) response {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	sub := newSubscription(req.sender, atomic.AddUint64(&subid, 1))
+	this.subscriptions.add(req.sender.connectionId, sub)
+	this.pubsub.add(sub)
+	this.registry.add(sub, "", "schema")
+	return newSubscribeResponse(sub)
+}
+
+// Processes sql unsubscribe schema request.
+// Unsubscribes all schema subscriptions for a given connection and returns sqlUnsubscribeResponse.
+func (this *schemaBroker) unsubscribe(req *sqlUnsubscribeSchemaRequest) response {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	res := new(sqlUnsubscribeResponse)
+	res.unsubscribed = this.subscriptions.deactivateAll(req.connectionId)
+	// visiting removes deactivated subscriptions
+	this.pubsub.count()
+	return res
+}
+
+// Deactivates all schema subscriptions for a closed connection.
+func (this *schemaBroker) connectionClosed(connectionId uint64) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.subscriptions.deactivateAll(connectionId) > 0 {
+		this.pubsub.count()
+	}
+}
+
+// Publishes schema event to every schema subscriber.
+// Column is empty for table create events.
+// Events are sent after the mutex is released so that slow subscriber does not stall other publishers.
+func (this *schemaBroker) publish(event string, table string, column string) {
+	if this == nil {
+		return
+	}
+	var subs []*subscription
+	var senders []*responseSender
+	this.mutex.Lock()
+	visitor := func(sub *subscription) bool {
+		subs = append(subs, sub)
+		senders = append(senders, sub.sender)
+		return true
+	}
+	this.pubsub.visit(visitor)
+	this.mutex.Unlock()
+	for idx, sub := range subs {
+		if !sub.sendTo(senders[idx], newActionSchemaResponse(sub.id, event, table, column)) {
+			// removed when the subscriptions are visited next time
+			sub.kill()
+		}
+	}
+}
@@ -0,0 +1,273 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// snapshotRecord is a record of the table snapshot with values in the order of snapshot columns.
+type snapshotRecord struct {
+	Id         int      `json:"id"`
+	Priority   int      `json:"priority,omitempty"`
+	Deliveries int      `json:"deliveries,omitempty"`
+	Vals       []string `json:"vals"`
+}
+
+// tableSnapshot is a point-in-time state of the table, stored as one JSON object per line of the snapshot file.
+type tableSnapshot struct {
+	Table string `json:"table"`
+	// sequence of the last write-ahead log entry included in the snapshot
+	Seq     uint64   `json:"seq"`
+	Columns []string `json:"columns"`
+	Keys    []string `json:"keys,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	// records in the queue order, reserved records go first
+	Records []*snapshotRecord `json:"records"`
+	// pushes that are due later
+	Scheduled []*walEntry `json:"scheduled,omitempty"`
+}
+
+// Returns snapshot of the table.
+// Ephemeral records do not outlive connections that own them and are not included.
+func (this *table) snapshot() *tableSnapshot {
+	snap := &tableSnapshot{
+		Table:   this.name,
+		Seq:     this.wal.sequence(),
+		Columns: make([]string, 0, len(this.colSlice)-1),
+		Records: make([]*snapshotRecord, 0, this.count),
+	}
+	for _, col := range this.colSlice[1:] {
+		snap.Columns = append(snap.Columns, col.name)
+	}
+	for _, col := range this.tagedColumns {
+		if col.isKey() {
+			snap.Keys = append(snap.Keys, col.name)
+		} else {
+			snap.Tags = append(snap.Tags, col.name)
+		}
+	}
+	// reserved records reappear at the front of the queue
+	reserved := make([]int, 0, len(this.reservations))
+	for id, _ := range this.reservations {
+		reserved = append(reserved, id)
+	}
+	sort.Ints(reserved)
+	for _, id := range reserved {
+		this.addSnapshotRecord(snap, this.reservations[id].rec)
+	}
+	for rec := this.first; rec != nil; rec = rec.next {
+		this.addSnapshotRecord(snap, rec)
+	}
+	pushes := make(scheduleHeap, len(this.scheduled.pushes))
+	copy(pushes, this.scheduled.pushes)
+	sort.Sort(pushes)
+	for _, push := range pushes {
+		entry := newScheduleEntry(push.req, push.due)
+		entry.Seq = push.logged
+		snap.Scheduled = append(snap.Scheduled, entry)
+	}
+	return snap
+}
+
+// Adds record values to the snapshot.
+func (this *table) addSnapshotRecord(snap *tableSnapshot, rec *record) {
+	if rec.ephemeral {
+		return
+	}
+	srec := &snapshotRecord{
+		Id:         rec.id(),
+		Priority:   rec.priority,
+		Deliveries: rec.deliveries,
+		Vals:       make([]string, len(this.colSlice)-1),
+	}
+	for idx, col := range this.colSlice[1:] {
+		srec.Vals[idx] = rec.getValue(col.ordinal)
+	}
+	snap.Records = append(snap.Records, srec)
+}
+
+// Rebuilds columns, records, keys and tags of the empty table from the snapshot.
+// Scheduled pushes of the snapshot are replayed with the write-ahead log.
+func (this *table) restore(snap *tableSnapshot) {
+	cols := make([]*column, len(snap.Columns))
+	for idx, name := range snap.Columns {
+		cols[idx], _ = this.getAddColumn(name)
+	}
+	for _, srec := range snap.Records {
+		for len(this.records) <= srec.Id {
+			addRecordToSlice(&this.records, nil)
+		}
+		if this.records[srec.Id] != nil {
+			logWarn("ignoring duplicate record", srec.Id, "in snapshot of table", this.name)
+			continue
+		}
+		rec := newRecord(len(this.colSlice), srec.Id)
+		rec.links = make([]link, 1)
+		for idx, val := range srec.Vals {
+			if idx < len(cols) {
+				rec.setValue(cols[idx].ordinal, val)
+			}
+		}
+		rec.priority = srec.Priority
+		rec.deliveries = srec.Deliveries
+		this.records[srec.Id] = rec
+		this.count++
+		this.linkRecord(rec, true)
+	}
+	// tag restored records
+	for _, name := range snap.Keys {
+		this.tagOrKeyColumn(name, columnTypeKey)
+	}
+	for _, name := range snap.Tags {
+		this.tagOrKeyColumn(name, columnTypeTag)
+	}
+}
+
+// Loads the dump of the table that was restored by a client into the empty table.
+// The dump is logged so that the table survives restart, scheduled pushes are logged again.
+func (this *table) load(snap *tableSnapshot) {
+	this.restore(snap)
+	if this.wal != nil {
+		logged := *snap
+		logged.Seq = 0
+		logged.Scheduled = nil
+		this.wal.append(&walEntry{Op: "restore", Snapshot: &logged})
+	}
+	for _, entry := range snap.Scheduled {
+		req := entry.pushRequest()
+		due := time.Unix(0, entry.Due)
+		this.scheduled.add(req, due, this.logSchedule(req, due))
+	}
+	this.publishSchemaColumns()
+	this.resetTimer()
+}
+
+// serializedSnapshot is a table snapshot serialized by the table event loop.
+type serializedSnapshot struct {
+	table string
+	seq   uint64
+	bytes []byte
+}
+
+// snapshotWriter collects snapshots serialized by table event loops and writes them to the snapshot file.
+type snapshotWriter struct {
+	path   string
+	count  int
+	tables chan *serializedSnapshot
+	// write-ahead log sequences of written tables
+	sequences map[string]uint64
+}
+
+// newSnapshotWriter returns writer that expects snapshots of count tables.
+func newSnapshotWriter(path string, count int) *snapshotWriter {
+	return &snapshotWriter{
+		path:      path,
+		count:     count,
+		tables:    make(chan *serializedSnapshot, count),
+		sequences: make(map[string]uint64, count),
+	}
+}
+
+// Serializes table snapshot, called by the table event loop.
+// It never blocks since the writer has room for snapshots of all tables.
+func (this *snapshotWriter) add(snap *tableSnapshot) {
+	bytes, err := json.Marshal(snap)
+	if err != nil {
+		logError("failed to serialize snapshot of table", snap.Table, err.Error())
+		bytes = nil
+	}
+	this.tables <- &serializedSnapshot{table: snap.Table, seq: snap.Seq, bytes: bytes}
+}
+
+// Waits for the next serialized table snapshot.
+func (this *snapshotWriter) next(quit *Quitter) (*serializedSnapshot, error) {
+	select {
+	case serialized := <-this.tables:
+		if serialized.bytes == nil {
+			return nil, errors.New("failed to serialize table " + serialized.table)
+		}
+		return serialized, nil
+	case <-quit.GetChan():
+		return nil, errors.New("server is shutting down")
+	}
+}
+
+// Waits for all table snapshots and atomically replaces the snapshot file.
+func (this *snapshotWriter) write(quit *Quitter) error {
+	temp := this.path + ".tmp"
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for i := 0; i < this.count && err == nil; i++ {
+		var serialized *serializedSnapshot
+		if serialized, err = this.next(quit); err != nil {
+			break
+		}
+		if _, err = writer.Write(serialized.bytes); err == nil {
+			err = writer.WriteByte('\n')
+			this.sequences[serialized.table] = serialized.seq
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err == nil {
+		err = os.Rename(temp, this.path)
+	}
+	if err != nil {
+		os.Remove(temp)
+	}
+	return err
+}
+
+// Reads table snapshots from the snapshot file.
+func readSnapshot(path string) ([]*tableSnapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var tables []*tableSnapshot
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return tables, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		snap := new(tableSnapshot)
+		if err = json.Unmarshal(line, snap); err != nil {
+			return nil, errors.New("invalid snapshot " + path + ": " + err.Error())
+		}
+		tables = append(tables, snap)
+	}
+}
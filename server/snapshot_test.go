@@ -0,0 +1,234 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import "encoding/json"
+import "path/filepath"
+import "testing"
+import "time"
+
+func tableRequestHelper(t *table, sql string) response {
+	pc := newTokens()
+	lex(sql, pc)
+	switch req := parse(pc).(type) {
+	case *sqlInsertRequest:
+		return t.sqlInsert(req)
+	case *sqlPushRequest:
+		return t.sqlPush(req)
+	case *sqlDeleteRequest:
+		return t.sqlDelete(req)
+	case *sqlKeyRequest:
+		return t.sqlKey(req)
+	case *sqlTagRequest:
+		return t.sqlTag(req)
+	case *sqlReserveRequest:
+		return t.sqlReserve(req)
+	}
+	return newErrorResponse("unexpected request " + sql)
+}
+
+func TestTableSnapshot(t *testing.T) {
+	tbl := newTable("jobs")
+	statements := []string{
+		" insert into jobs (name, owner) values (job1, ann) ",
+		" push into jobs (name, owner) values (job2, ann) ",
+		" push front into jobs (name) values (job0) ",
+		" push into jobs priority 5 (name, owner) values (job3, bob) ",
+		" insert ephemeral into jobs (name) values (job5) ",
+		" key jobs name ",
+		" delete from jobs where name = job1 ",
+		" tag jobs owner ",
+		" reserve front from jobs timeout 60s ",
+		" push into jobs (name) values (job4) delay 1h ",
+	}
+	for _, sql := range statements {
+		if _, ok := tableRequestHelper(tbl, sql).(*errorResponse); ok {
+			t.Errorf("unexpected error for %s", sql)
+		}
+	}
+	// serialize and restore
+	bytes, err := json.Marshal(tbl.snapshot())
+	if err != nil {
+		t.Fatalf("failed to serialize snapshot %s", err.Error())
+	}
+	snap := new(tableSnapshot)
+	if err = json.Unmarshal(bytes, snap); err != nil {
+		t.Fatalf("failed to deserialize snapshot %s", err.Error())
+	}
+	restored := newTable("jobs")
+	restored.restore(snap)
+	restored.replay(snap.Scheduled)
+	// ephemeral record is not restored
+	validateTableRecordsCount(t, restored, 4)
+	ASSERT_TRUE(t, restored.getRecord(0) == nil, "deleted record")
+	ASSERT_TRUE(t, restored.getColumn("name").isKey(), "key")
+	ASSERT_TRUE(t, restored.getTagedColumnValuesCount("owner", "ann") == 1, "tag ann")
+	ASSERT_TRUE(t, restored.getTagedColumnValuesCount("owner", "bob") == 1, "tag bob")
+	ASSERT_TRUE(t, len(restored.scheduled.pushes) == 1, "scheduled push")
+	// reserved record reappears with its priority
+	expected := []string{"job3", "job0", "job2"}
+	heads := restored.heads(true, 10)
+	if len(heads) != len(expected) {
+		t.Fatalf("expected %d records in the queue but got %d", len(expected), len(heads))
+	}
+	name := restored.getColumn("name").ordinal
+	for idx, rec := range heads {
+		validateRecordValue(t, rec, name, expected[idx])
+	}
+	ASSERT_TRUE(t, heads[0].deliveries == 1, "delivery count of reserved record")
+}
+
+func TestDataServiceSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pubsubsql.snapshot")
+	quit := NewQuitter()
+	dataSrv := newDataService(quit)
+	go dataSrv.run()
+	sender := newResponseSenderStub(1)
+	// snapshot path is required
+	dataSrv.acceptRequest(sqlHelper(" snapshot ", sender))
+	validateErrorResponse(t, sender.testRecv())
+	quit.Quit(time.Millisecond * 1000)
+	//
+	quit = NewQuitter()
+	dataSrv = newDataService(quit)
+	dataSrv.snapshotPath = path
+	go dataSrv.run()
+	dataSrv.acceptRequest(sqlHelper(" insert into stocks (ticker, bid) values (IBM, 123) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" key stocks ticker ", sender))
+	validateOkResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" push into jobs (name) values (job1) ", sender))
+	sender.testRecv()
+	dataSrv.acceptRequest(sqlHelper(" snapshot ", sender))
+	validateOkResponse(t, sender.testRecv())
+	quit.Quit(time.Millisecond * 1000)
+	// restore
+	quit = NewQuitter()
+	dataSrv = newDataService(quit)
+	if err := dataSrv.restore(path); err != nil {
+		t.Fatalf("failed to restore snapshot %s", err.Error())
+	}
+	go dataSrv.run()
+	dataSrv.acceptRequest(sqlHelper(" select * from stocks where ticker = IBM ", sender))
+	validateSqlSelect(t, sender.testRecv(), 1, 3)
+	dataSrv.acceptRequest(sqlHelper(" insert into stocks (ticker) values (IBM) ", sender))
+	validateErrorResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" pop front * from jobs ", sender))
+	validatePopRows(t, sender.testRecv(), 1)
+	quit.Quit(time.Millisecond * 1000)
+}
+
+func TestWriteAheadLogAfterSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "backup.snapshot")
+	quit, dataSrv := newLoggedDataService(t, dir)
+	dataSrv.snapshotPath = path
+	runLoggedDataService(t, quit, dataSrv, "")
+	sender := newResponseSenderStub(1)
+	dataSrv.acceptRequest(sqlHelper(" insert into stocks (ticker, bid) values (IBM, 123) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" snapshot ", sender))
+	validateOkResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" insert into stocks (ticker, bid) values (MSFT, 37) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	quit.Quit(time.Millisecond * 1000)
+	// entries included in the snapshot are not replayed again
+	quit = NewQuitter()
+	dataSrv = newDataService(quit)
+	dataSrv.wal, _ = newWriteAheadLog(dir, walSyncAlways, 0)
+	if err := dataSrv.restore(path); err != nil {
+		t.Fatalf("failed to restore snapshot %s", err.Error())
+	}
+	go dataSrv.run()
+	dataSrv.acceptRequest(sqlHelper(" select * from stocks ", sender))
+	validateSqlSelect(t, sender.testRecv(), 2, 3)
+	quit.Quit(time.Millisecond * 1000)
+}
+
+// Returns table dumps streamed by backup command.
+func backupHelper(t *testing.T, dataSrv *dataService, sender *responseSender) [][]byte {
+	dataSrv.acceptRequest(sqlHelper(" backup ", sender))
+	res, ok := sender.testRecv().(*cmdBackupResponse)
+	if !ok {
+		t.Fatalf("expected cmdBackupResponse")
+	}
+	validateResponseJSON(t, res)
+	var dumps [][]byte
+	for i := 0; i < res.tables; i++ {
+		res, ok := sender.testRecv().(*cmdBackupResponse)
+		if !ok || res.snapshot == nil {
+			t.Fatalf("expected table dump")
+		}
+		validateResponseJSON(t, res)
+		dumps = append(dumps, res.snapshot)
+	}
+	return dumps
+}
+
+func TestDataServiceBackupRestore(t *testing.T) {
+	quit := NewQuitter()
+	dataSrv := newDataService(quit)
+	go dataSrv.run()
+	sender := newResponseSenderStub(1)
+	dataSrv.acceptRequest(sqlHelper(" insert into stocks (ticker, bid) values (IBM, 123) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" insert into stocks (ticker, bid) values (MSFT, 37) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" key stocks ticker ", sender))
+	validateOkResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" push into jobs (name) values (job1) ", sender))
+	sender.testRecv()
+	dataSrv.acceptRequest(sqlHelper(" push into jobs (name) values (job2) delay 1h ", sender))
+	sender.testRecv()
+	dumps := backupHelper(t, dataSrv, sender)
+	ASSERT_TRUE(t, len(dumps) == 2, "expected dumps of 2 tables")
+	quit.Quit(time.Millisecond * 1000)
+	// restore into empty server
+	dir := t.TempDir()
+	quit, dataSrv = startLoggedDataService(t, dir)
+	for _, dump := range dumps {
+		dataSrv.acceptRequest(sqlHelper(" restore "+string(dump), sender))
+		validateOkResponse(t, sender.testRecv())
+	}
+	// table must not exist
+	dataSrv.acceptRequest(sqlHelper(" restore "+string(dumps[0]), sender))
+	validateErrorResponse(t, sender.testRecv())
+	// server restored by another connection is not empty
+	sender2 := newResponseSenderStub(2)
+	dataSrv.acceptRequest(sqlHelper(" restore "+string(dumps[0]), sender2))
+	validateErrorResponse(t, sender2.testRecv())
+	// tables added by other connections end the restore
+	dataSrv.acceptRequest(sqlHelper(" insert into orders (ticker) values (IBM) ", sender2))
+	validateSqlInsertResponse(t, sender2.testRecv())
+	dataSrv.acceptRequest(sqlHelper(` restore {"table":"quotes","records":[]} `, sender))
+	validateErrorResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" select * from stocks where ticker = MSFT ", sender))
+	validateSqlSelect(t, sender.testRecv(), 1, 3)
+	dataSrv.acceptRequest(sqlHelper(" insert into stocks (ticker) values (IBM) ", sender))
+	validateErrorResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" pop front * from jobs ", sender))
+	validatePopRows(t, sender.testRecv(), 1)
+	quit.Quit(time.Millisecond * 1000)
+	// restored tables are replayed from the write-ahead log
+	quit, dataSrv = startLoggedDataService(t, dir)
+	dataSrv.acceptRequest(sqlHelper(" select * from stocks ", sender))
+	validateSqlSelect(t, sender.testRecv(), 2, 3)
+	dataSrv.acceptRequest(sqlHelper(" select * from jobs ", sender))
+	validateSqlSelect(t, sender.testRecv(), 0, 2)
+	ASSERT_TRUE(t, len(dataSrv.tables["jobs"].scheduled.pushes) == 1, "expected scheduled push")
+	quit.Quit(time.Millisecond * 1000)
+}
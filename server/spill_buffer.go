@@ -0,0 +1,110 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+var errSpillBufferFull = errors.New("spill buffer is full")
+
+// spillBuffer is a bounded disk buffer of network ready responses
+// for client connections that can not keep up with responses.
+type spillBuffer struct {
+	file   *os.File
+	limit  int64
+	size   int64  // bytes written
+	offset int64  // bytes read
+	head   []byte // next message that was read but not yet consumed
+}
+
+// spillBuffer factory
+func newSpillBuffer(limit int64) (*spillBuffer, error) {
+	file, err := ioutil.TempFile("", "pubsubsql-spill-")
+	if err != nil {
+		return nil, err
+	}
+	return &spillBuffer{
+		file:  file,
+		limit: limit,
+	}, nil
+}
+
+// Returns true when all spilled messages were consumed.
+func (this *spillBuffer) empty() bool {
+	return this.head == nil && this.offset == this.size
+}
+
+// Writes response messages to the buffer.
+// Returns errSpillBufferFull when the response does not fit into the buffer.
+func (this *spillBuffer) write(res response) error {
+	var data []byte
+	for more := true; more; {
+		var msg []byte
+		msg, more = res.toNetworkReadyJSON()
+		var header [4]byte
+		binary.BigEndian.PutUint32(header[:], uint32(len(msg)))
+		data = append(data, header[:]...)
+		data = append(data, msg...)
+	}
+	if this.size+int64(len(data)) > this.limit {
+		return errSpillBufferFull
+	}
+	if _, err := this.file.WriteAt(data, this.size); err != nil {
+		return err
+	}
+	this.size += int64(len(data))
+	return nil
+}
+
+// Returns next message without consuming it.
+func (this *spillBuffer) peek() ([]byte, error) {
+	if this.head != nil {
+		return this.head, nil
+	}
+	var header [4]byte
+	if _, err := this.file.ReadAt(header[:], this.offset); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint32(header[:]))
+	if _, err := this.file.ReadAt(msg, this.offset+4); err != nil {
+		return nil, err
+	}
+	this.offset += int64(4 + len(msg))
+	this.head = msg
+	return msg, nil
+}
+
+// Consumes message returned by peek.
+// The buffer is truncated once all messages are consumed.
+func (this *spillBuffer) pop() {
+	this.head = nil
+	if this.offset == this.size {
+		this.file.Truncate(0)
+		this.offset = 0
+		this.size = 0
+	}
+}
+
+// Closes and removes the buffer file.
+func (this *spillBuffer) close() {
+	this.file.Close()
+	os.Remove(this.file.Name())
+}
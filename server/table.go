@@ -19,6 +19,7 @@ package server
 import (
 	"strconv"
 	"sync/atomic"
+	"time"
 )
 
 // this function is purely for testing porposes
@@ -54,9 +55,48 @@ type table struct {
 	//
 	count     uint32
 	streaming bool
+	// pubsubid assigned to the next subscription, 0 allocates new one
+	pubsubid uint64
+	// where clause of the next subscription
+	filter string
+	// schema change events, number of columns already published
+	schema        *schemaBroker
+	schemaColumns int
+	// subscriptions of all connections for show and kill subscription
+	registry *subscriptionRegistry
 	//
 	last  *record
 	first *record
+	// number of ephemeral records per owning connection
+	ephemeral map[uint64]int
+	// subscriptions with arbitrary where clause
+	predicates []*predicatePubsub
+	// live aggregate subscriptions
+	aggregates []*aggregatePubsub
+	// ordered subscriptions with limit
+	tops []*topPubsub
+	// last change sequence number and most recent changes
+	sequence uint64
+	changes  *changeLog
+	// blocking pop requests in arrival order
+	waiters []*popWaiter
+	// reserved records by id
+	reservations map[int]*reservation
+	// deadlines of waiting pop requests and reservations
+	expiries expiryHeap
+	// push requests that are due later
+	scheduled schedule
+	// records pushed with priority
+	prioritized priorityHeap
+	// fires at the earliest deadline of waiting pop requests, reservations and scheduled pushes
+	timer *time.Timer
+	// data service processing requests posted by the table
+	service *dataService
+	// triggers on the table and number of triggers that led to the current request
+	triggers []*trigger
+	depth    int
+	// write-ahead log of the table mutations, nil when logging is disabled
+	wal *tableLog
 }
 
 // table factory
@@ -68,13 +108,27 @@ func newTable(name string) *table {
 		records:       make([]*record, 0, config.TABLE_RECORDS_CAPACITY),
 		tagedColumns:  make([]*column, 0, config.TABLE_COLUMNS_CAPACITY),
 		subscriptions: make(mapSubscriptionByConnection),
+		ephemeral:     make(map[uint64]int),
+		reservations:  make(map[int]*reservation),
+		sequence:      changeEpoch,
+		changes:       newChangeLog(config.TABLE_CHANGE_LOG_CAPACITY),
 		requestId:     0,
 		streaming:     false,
 	}
 	table.addColumn("id")
+	table.schemaColumns = len(table.colSlice)
 	return table
 }
 
+// Publishes columns added since the last call to schema subscribers.
+// Columns rolled back by a failed request are never published.
+func (this *table) publishSchemaColumns() {
+	for _, col := range this.colSlice[this.schemaColumns:] {
+		this.schema.publish("column", this.name, col.name)
+	}
+	this.schemaColumns = len(this.colSlice)
+}
+
 // COLUMNS functions
 
 // Returns total number of columns.
@@ -141,6 +195,52 @@ func (this *table) prepareRecord() (*record, int) {
 func (this *table) addNewRecord(rec *record, back bool) {
 	this.count++
 	addRecordToSlice(&this.records, rec)
+	this.linkRecord(rec, back)
+}
+
+// Returns record at the front or back of the queue.
+// Front of the queue is the oldest record with the highest priority when records were pushed with priority.
+func (this *table) head(front bool) *record {
+	if !front {
+		return this.last
+	}
+	if rec := this.prioritized.top(); rec != nil {
+		return rec
+	}
+	return this.first
+}
+
+// Returns up to count records from the front or back of the queue in the order they would be popped.
+// Count 0 means a single record.
+func (this *table) heads(front bool, count int) []*record {
+	if count == 0 {
+		count = 1
+	}
+	records := make([]*record, 0, count)
+	if !front {
+		for rec := this.last; rec != nil && len(records) < count; rec = rec.prev {
+			records = append(records, rec)
+		}
+		return records
+	}
+	// records pushed with priority go first
+	records = append(records, this.prioritized.first(count)...)
+	if len(records) == count {
+		return records
+	}
+	for rec := this.first; rec != nil && len(records) < count; rec = rec.next {
+		if rec.priority == 0 {
+			records = append(records, rec)
+		}
+	}
+	return records
+}
+
+// Links record to the front or back of the queue.
+func (this *table) linkRecord(rec *record, back bool) {
+	if rec.priority > 0 {
+		this.prioritized.add(rec)
+	}
 	// initial record
 	if this.first == nil {
 		this.first = rec
@@ -159,6 +259,27 @@ func (this *table) addNewRecord(rec *record, back bool) {
 	}
 }
 
+// Unlinks record from the queue.
+func (this *table) unlinkRecord(rec *record) {
+	if rec.priority > 0 {
+		this.prioritized.remove(rec)
+	}
+	if rec == this.last {
+		this.last = rec.prev
+	}
+	if rec == this.first {
+		this.first = rec.next
+	}
+	if rec.prev != nil {
+		rec.prev.next = rec.next
+	}
+	if rec.next != nil {
+		rec.next.prev = rec.prev
+	}
+	rec.prev = nil
+	rec.next = nil
+}
+
 // addRecordToSlice generic helper function that adds record to the slice and
 // automatically expands the slice
 func addRecordToSlice(records *[]*record, rec *record) {
@@ -195,20 +316,16 @@ func (this *table) deleteRecord(rec *record) {
 	if this.records[rec.id()] != nil {
 		this.count--
 		this.records[rec.id()] = nil
+		this.logDelete(rec)
 	}
-	//
-	if rec == this.last {
-		this.last = rec.prev
-	}
-	if rec == this.first {
-		this.first = rec.next
-	}
-	if rec.prev != nil {
-		rec.prev.next = rec.next
+	if rec.ephemeral {
+		this.removeEphemeral(rec.connectionId)
 	}
-	if rec.next != nil {
-		rec.next.prev = rec.prev
+	if resv := this.reservations[rec.id()]; resv != nil {
+		this.expiries.remove(resv.expiry)
+		delete(this.reservations, rec.id())
 	}
+	this.unlinkRecord(rec)
 }
 
 // Looks up record by id.
@@ -260,12 +377,27 @@ func (this *table) getRecordsByValue(val string, col *column) []*record {
 }
 
 // Retrieves records based on the supplied filter
+// Reserved records are hidden until they are acknowledged or released.
 func (this *table) getRecordsBySqlFilter(filter sqlFilter) ([]*record, response) {
 	e, col := this.validateSqlFilter(filter)
 	if e != nil {
 		return nil, e
 	}
-	return this.getRecordsByValue(filter.val, col), nil
+	return this.withoutReserved(this.getRecordsByValue(filter.val, col)), nil
+}
+
+// Returns records that are not reserved, records are returned as is when there are no reservations.
+func (this *table) withoutReserved(records []*record) []*record {
+	if len(this.reservations) == 0 {
+		return records
+	}
+	visible := make([]*record, 0, len(records))
+	for _, rec := range records {
+		if rec != nil && this.reservations[rec.id()] == nil {
+			visible = append(visible, rec)
+		}
+	}
+	return visible
 }
 
 // Looks up records by tag.
@@ -438,10 +570,11 @@ func (this *table) setReturningColumns(ret *returningColumns) (response, *[]*col
 // Proceses sql insert request by inserting record in the table.
 // On success returns sqlInsertResponse.
 func (this *table) sqlInsert(req *sqlInsertRequest) response {
-	return this.sqlInsertHelper(req, "insert", true)
+	return this.sqlInsertHelper(req, "insert", true, 0, 0)
 }
 
-func (this *table) sqlInsertHelper(req *sqlInsertRequest, action string, back bool) response {
+// Inserts record, scheduled is the sequence of the log entry that scheduled the push.
+func (this *table) sqlInsertHelper(req *sqlInsertRequest, action string, back bool, priority int, scheduled uint64) response {
 	rec, id := this.prepareRecord()
 	// validate unique keys constrain
 	cols := make([]*column, len(req.colVals))
@@ -464,7 +597,14 @@ func (this *table) sqlInsertHelper(req *sqlInsertRequest, action string, back bo
 	}
 	// ready to insert
 	this.bindRecord(cols, req.colVals, rec, id)
+	rec.priority = priority
 	this.addNewRecord(rec, back)
+	if req.ephemeral {
+		rec.ephemeral = true
+		rec.connectionId = req.connectionId
+		this.ephemeral[req.connectionId]++
+	}
+	this.logInsert(action, rec, back, scheduled)
 	res := &sqlActionDataResponse{action: action}
 	this.prepareSelectResponse(&res.sqlSelectResponse, retCols, 1)
 	this.addRecordToSelectResponse(&res.sqlSelectResponse, rec)
@@ -473,7 +613,61 @@ func (this *table) sqlInsertHelper(req *sqlInsertRequest, action string, back bo
 }
 
 func (this *table) sqlPush(req *sqlPushRequest) response {
-	return this.sqlInsertHelper(&req.sqlInsertRequest, "push", !req.front)
+	due := req.at
+	if req.delay > 0 {
+		due = time.Now().Add(req.delay)
+	}
+	if !due.IsZero() && due.After(time.Now()) {
+		this.scheduled.add(req, due, this.logSchedule(req, due))
+		this.resetTimer()
+		return &sqlScheduledPushResponse{due: due}
+	}
+	return this.sqlInsertHelper(&req.sqlInsertRequest, "push", !req.front, req.priority, 0)
+}
+
+// Pushes scheduled records that are due.
+func (this *table) pushScheduled() {
+	now := time.Now()
+	for push := this.scheduled.due(now); push != nil; push = this.scheduled.due(now) {
+		req := push.req
+		res := this.sqlInsertHelper(&req.sqlInsertRequest, "push", !req.front, req.priority, push.logged)
+		if errres, ok := res.(*errorResponse); ok {
+			logWarn("scheduled push into table", this.name, "failed:", errres.msg)
+			if push.logged > 0 {
+				this.wal.append(&walEntry{Op: "unschedule", Scheduled: push.logged})
+			}
+		}
+	}
+}
+
+// EPHEMERAL records
+
+// Decrements number of ephemeral records owned by the connection.
+func (this *table) removeEphemeral(connectionId uint64) {
+	count := this.ephemeral[connectionId] - 1
+	if count > 0 {
+		this.ephemeral[connectionId] = count
+	} else {
+		delete(this.ephemeral, connectionId)
+	}
+}
+
+// Deletes ephemeral records owned by the closed connection and publishes delete to subscribers.
+// Returns number of deleted records.
+func (this *table) sqlConnectionClosed(req *sqlConnectionClosedRequest) int {
+	if this.ephemeral[req.connectionId] == 0 {
+		return 0
+	}
+	deleted := 0
+	for _, rec := range this.records {
+		if rec != nil && rec.ephemeral && rec.connectionId == req.connectionId {
+			this.onDelete(rec)
+			this.deleteRecord(rec)
+			rec.free()
+			deleted++
+		}
+	}
+	return deleted
 }
 
 // SELECT sql statement
@@ -491,12 +685,54 @@ func (this *table) copyRecordsToSqlSelectResponse(res *sqlSelectResponse, record
 	}
 }
 
-func (this *table) copyRecordToSqlSelectResponse(res *sqlSelectResponse, rec *record) {
-	res.columns = this.colSlice
+// Copies record to pubsub response limited to subscription projected columns.
+func (this *table) copyRecordToPubsubResponse(res *sqlPubSubResponse, sub *subscription, sequence uint64, rec *record) {
+	res.pubsubid = sub.id
+	res.sequence = sequence
+	res.table = sub.table
+	res.columns = sub.columns
+	if res.columns == nil {
+		res.columns = this.colSlice
+	}
 	res.records = make([]*record, 0, 1)
 	res.copyRecordData(rec)
 }
 
+// Returns update response for the subscription or nil when update does not touch projected columns.
+// Conflated subscription receives all projected columns so that updates for the same record can be collapsed.
+// Old holds values before the update.
+func (this *table) newUpdateResponse(sub *subscription, sequence uint64, cols []*column, old *record, rec *record) *sqlActionUpdateResponse {
+	projected := sub.project(cols)
+	if projected == nil {
+		return nil
+	}
+	if !sub.conflate {
+		res := newSqlActionUpdateResponse(sub.id, sequence, projected, rec)
+		res.table = sub.table
+		if sub.oldValues && old != nil {
+			res.addOldValues(old)
+		}
+		return res
+	}
+	res := new(sqlActionUpdateResponse)
+	this.copyRecordToPubsubResponse(&res.sqlPubSubResponse, sub, sequence, rec)
+	res.conflate = true
+	return res
+}
+
+// Returns delete response for the subscription.
+// Subscription with old values receives the whole record regardless of projection.
+func (this *table) newDeleteResponse(sub *subscription, sequence uint64, rec *record) *sqlActionDeleteResponse {
+	res := new(sqlActionDeleteResponse)
+	this.copyRecordToPubsubResponse(&res.sqlPubSubResponse, sub, sequence, rec)
+	if sub.oldValues && sub.columns != nil {
+		res.columns = this.colSlice
+		res.records = res.records[:0]
+		res.copyRecordData(rec)
+	}
+	return res
+}
+
 func (this *table) prepareSelectResponse(res *sqlSelectResponse, columns *[]*column, rows int) bool {
 	if columns != nil && len(*columns) > 0 {
 		res.columns = *columns
@@ -539,12 +775,7 @@ func (this *table) sqlSelect(req *sqlSelectRequest) response {
 
 // PEEK
 func (this *table) sqlPeek(req *sqlPeekRequest) response {
-	var rec *record
-	if req.front {
-		rec = this.first
-	} else {
-		rec = this.last
-	}
+	records := this.heads(req.front, req.count)
 	// precreate columns
 	var columns []*column
 	if len(req.cols) > 0 {
@@ -557,8 +788,8 @@ func (this *table) sqlPeek(req *sqlPeekRequest) response {
 		columns = this.colSlice
 	}
 	res := newPeekResponse()
-	this.prepareSelectResponse(&res.sqlSelectResponse, &columns, 1)
-	if rec != nil {
+	this.prepareSelectResponse(&res.sqlSelectResponse, &columns, len(records))
+	for _, rec := range records {
 		this.addRecordToSelectResponse(&res.sqlSelectResponse, rec)
 	}
 	return res
@@ -605,7 +836,12 @@ func (this *table) sqlUpdate(req *sqlUpdateRequest) response {
 	this.prepareSelectResponse(&res.sqlSelectResponse, retCols, l)
 	for _, rec := range records {
 		if rec != nil {
+			matched := this.matchPredicates(rec)
+			old := rec.copyValues()
 			ra := this.updateRecord(cols[1:], req.colVals, rec, int(rec.id()))
+			this.logUpdate(rec, req.colVals)
+			this.logChange("update", cols, old, rec)
+			this.updateLiveQueries(old, rec)
 			if hasWhatToRemove(ra) {
 				this.onRemove(ra.removed, rec)
 			}
@@ -615,7 +851,9 @@ func (this *table) sqlUpdate(req *sqlUpdateRequest) response {
 				this.onAdd(ra.added, rec)
 			}
 			this.addRecordToSelectResponse(&res.sqlSelectResponse, rec)
-			this.onUpdate(cols, rec, added)
+			this.onUpdate(cols, old, rec, added)
+			this.onUpdatePredicates(cols, old, rec, matched)
+			this.fireTriggers("update", old, rec)
 		}
 	}
 	return res
@@ -650,28 +888,255 @@ func (this *table) sqlDelete(req *sqlDeleteRequest) response {
 
 // POP
 func (this *table) sqlPop(req *sqlPopRequest) response {
-	var rec *record
-	if req.front {
-		rec = this.first
-	} else {
-		rec = this.last
-	}
+	records := this.heads(req.front, req.count)
 	// validate returning columns
 	errres, retCols := this.setReturningColumns(&(req.returningColumns))
 	if errres != nil {
 		return errres
 	}
 	res := newPopResponse()
-	if rec != nil {
-		this.prepareSelectResponse(&res.sqlSelectResponse, retCols, 1)
+	if len(records) == 0 {
+		return res
+	}
+	this.prepareSelectResponse(&res.sqlSelectResponse, retCols, len(records))
+	for _, rec := range records {
 		this.addRecordToSelectResponse(&res.sqlSelectResponse, rec)
-		this.onDelete(rec)
+	}
+	this.onDeleteRecords(records)
+	for _, rec := range records {
 		this.deleteRecord(rec)
 		rec.free()
 	}
 	return res
 }
 
+// BLOCKING POP
+
+// popWaiter is a blocking pop request waiting for a record.
+type popWaiter struct {
+	req       *sqlPopRequest
+	sender    *responseSender
+	requestId uint32
+	streaming bool
+	expiry    *expiry
+}
+
+// Parks the pop request until a record arrives or the wait time expires.
+func (this *table) addPopWaiter(req *sqlPopRequest, sender *responseSender) {
+	waiter := &popWaiter{
+		req:       req,
+		sender:    sender,
+		requestId: this.requestId,
+		streaming: this.streaming,
+	}
+	waiter.expiry = &expiry{deadline: time.Now().Add(req.wait), waiter: waiter}
+	this.expiries.add(waiter.expiry)
+	this.waiters = append(this.waiters, waiter)
+	this.resetTimer()
+}
+
+// Completes waiting pop requests in arrival order while there are records.
+// Each record is popped by exactly one waiter.
+func (this *table) serveWaiters() {
+	if len(this.waiters) == 0 || this.first == nil {
+		return
+	}
+	for len(this.waiters) > 0 && this.first != nil {
+		waiter := this.waiters[0]
+		this.waiters[0] = nil
+		this.waiters = this.waiters[1:]
+		this.expiries.remove(waiter.expiry)
+		if waiter.sender.quit.Done() {
+			continue
+		}
+		this.sendToWaiter(waiter, this.sqlPop(waiter.req))
+	}
+	this.resetTimer()
+}
+
+// Completes waiting pop requests whose wait time expired with empty response.
+// Deadlines of expired requests were already removed from the heap.
+func (this *table) expireWaiters() {
+	waiting := this.waiters[:0]
+	for _, waiter := range this.waiters {
+		if waiter.expiry.pending() {
+			waiting = append(waiting, waiter)
+		} else {
+			this.sendToWaiter(waiter, newPopResponse())
+		}
+	}
+	for idx := len(waiting); idx < len(this.waiters); idx++ {
+		this.waiters[idx] = nil
+	}
+	this.waiters = waiting
+}
+
+func (this *table) sendToWaiter(waiter *popWaiter, res response) {
+	if waiter.streaming {
+		return
+	}
+	res.setRequestId(waiter.requestId)
+	waiter.sender.send(res)
+}
+
+// RESERVE
+
+// reservation is a record hidden from pop and peek until it is acknowledged or the timeout expires.
+type reservation struct {
+	rec        *record
+	expiry     *expiry
+	deadLetter string
+	attempts   int
+}
+
+// Processes sql reserve request.
+// Reserved record is unlinked from the queue but stays in the table hidden from select, update and delete.
+// Reservation is logged with the delivery count but does not survive restart,
+// the record reappears at the front of the queue and is delivered at least once.
+func (this *table) sqlReserve(req *sqlReserveRequest) response {
+	rec := this.head(req.front)
+	res := new(sqlReserveResponse)
+	if rec == nil {
+		return res
+	}
+	this.unlinkRecord(rec)
+	rec.deliveries++
+	this.logReserve(rec)
+	resv := &reservation{
+		rec:        rec,
+		deadLetter: req.deadLetter,
+		attempts:   req.attempts,
+	}
+	resv.expiry = &expiry{deadline: time.Now().Add(req.timeout), resv: resv}
+	this.expiries.add(resv.expiry)
+	this.reservations[rec.id()] = resv
+	this.prepareSelectResponse(&res.sqlSelectResponse, &this.colSlice, 1)
+	this.addRecordToSelectResponse(&res.sqlSelectResponse, rec)
+	res.deliveries = rec.deliveries
+	this.visitSubscriptions(rec, publishActionReserved)
+	this.resetTimer()
+	return res
+}
+
+// Returns reservation of the record with the id.
+func (this *table) getReservation(id string) (*reservation, response) {
+	idx, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, newErrorResponse("invalid record id " + id)
+	}
+	resv := this.reservations[idx]
+	if resv == nil {
+		return nil, newErrorResponse("record " + id + " is not reserved")
+	}
+	return resv, nil
+}
+
+// Processes sql ack request by deleting reserved record.
+// On success returns okResponse.
+func (this *table) sqlAckRecord(req *sqlAckRecordRequest) response {
+	resv, errRes := this.getReservation(req.id)
+	if errRes != nil {
+		return errRes
+	}
+	this.onDelete(resv.rec)
+	this.deleteRecord(resv.rec)
+	resv.rec.free()
+	return newOkResponse("ack")
+}
+
+// Processes sql nack request by returning reserved record to the front.
+// On success returns okResponse.
+func (this *table) sqlNackRecord(req *sqlNackRecordRequest) response {
+	resv, errRes := this.getReservation(req.id)
+	if errRes != nil {
+		return errRes
+	}
+	this.releaseReservation(resv)
+	this.resetTimer()
+	return newOkResponse("nack")
+}
+
+// Returns reserved record to the front of the queue or moves it to dead letter table
+// when it was reserved the maximum number of times.
+func (this *table) releaseReservation(resv *reservation) {
+	rec := resv.rec
+	this.expiries.remove(resv.expiry)
+	delete(this.reservations, rec.id())
+	if len(resv.deadLetter) > 0 && rec.deliveries >= resv.attempts {
+		this.moveToDeadLetter(resv.deadLetter, rec)
+		return
+	}
+	this.linkRecord(rec, false)
+	this.visitSubscriptions(rec, publishActionReleased)
+}
+
+// Inserts the record into dead letter table and deletes it.
+func (this *table) moveToDeadLetter(deadLetter string, rec *record) {
+	req := &sqlInsertRequest{}
+	req.table = deadLetter
+	for _, col := range this.colSlice[1:] {
+		if val := rec.getValue(col.ordinal); len(val) > 0 {
+			req.addColVal(col.name, val)
+		}
+	}
+	logInfo("record", rec.id(), "of table", this.name, "was moved to dead letter table", deadLetter, "after", rec.deliveries, "deliveries")
+	this.service.post(req, nil)
+	this.onDelete(rec)
+	this.deleteRecord(rec)
+	rec.free()
+}
+
+// Releases reservations whose timeout expired.
+// Returns true when wait time of any pop request expired.
+func (this *table) expire(now time.Time) bool {
+	expired := false
+	for exp := this.expiries.due(now); exp != nil; exp = this.expiries.due(now) {
+		if exp.resv != nil {
+			this.releaseReservation(exp.resv)
+		} else {
+			expired = true
+		}
+	}
+	return expired
+}
+
+// TIMER
+
+// Sets the timer to the earliest deadline of waiting pop requests, reservations and scheduled pushes.
+func (this *table) resetTimer() {
+	if this.timer != nil {
+		this.timer.Stop()
+		this.timer = nil
+	}
+	deadline := this.expiries.next()
+	if due := this.scheduled.next(); !due.IsZero() && (deadline.IsZero() || due.Before(deadline)) {
+		deadline = due
+	}
+	if !deadline.IsZero() {
+		this.timer = time.NewTimer(time.Until(deadline))
+	}
+}
+
+// Returns channel that fires at the earliest deadline, nil when there is nothing to wait for.
+func (this *table) timeout() <-chan time.Time {
+	if this.timer == nil {
+		return nil
+	}
+	return this.timer.C
+}
+
+// Expires waiting pop requests and reservations and pushes scheduled records that are due.
+func (this *table) onTimer() {
+	this.depth = 0
+	expired := this.expire(time.Now())
+	this.pushScheduled()
+	this.serveWaiters()
+	if expired {
+		this.expireWaiters()
+	}
+	this.resetTimer()
+}
+
 // Key sql statement
 
 // Processes sql key requesthis.
@@ -702,6 +1167,7 @@ func (this *table) sqlKey(req *sqlKeyRequest) response {
 	}
 	//
 	this.tagOrKeyColumn(req.column, columnTypeKey)
+	this.logIndex("key", req.column)
 	return newOkResponse("key")
 }
 
@@ -712,6 +1178,12 @@ func (this *table) tagOrKeyColumn(c string, coltyp columnType) {
 	this.tagedColumns = append(this.tagedColumns, col)
 	col.makeTags(len(this.tagedColumns))
 	col.typ = coltyp
+	this.publishSchemaColumns()
+	if coltyp == columnTypeKey {
+		this.schema.publish("key", this.name, col.name)
+	} else {
+		this.schema.publish("tag", this.name, col.name)
+	}
 	// tag existing values
 	for idx, rec := range this.records {
 		if rec != nil {
@@ -730,15 +1202,20 @@ func (this *table) sqlTag(req *sqlTagRequest) response {
 	}
 	//
 	this.tagOrKeyColumn(req.column, columnTypeTag)
+	this.logIndex("tag", req.column)
 	return newOkResponse("tag")
 }
 
 // SUBSCRIBE sql statement
 
 func (this *table) newSubscription(sender *responseSender) *subscription {
-	val := atomic.AddUint64(&subid, 1)
+	val := this.pubsubid
+	if val == 0 {
+		val = atomic.AddUint64(&subid, 1)
+	}
 	sub := newSubscription(sender, val)
 	this.subscriptions.add(sender.connectionId, sub)
+	this.registry.add(sub, this.name, this.filter)
 	return sub
 }
 
@@ -804,23 +1281,462 @@ func (this *table) subscribe(col *column, val string, sender *responseSender, sk
 	return nil, nil
 }
 
+// Returns where clause predicate for subscriptions that can not be served by id, key or tag.
+func (this *table) getSubscribePredicate(filter sqlFilter) *sqlPredicate {
+	if filter.predicate != nil {
+		return filter.predicate
+	}
+	col := this.getColumn(filter.col)
+	if col != nil && col.typ == columnTypeNormal {
+		return &sqlPredicate{
+			conditions: []*sqlCondition{{col: filter.col, op: "=", val: filter.val}},
+		}
+	}
+	return nil
+}
+
+// Binds predicate conditions to table columns.
+// Returns errorResponse on error.
+func (this *table) bindPredicate(predicate *sqlPredicate) (response, *predicatePubsub) {
+	pred := &predicatePubsub{
+		conditions: make([]condition, len(predicate.conditions)),
+	}
+	for idx, cond := range predicate.conditions {
+		col := this.getColumn(cond.col)
+		if col == nil {
+			return newErrorResponse("invalid column: " + cond.col), nil
+		}
+		pred.conditions[idx] = condition{col: col, op: cond.op, val: cond.val}
+	}
+	return nil, pred
+}
+
+func (this *table) subscribeToPredicate(pred *predicatePubsub, sender *responseSender, skip bool) (*subscription, []*record) {
+	sub := this.newSubscription(sender)
+	pred.add(sub)
+	this.predicates = append(this.predicates, pred)
+	this.send(sender, newSubscribeResponse(sub))
+	var records []*record
+	if !skip {
+		for _, rec := range this.records {
+			if rec != nil && pred.match(rec) {
+				records = append(records, rec)
+			}
+		}
+	}
+	return sub, records
+}
+
+// Returns projected columns for subscription, id column is always included.
+// Returns nil when all columns are published.
+// Unknown column is an error, except for wildcard subscription which skips columns this table does not have
+// unless the table was just created for it.
+func (this *table) getProjectedColumns(req *sqlSubscribeRequest, created bool) (response, []*column) {
+	if !req.useColumns() {
+		return nil, nil
+	}
+	columns := make([]*column, 1, len(req.cols)+1)
+	columns[0] = this.colSlice[0]
+	for _, colName := range req.cols {
+		col := this.getColumn(colName)
+		if col == nil && req.pubsubid != 0 {
+			if !created {
+				continue
+			}
+			col, _ = this.getAddColumn(colName)
+		}
+		if col == nil {
+			return newErrorResponse("column: " + colName + " does not exist"), nil
+		}
+		if col != columns[0] {
+			columns = append(columns, col)
+		}
+	}
+	return nil, columns
+}
+
+// Adds where clause columns to the table that was just created for wildcard subscription.
+func (this *table) addFilterColumns(filter sqlFilter) {
+	if filter.predicate != nil {
+		for _, cond := range filter.predicate.conditions {
+			this.getAddColumn(cond.col)
+		}
+	} else if len(filter.col) > 0 {
+		this.getAddColumn(filter.col)
+	}
+}
+
 // Processes sql subscribe requesthis.
 // Does not return anything, responses are send directly to response this.
 func (this *table) sqlSubscribe(req *sqlSubscribeRequest) {
-	// validate
-	errRes, col := this.validateSqlFilter(req.filter)
+	// wildcard subscription shares pubsubid assigned by data service
+	this.pubsubid = req.pubsubid
+	this.filter = req.filter.String()
+	defer func() {
+		this.pubsubid = 0
+		this.filter = ""
+	}()
+	if req.durableSub != nil {
+		if sub := req.durableSub.subscription(); sub != nil {
+			this.attachDurable(sub, req)
+			return
+		}
+	}
+	// wildcard subscription on a table without records was created by the insert that is still to come
+	created := req.pubsubid != 0 && len(this.records) == 0
+	if created {
+		this.addFilterColumns(req.filter)
+	}
+	if len(req.aggregates) > 0 {
+		this.subscribeToAggregates(req, created)
+		return
+	}
+	errRes, columns := this.getProjectedColumns(req, created)
 	if errRes != nil {
 		this.send(req.sender, errRes)
 		return
 	}
-	// subscribe
-	sub, records := this.subscribe(col, req.filter.val, req.sender, req.skip)
-	if sub != nil && len(records) > 0 && this.count > 0 {
+	if len(req.orderBy) > 0 {
+		this.subscribeToTop(req, columns, created)
+		return
+	}
+	var sub *subscription
+	var records []*record
+	// pred limits replayed changes for resumed subscription
+	var pred *predicatePubsub
+	if predicate := this.getSubscribePredicate(req.filter); predicate != nil {
+		// arbitrary where clause
+		errRes, pred = this.bindPredicate(predicate)
+		if errRes != nil {
+			this.send(req.sender, errRes)
+			return
+		}
+		sub, records = this.subscribeToPredicate(pred, req.sender, req.skip)
+	} else {
+		// validate
+		var col *column
+		errRes, col = this.validateSqlFilter(req.filter)
+		if errRes != nil {
+			this.send(req.sender, errRes)
+			return
+		}
+		// subscribe
+		sub, records = this.subscribe(col, req.filter.val, req.sender, req.skip)
+		if col != nil {
+			pred = &predicatePubsub{
+				conditions: []condition{{col: col, op: "=", val: req.filter.val}},
+			}
+		}
+	}
+	if sub == nil {
+		return
+	}
+	sub.columns = columns
+	sub.conflate = req.conflate
+	sub.oldValues = req.oldValues
+	sub.throttle = req.throttle
+	if req.pubsubid != 0 {
+		sub.table = this.name
+	}
+	if req.durableSub != nil {
+		req.durableSub.bind(sub, this.filter)
+	}
+	// resume from sequence number or fall back to full snapshot
+	if req.resume && this.replayChanges(sub, pred, req.sequence) {
+		return
+	}
+	if len(records) > 0 && this.count > 0 {
 		// publish initial action add
 		this.publishActionAdd(sub, records)
 	}
 }
 
+// Attaches existing durable subscription to the connection that subscribed with the same durable name.
+// Subscription keeps its original where clause and options, unacknowledged events are redelivered.
+func (this *table) attachDurable(sub *subscription, req *sqlSubscribeRequest) {
+	if sub.sender != req.sender {
+		this.subscriptions.move(req.sender.connectionId, sub)
+		sub.sender = req.sender
+		this.registry.add(sub, this.name, req.durableSub.filter)
+	}
+	this.send(req.sender, newSubscribeResponse(sub))
+	req.durableSub.attach(req.sender)
+}
+
+// LIVE QUERIES
+
+// Applies record change to aggregate and ordered subscriptions.
+// Old holds values before the change and is nil for insert, rec is nil for delete.
+func (this *table) updateLiveQueries(old *record, rec *record) {
+	this.updateAggregates(old, rec)
+	this.updateTops(old, rec)
+}
+
+// AGGREGATES
+
+// Binds subscription where clause to table columns.
+// Returns errorResponse on error.
+func (this *table) bindFilterConditions(filter sqlFilter) (response, []condition) {
+	if filter.predicate != nil {
+		errRes, pred := this.bindPredicate(filter.predicate)
+		if errRes != nil {
+			return errRes, nil
+		}
+		return nil, pred.conditions
+	}
+	if len(filter.col) == 0 {
+		return nil, nil
+	}
+	col := this.getColumn(filter.col)
+	if col == nil {
+		return newErrorResponse("invalid column: " + filter.col), nil
+	}
+	return nil, []condition{{col: col, op: "=", val: filter.val}}
+}
+
+// Subscribes to aggregates computed over records matching the where clause
+// and publishes their initial values.
+func (this *table) subscribeToAggregates(req *sqlSubscribeRequest, created bool) {
+	if req.resume {
+		this.send(req.sender, newErrorResponse("sequence is not supported for aggregate subscription"))
+		return
+	}
+	errRes, conditions := this.bindFilterConditions(req.filter)
+	if errRes != nil {
+		this.send(req.sender, errRes)
+		return
+	}
+	aggregates := make([]*aggregate, len(req.aggregates))
+	for idx, a := range req.aggregates {
+		var col *column
+		if a.col != "*" {
+			col = this.getColumn(a.col)
+			if col == nil && created {
+				col, _ = this.getAddColumn(a.col)
+			}
+			if col == nil {
+				this.send(req.sender, newErrorResponse("column: "+a.col+" does not exist"))
+				return
+			}
+		}
+		aggregates[idx] = newAggregate(a.fn, col)
+	}
+	agg := newAggregatePubsub(conditions, aggregates)
+	for _, rec := range this.records {
+		if rec != nil {
+			agg.apply(nil, rec)
+		}
+	}
+	sub := this.newSubscription(req.sender)
+	sub.throttle = req.throttle
+	if req.pubsubid != 0 {
+		sub.table = this.name
+	}
+	if req.durableSub != nil {
+		req.durableSub.bind(sub, this.filter)
+	}
+	agg.add(sub)
+	this.aggregates = append(this.aggregates, agg)
+	this.send(req.sender, newSubscribeResponse(sub))
+	this.publishAggregate(agg)
+}
+
+// Publishes aggregate values when they changed since last published.
+func (this *table) publishAggregate(agg *aggregatePubsub) {
+	rec := agg.values()
+	if rec == nil {
+		return
+	}
+	visitor := func(sub *subscription) bool {
+		res := new(sqlActionAggregateResponse)
+		res.pubsubid = sub.id
+		res.sequence = this.sequence
+		res.table = sub.table
+		res.columns = agg.columns
+		res.records = []*record{rec}
+		return sub.send(res)
+	}
+	agg.visit(visitor)
+}
+
+// Applies record change to aggregate subscriptions, old is nil for insert and rec is nil for delete.
+// Aggregates without active subscriptions are removed.
+func (this *table) updateAggregates(old *record, rec *record) {
+	if len(this.aggregates) == 0 {
+		return
+	}
+	active := this.aggregates[:0]
+	for _, agg := range this.aggregates {
+		if agg.count() == 0 {
+			continue
+		}
+		if agg.apply(old, rec) {
+			this.publishAggregate(agg)
+		}
+		active = append(active, agg)
+	}
+	for idx := len(active); idx < len(this.aggregates); idx++ {
+		this.aggregates[idx] = nil
+	}
+	this.aggregates = active
+}
+
+// ORDER BY
+
+// Subscribes to the first limit records ordered by a column that match the where clause
+// and publishes them as initial action add.
+func (this *table) subscribeToTop(req *sqlSubscribeRequest, columns []*column, created bool) {
+	if req.resume {
+		this.send(req.sender, newErrorResponse("sequence is not supported for ordered subscription"))
+		return
+	}
+	errRes, conditions := this.bindFilterConditions(req.filter)
+	if errRes != nil {
+		this.send(req.sender, errRes)
+		return
+	}
+	col := this.getColumn(req.orderBy)
+	if col == nil && created {
+		col, _ = this.getAddColumn(req.orderBy)
+	}
+	if col == nil {
+		this.send(req.sender, newErrorResponse("column: "+req.orderBy+" does not exist"))
+		return
+	}
+	top := newTopPubsub(conditions, col, req.desc, req.limit)
+	top.init(this.records)
+	sub := this.newSubscription(req.sender)
+	sub.columns = columns
+	sub.conflate = req.conflate
+	sub.oldValues = req.oldValues
+	sub.throttle = req.throttle
+	if req.pubsubid != 0 {
+		sub.table = this.name
+	}
+	if req.durableSub != nil {
+		req.durableSub.bind(sub, this.filter)
+	}
+	top.add(sub)
+	this.tops = append(this.tops, top)
+	this.send(req.sender, newSubscribeResponse(sub))
+	if records := top.window(); !req.skip && len(records) > 0 {
+		this.publishActionAdd(sub, records)
+	}
+}
+
+// Applies record change to ordered subscriptions and publishes changes of their windows.
+// Ordered subscriptions without active subscriptions are removed.
+func (this *table) updateTops(old *record, rec *record) {
+	if len(this.tops) == 0 {
+		return
+	}
+	live := rec
+	if live == nil {
+		live = old
+	}
+	active := this.tops[:0]
+	for _, top := range this.tops {
+		if top.count() == 0 {
+			continue
+		}
+		left, entered, changed := top.apply(old, rec, live)
+		visitor := func(sub *subscription) bool {
+			if changed {
+				res := new(sqlActionUpdateResponse)
+				this.copyRecordToPubsubResponse(&res.sqlPubSubResponse, sub, this.sequence, live)
+				res.conflate = sub.conflate
+				if sub.oldValues && old != nil {
+					res.addOldValues(old)
+				}
+				return sub.send(res)
+			}
+			if left != nil {
+				res := new(sqlActionRemoveResponse)
+				this.copyRecordToPubsubResponse(&res.sqlPubSubResponse, sub, this.sequence, left)
+				if !sub.send(res) {
+					return false
+				}
+			}
+			if entered != nil {
+				res := new(sqlActionAddResponse)
+				this.copyRecordToPubsubResponse(&res.sqlPubSubResponse, sub, this.sequence, entered)
+				return sub.send(res)
+			}
+			return true
+		}
+		if changed || left != nil || entered != nil {
+			top.visit(visitor)
+		}
+		active = append(active, top)
+	}
+	for idx := len(active); idx < len(this.tops); idx++ {
+		this.tops[idx] = nil
+	}
+	this.tops = active
+}
+
+// CHANGE LOG
+
+// Assigns next sequence number to the change and retains it in the change log.
+func (this *table) logChange(action string, cols []*column, old *record, rec *record) {
+	this.sequence++
+	this.changes.add(&change{
+		sequence: this.sequence,
+		action:   action,
+		cols:     cols,
+		old:      old,
+		rec:      rec.copyValues(),
+	})
+}
+
+// Publishes changes that followed the sequence number to resumed subscription.
+// Pred limits changes to the subscription result set, nil means the whole table.
+// Returns false when the change log no longer holds the missed changes.
+func (this *table) replayChanges(sub *subscription, pred *predicatePubsub, sequence uint64) bool {
+	changes, ok := this.changes.since(sequence, this.sequence)
+	if !ok {
+		return false
+	}
+	match := func(rec *record) bool {
+		return pred == nil || pred.match(rec)
+	}
+	for _, c := range changes {
+		var res response
+		switch c.action {
+		case "insert":
+			if match(c.rec) {
+				x := new(sqlActionInsertResponse)
+				this.copyRecordToPubsubResponse(&x.sqlPubSubResponse, sub, c.sequence, c.rec)
+				res = x
+			}
+		case "delete":
+			if match(c.rec) {
+				res = this.newDeleteResponse(sub, c.sequence, c.rec)
+			}
+		case "update":
+			was, now := match(c.old), match(c.rec)
+			switch {
+			case was && now:
+				if x := this.newUpdateResponse(sub, c.sequence, c.cols, c.old, c.rec); x != nil {
+					res = x
+				}
+			case now:
+				x := new(sqlActionAddResponse)
+				this.copyRecordToPubsubResponse(&x.sqlPubSubResponse, sub, c.sequence, c.rec)
+				res = x
+			case was:
+				x := new(sqlActionRemoveResponse)
+				this.copyRecordToPubsubResponse(&x.sqlPubSubResponse, sub, c.sequence, c.rec)
+				res = x
+			}
+		}
+		if res != nil && !sub.send(res) {
+			break
+		}
+	}
+	return true
+}
+
 // PUBSUB helpers
 type publishAction func(thisbl *table, sub *subscription, rec *record) bool
 
@@ -834,43 +1750,164 @@ func (this *table) visitSubscriptions(rec *record, publishActionFunc publishActi
 			lnk.pubsub.visit(f)
 		}
 	}
+	for _, pred := range this.predicates {
+		if pred.match(rec) {
+			pred.visit(f)
+		}
+	}
+	this.removeInactivePredicates()
+}
+
+// Removes predicate subscriptions that were unsubscribed or failed to deliver.
+func (this *table) removeInactivePredicates() {
+	active := this.predicates[:0]
+	for _, pred := range this.predicates {
+		if pred.count() > 0 {
+			active = append(active, pred)
+		}
+	}
+	for idx := len(active); idx < len(this.predicates); idx++ {
+		this.predicates[idx] = nil
+	}
+	this.predicates = active
+}
+
+// Evaluates every predicate subscription against the record.
+// Returns results by predicate, nil when table has no predicate subscriptions.
+func (this *table) matchPredicates(rec *record) map[*predicatePubsub]bool {
+	if len(this.predicates) == 0 {
+		return nil
+	}
+	matched := make(map[*predicatePubsub]bool, len(this.predicates))
+	for _, pred := range this.predicates {
+		matched[pred] = pred.match(rec)
+	}
+	return matched
 }
 
 func (this *table) publishActionAdd(sub *subscription, records []*record) bool {
 	res := new(sqlActionAddResponse)
 	res.pubsubid = sub.id
-	this.copyRecordsToSqlSelectResponse(&res.sqlSelectResponse, records, nil)
-	return sub.sender.send(res)
+	res.sequence = this.sequence
+	res.table = sub.table
+	this.copyRecordsToSqlSelectResponse(&res.sqlSelectResponse, records, sub.columns)
+	return sub.send(res)
 }
 
 func publishActionInsert(this *table, sub *subscription, rec *record) bool {
 	res := new(sqlActionInsertResponse)
-	res.pubsubid = sub.id
-	this.copyRecordToSqlSelectResponse(&res.sqlSelectResponse, rec)
-	return sub.sender.send(res)
+	this.copyRecordToPubsubResponse(&res.sqlPubSubResponse, sub, this.sequence, rec)
+	return sub.send(res)
+}
+
+func publishActionReserved(this *table, sub *subscription, rec *record) bool {
+	res := new(sqlActionReservedResponse)
+	this.copyRecordToPubsubResponse(&res.sqlPubSubResponse, sub, this.sequence, rec)
+	return sub.send(res)
+}
+
+func publishActionReleased(this *table, sub *subscription, rec *record) bool {
+	res := new(sqlActionReleasedResponse)
+	this.copyRecordToPubsubResponse(&res.sqlPubSubResponse, sub, this.sequence, rec)
+	return sub.send(res)
 }
 
 func publishActionDelete(this *table, sub *subscription, rec *record) bool {
-	res := new(sqlActionDeleteResponse)
-	res.pubsubid = sub.id
-	this.copyRecordToSqlSelectResponse(&res.sqlSelectResponse, rec)
-	return sub.sender.send(res)
+	return sub.send(this.newDeleteResponse(sub, this.sequence, rec))
 }
 
 func (this *table) onInsert(rec *record) {
+	this.logChange("insert", nil, nil, rec)
+	this.updateLiveQueries(nil, rec)
 	this.visitSubscriptions(rec, publishActionInsert)
+	this.fireTriggers("insert", nil, rec)
 }
 
 func (this *table) onDelete(rec *record) {
+	this.logChange("delete", nil, nil, rec)
+	this.updateLiveQueries(rec, nil)
 	this.visitSubscriptions(rec, publishActionDelete)
+	this.fireTriggers("delete", rec, nil)
+}
+
+// Posts statements of the triggers after the action to the data service.
+// Old or rec is nil when the action does not provide it.
+func (this *table) fireTriggers(action string, old *record, rec *record) {
+	for _, tr := range this.triggers {
+		// dropped trigger is removed from the table by the drop request that is still to come
+		if tr.action != action || tr.isDropped() {
+			continue
+		}
+		depth := this.depth + 1
+		if depth > config.TRIGGER_MAX_DEPTH {
+			tr.report("maximum trigger depth " + strconv.Itoa(config.TRIGGER_MAX_DEPTH) + " was exceeded")
+			continue
+		}
+		req, err := tr.bind(this.getColumn, old, rec)
+		if len(err) > 0 {
+			tr.report(err)
+			continue
+		}
+		req.(triggeredRequest).setTriggerDepth(depth)
+		this.service.post(req, tr.responses)
+	}
+}
+
+// Adds trigger to the table.
+func (this *table) sqlCreateTrigger(req *sqlCreateTriggerRequest) response {
+	this.triggers = append(this.triggers, req.trigger)
+	return newOkResponse("create")
+}
+
+// Removes trigger from the table.
+func (this *table) sqlDropTrigger(req *sqlDropTriggerRequest) response {
+	for idx, tr := range this.triggers {
+		if tr == req.trigger {
+			this.triggers = append(this.triggers[:idx], this.triggers[idx+1:]...)
+			break
+		}
+	}
+	return newOkResponse("drop")
+}
+
+// Publishes deletion of the records as one delete event per subscription.
+func (this *table) onDeleteRecords(records []*record) {
+	if len(records) == 1 {
+		this.onDelete(records[0])
+		return
+	}
+	var subs []*subscription
+	merged := make(map[*subscription]*sqlActionDeleteResponse)
+	collect := func(this *table, sub *subscription, rec *record) bool {
+		res := merged[sub]
+		if res == nil {
+			res = this.newDeleteResponse(sub, this.sequence, rec)
+			merged[sub] = res
+			subs = append(subs, sub)
+		} else {
+			res.sequence = this.sequence
+			res.copyRecordData(rec)
+		}
+		return true
+	}
+	for _, rec := range records {
+		this.logChange("delete", nil, nil, rec)
+		this.updateLiveQueries(rec, nil)
+		this.visitSubscriptions(rec, collect)
+	}
+	for _, sub := range subs {
+		sub.send(merged[sub])
+	}
+	for _, rec := range records {
+		this.fireTriggers("delete", rec, nil)
+	}
 }
 
 func (this *table) onRemove(pubsubs []*pubsub, rec *record) {
 	visitor := func(sub *subscription) bool {
 		res := new(sqlActionRemoveResponse)
-		res.pubsubid = sub.id
-		this.copyRecordToSqlSelectResponse(&res.sqlSelectResponse, rec)
-		return sub.sender.send(res)
+		this.copyRecordToPubsubResponse(&res.sqlPubSubResponse, sub, this.sequence, rec)
+		return sub.send(res)
 	}
 	for _, pubsub := range pubsubs {
 		pubsub.visit(visitor)
@@ -880,19 +1917,21 @@ func (this *table) onRemove(pubsubs []*pubsub, rec *record) {
 func (this *table) onAdd(added map[*pubsub]int, rec *record) {
 	visitor := func(sub *subscription) bool {
 		res := new(sqlActionAddResponse)
-		res.pubsubid = sub.id
-		this.copyRecordToSqlSelectResponse(&res.sqlSelectResponse, rec)
-		return sub.sender.send(res)
+		this.copyRecordToPubsubResponse(&res.sqlPubSubResponse, sub, this.sequence, rec)
+		return sub.send(res)
 	}
 	for pubsub, _ := range added {
 		pubsub.visit(visitor)
 	}
 }
 
-func (this *table) onUpdate(cols []*column, rec *record, added *map[*pubsub]int) {
+func (this *table) onUpdate(cols []*column, old *record, rec *record, added *map[*pubsub]int) {
 	visitor := func(sub *subscription) bool {
-		res := newSqlActionUpdateResponse(sub.id, cols, rec)
-		return sub.sender.send(res)
+		res := this.newUpdateResponse(sub, this.sequence, cols, old, rec)
+		if res == nil {
+			return true
+		}
+		return sub.send(res)
 	}
 	this.pubsub.visit(visitor)
 	for _, lnk := range rec.links {
@@ -906,6 +1945,49 @@ func (this *table) onUpdate(cols []*column, rec *record, added *map[*pubsub]int)
 	}
 }
 
+// Publishes update to predicate subscriptions the record stayed in,
+// add when the record entered and remove when the record left the result set.
+// Matched holds predicate results evaluated before the update.
+// Predicates subscribed after the results were evaluated are skipped.
+func (this *table) onUpdatePredicates(cols []*column, old *record, rec *record, matched map[*predicatePubsub]bool) {
+	if len(matched) == 0 {
+		return
+	}
+	update := func(sub *subscription) bool {
+		res := this.newUpdateResponse(sub, this.sequence, cols, old, rec)
+		if res == nil {
+			return true
+		}
+		return sub.send(res)
+	}
+	add := func(sub *subscription) bool {
+		res := new(sqlActionAddResponse)
+		this.copyRecordToPubsubResponse(&res.sqlPubSubResponse, sub, this.sequence, rec)
+		return sub.send(res)
+	}
+	remove := func(sub *subscription) bool {
+		res := new(sqlActionRemoveResponse)
+		this.copyRecordToPubsubResponse(&res.sqlPubSubResponse, sub, this.sequence, rec)
+		return sub.send(res)
+	}
+	for _, pred := range this.predicates {
+		before, evaluated := matched[pred]
+		if !evaluated {
+			continue
+		}
+		now := pred.match(rec)
+		switch {
+		case before && now:
+			pred.visit(update)
+		case now:
+			pred.visit(add)
+		case before:
+			pred.visit(remove)
+		}
+	}
+	this.removeInactivePredicates()
+}
+
 // UNSUBSCRIBE
 
 // Processes sql unsubscribe requesthis.
@@ -946,6 +2028,8 @@ func (this *table) run() {
 			}
 			this.requestId = item.getRequestId()
 			this.onSqlRequest(item.req, item.sender)
+		case <-this.timeout():
+			this.onTimer()
 		case <-this.quit.GetChan():
 			debug("table quit")
 			return
@@ -955,6 +2039,7 @@ func (this *table) run() {
 
 func (this *table) onSqlRequest(req request, sender *responseSender) {
 	this.streaming = req.isStreaming()
+	this.depth = triggerDepth(req)
 	switch req.(type) {
 	case *sqlInsertRequest:
 		this.onSqlInsert(req.(*sqlInsertRequest), sender)
@@ -966,6 +2051,16 @@ func (this *table) onSqlRequest(req request, sender *responseSender) {
 		this.onSqlPeek(req.(*sqlPeekRequest), sender)
 	case *sqlPopRequest:
 		this.onSqlPop(req.(*sqlPopRequest), sender)
+	case *sqlCreateTriggerRequest:
+		this.send(sender, this.sqlCreateTrigger(req.(*sqlCreateTriggerRequest)))
+	case *sqlDropTriggerRequest:
+		this.send(sender, this.sqlDropTrigger(req.(*sqlDropTriggerRequest)))
+	case *sqlReserveRequest:
+		this.send(sender, this.sqlReserve(req.(*sqlReserveRequest)))
+	case *sqlAckRecordRequest:
+		this.send(sender, this.sqlAckRecord(req.(*sqlAckRecordRequest)))
+	case *sqlNackRecordRequest:
+		this.send(sender, this.sqlNackRecord(req.(*sqlNackRecordRequest)))
 	case *sqlUpdateRequest:
 		this.onSqlUpdate(req.(*sqlUpdateRequest), sender)
 	case *sqlDeleteRequest:
@@ -982,10 +2077,17 @@ func (this *table) onSqlRequest(req request, sender *responseSender) {
 		this.onSqlKey(req.(*sqlKeyRequest), sender)
 	case *sqlTagRequest:
 		this.onSqlTag(req.(*sqlTagRequest), sender)
+	case *sqlConnectionClosedRequest:
+		this.onSqlConnectionClosed(req.(*sqlConnectionClosedRequest))
+	case *sqlSnapshotRequest:
+		req.(*sqlSnapshotRequest).writer.add(this.snapshot())
 	}
+	this.publishSchemaColumns()
+	this.serveWaiters()
 }
 
 func (this *table) onSqlInsert(req *sqlInsertRequest, sender *responseSender) {
+	req.connectionId = sender.connectionId
 	res := this.sqlInsert(req)
 	this.send(sender, res)
 }
@@ -1004,6 +2106,10 @@ func (this *table) onSqlPeek(req *sqlPeekRequest, sender *responseSender) {
 }
 
 func (this *table) onSqlPop(req *sqlPopRequest, sender *responseSender) {
+	if req.wait > 0 && this.first == nil {
+		this.addPopWaiter(req, sender)
+		return
+	}
 	this.send(sender, this.sqlPop(req))
 }
 
@@ -1046,3 +2152,9 @@ func (this *table) onSqlKey(req *sqlKeyRequest, sender *responseSender) {
 func (this *table) onSqlTag(req *sqlTagRequest, sender *responseSender) {
 	this.send(sender, this.sqlTag(req))
 }
+
+func (this *table) onSqlConnectionClosed(req *sqlConnectionClosedRequest) {
+	if deleted := this.sqlConnectionClosed(req); deleted > 0 {
+		logInfo("deleted", deleted, "ephemeral records from table", this.name, "; connection:", req.connectionId)
+	}
+}
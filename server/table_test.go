@@ -19,6 +19,7 @@ package server
 import "testing"
 import "strconv"
 import "reflect"
+import "time"
 
 func validateTableRecordsCount(t *testing.T, tbl *table, expected int) {
 	val := tbl.getRecordCount()
@@ -139,6 +140,36 @@ func BenchmarkTableSqlInser(b *testing.B) {
 	}
 }
 
+func TestTableEphemeral(t *testing.T) {
+	tbl := newTable("users")
+	insert := func(sql string, connectionId uint64) {
+		pc := newTokens()
+		lex(sql, pc)
+		req := parse(pc).(*sqlInsertRequest)
+		req.connectionId = connectionId
+		validateSqlInsertResponse(t, tbl.sqlInsert(req))
+	}
+	insert("insert ephemeral into users (name) values (john)", 1)
+	insert("insert ephemeral into users (name) values (mary)", 2)
+	insert("insert into users (name) values (admin)", 1)
+	insert("insert ephemeral into users (name) values (john2)", 1)
+	res, sender := subscribeHelper(tbl, "subscribe skip * from users")
+	validateSqlSubscribeResponse(t, res)
+	// connection without ephemeral records
+	ASSERT_TRUE(t, tbl.sqlConnectionClosed(&sqlConnectionClosedRequest{connectionId: 3}) == 0, "expected no deleted records")
+	validateNoResponse(t, sender)
+	// owning connection closed
+	ASSERT_TRUE(t, tbl.sqlConnectionClosed(&sqlConnectionClosedRequest{connectionId: 1}) == 2, "expected 2 deleted records")
+	validateActionDelete(t, []*responseSender{sender, sender})
+	validateNoResponse(t, sender)
+	res = selectHelper(tbl, "select * from users")
+	validateSqlSelect(t, res, 2, 2)
+	// deleted ephemeral records are no longer tracked
+	deleteHelper(tbl, "delete from users where id = 1")
+	validateActionDelete(t, []*responseSender{sender})
+	ASSERT_TRUE(t, len(tbl.ephemeral) == 0, "expected no ephemeral records")
+}
+
 // SELECT
 
 func selectHelper(t *table, sqlSelect string) response {
@@ -1038,6 +1069,350 @@ func TestTableActionRemove(t *testing.T) {
 
 }
 
+func TestTablePredicateSubscription(t *testing.T) {
+	tbl := newTable("orders")
+	insertHelper(tbl, " insert into orders (status, amount) values (open, 5000) ")
+	insertHelper(tbl, " insert into orders (status, amount) values (open, 500) ")
+	insertHelper(tbl, " insert into orders (status, amount) values (closed, 7000) ")
+	// invalid column
+	res, sender := subscribeHelper(tbl, "subscribe * from orders where status = open and invalidcol > 1")
+	validateErrorResponse(t, res)
+	validateNoResponse(t, sender)
+	// initial add contains only matching records
+	res, sender = subscribeHelper(tbl, "subscribe * from orders where status = 'open' and amount > 1000")
+	sub := validateSqlSubscribeResponse(t, res)
+	validateSqlActionAddResponse(t, sender, sub.pubsubid, 1)
+	senders := []*responseSender{sender}
+	// single condition on non indexed column
+	res, sender = subscribeHelper(tbl, "subscribe skip * from orders where status = closed")
+	validateSqlSubscribeResponse(t, res)
+	validateNoResponse(t, sender)
+	closed := []*responseSender{sender}
+	// insert matching and not matching records
+	insertHelper(tbl, " insert into orders (status, amount) values (open, 1500) ")
+	validateActionInsert(t, senders)
+	validateNoResponse(t, closed[0])
+	insertHelper(tbl, " insert into orders (status, amount) values (open, 10) ")
+	validateNoResponse(t, senders[0])
+	// update within result set
+	updateHelper(tbl, " update orders set amount = 6000 where id = 0 ")
+	validateActionUpdate(t, senders)
+	// record enters result set
+	updateHelper(tbl, " update orders set amount = 2000 where id = 1 ")
+	validateActionAdd(t, senders)
+	// record leaves result set
+	updateHelper(tbl, " update orders set status = closed where id = 1 ")
+	validateActionRemove(t, senders)
+	validateActionAdd(t, closed)
+	// update outside of result set
+	updateHelper(tbl, " update orders set amount = 20 where id = 4 ")
+	validateNoResponse(t, senders[0])
+	// delete
+	deleteHelper(tbl, " delete from orders where id = 0 ")
+	validateActionDelete(t, senders)
+	validateNoResponse(t, closed[0])
+	// unsubscribe removes predicate subscriptions
+	validateSqlUnsubscribe(t, unsubscribeHelper(tbl, "unsubscribe from orders", 0), 2)
+	insertHelper(tbl, " insert into orders (status, amount) values (open, 1500) ")
+	validateNoResponse(t, senders[0])
+	ASSERT_TRUE(t, len(tbl.predicates) == 0, "expected no predicate subscriptions")
+}
+
+func TestTablePredicateSubscriptionRemovedDuringUpdate(t *testing.T) {
+	tbl := newTable("orders")
+	insertHelper(tbl, " insert into orders (status, amount) values (open, 500) ")
+	res, low := subscribeHelper(tbl, "subscribe skip * from orders where amount > 100")
+	validateSqlSubscribeResponse(t, res)
+	res, high := subscribeHelper(tbl, "subscribe skip * from orders where amount > 1000")
+	validateSqlSubscribeResponse(t, res)
+	rec := tbl.getRecord(0)
+	matched := tbl.matchPredicates(rec)
+	// predicates are compacted before the update is published
+	tbl.predicates = tbl.predicates[1:]
+	col := tbl.getColumn("amount")
+	rec.setValue(col.ordinal, "2000")
+	tbl.onUpdatePredicates([]*column{tbl.colSlice[0], col}, nil, rec, matched)
+	validateActionAdd(t, []*responseSender{high})
+	validateNoResponse(t, low)
+}
+
+func validateProjectedColumns(t *testing.T, sender *responseSender, columns ...string) {
+	res := sender.tryRecv()
+	var cols []*column
+	switch res.(type) {
+	case *sqlActionAddResponse:
+		cols = res.(*sqlActionAddResponse).columns
+	case *sqlActionInsertResponse:
+		cols = res.(*sqlActionInsertResponse).columns
+	case *sqlActionUpdateResponse:
+		cols = res.(*sqlActionUpdateResponse).columns
+	case *sqlActionDeleteResponse:
+		cols = res.(*sqlActionDeleteResponse).columns
+	default:
+		t.Errorf("table projection error: invalid response type %T", res)
+		return
+	}
+	if len(cols) != len(columns) {
+		t.Errorf("table projection error: expected %d columns but got %d", len(columns), len(cols))
+		return
+	}
+	for idx, col := range cols {
+		if col.name != columns[idx] {
+			t.Errorf("table projection error: expected column %s but got %s", columns[idx], col.name)
+		}
+	}
+	validateResponseJSON(t, res)
+}
+
+func TestTableSubscriptionProjection(t *testing.T) {
+	tbl := newTable("stocks")
+	keyHelper(tbl, "key stocks ticker")
+	insertHelper(tbl, " insert into stocks (ticker, bid, ask) values (IBM, 12, 14) ")
+	// key subscription
+	res, sender := subscribeHelper(tbl, "subscribe ticker, bid from stocks where ticker = IBM")
+	validateSqlSubscribeResponse(t, res)
+	validateProjectedColumns(t, sender, "id", "ticker", "bid")
+	// predicate subscription
+	res, predicate := subscribeHelper(tbl, "subscribe skip bid from stocks where ask > 10")
+	validateSqlSubscribeResponse(t, res)
+	validateNoResponse(t, predicate)
+	// update not touching projected columns is suppressed
+	updateHelper(tbl, " update stocks set ask = 15 where ticker = IBM ")
+	validateNoResponse(t, sender)
+	validateNoResponse(t, predicate)
+	// update touching projected columns
+	updateHelper(tbl, " update stocks set ask = 16, bid = 13 where ticker = IBM ")
+	validateProjectedColumns(t, sender, "id", "bid")
+	validateProjectedColumns(t, predicate, "id", "bid")
+	// delete
+	deleteHelper(tbl, " delete from stocks ")
+	validateProjectedColumns(t, sender, "id", "ticker", "bid")
+	validateProjectedColumns(t, predicate, "id", "bid")
+	// insert into table subscription
+	res, sender = subscribeHelper(tbl, "subscribe skip id, ask from stocks")
+	validateSqlSubscribeResponse(t, res)
+	insertHelper(tbl, " insert into stocks (ticker, bid, ask) values (MSFT, 12, 14) ")
+	validateProjectedColumns(t, sender, "id", "ask")
+	// unknown column is not added to the table
+	res, _ = subscribeHelper(tbl, "subscribe tickr from stocks")
+	validateErrorResponse(t, res)
+	ASSERT_TRUE(t, tbl.getColumn("tickr") == nil, "expected column tickr to not exist")
+}
+
+func TestTableSubscriptionFromSequence(t *testing.T) {
+	tbl := newTable("stocks")
+	tagHelper(tbl, "tag stocks sector")
+	insertHelper(tbl, " insert into stocks (ticker, bid, sector) values (IBM, 12, TECH) ")
+	insertHelper(tbl, " insert into stocks (ticker, bid, sector) values (JPM, 40, FIN) ")
+	ASSERT_TRUE(t, tbl.sequence == changeEpoch+2, "expected table sequence 2")
+	// sequences of the current epoch
+	sequence := func(n uint64) string {
+		return strconv.FormatUint(changeEpoch+n, 10)
+	}
+	// resume table subscription receives only missed changes
+	updateHelper(tbl, " update stocks set bid = 13 where id = 0 ")
+	deleteHelper(tbl, " delete from stocks where id = 1 ")
+	res, sender := subscribeHelper(tbl, "subscribe * from stocks from sequence "+sequence(2))
+	validateSqlSubscribeResponse(t, res)
+	validateActionUpdate(t, []*responseSender{sender})
+	validateActionDelete(t, []*responseSender{sender})
+	validateNoResponse(t, sender)
+	// resume tag subscription receives remove when record left the tag
+	updateHelper(tbl, " update stocks set sector = FIN where id = 0 ")
+	res, sender = subscribeHelper(tbl, "subscribe * from stocks where sector = TECH from sequence "+sequence(3))
+	validateSqlSubscribeResponse(t, res)
+	validateActionRemove(t, []*responseSender{sender})
+	validateNoResponse(t, sender)
+	// up to date subscription receives nothing
+	res, sender = subscribeHelper(tbl, "subscribe * from stocks from sequence "+strconv.FormatUint(tbl.sequence, 10))
+	validateSqlSubscribeResponse(t, res)
+	validateNoResponse(t, sender)
+	// sequence ahead of the table falls back to full snapshot
+	res, sender = subscribeHelper(tbl, "subscribe * from stocks from sequence "+sequence(1000))
+	sub := validateSqlSubscribeResponse(t, res)
+	validateSqlActionAddResponse(t, sender, sub.pubsubid, 1)
+	// sequence handed out before restart falls back to full snapshot
+	res, sender = subscribeHelper(tbl, "subscribe * from stocks from sequence 2")
+	sub = validateSqlSubscribeResponse(t, res)
+	validateSqlActionAddResponse(t, sender, sub.pubsubid, 1)
+	// truncated change log falls back to full snapshot
+	tbl.changes = newChangeLog(1)
+	updateHelper(tbl, " update stocks set bid = 14 where id = 0 ")
+	updateHelper(tbl, " update stocks set bid = 15 where id = 0 ")
+	res, sender = subscribeHelper(tbl, "subscribe * from stocks from sequence "+sequence(2))
+	sub = validateSqlSubscribeResponse(t, res)
+	validateSqlActionAddResponse(t, sender, sub.pubsubid, 1)
+}
+
+func TestTableConflatedSubscription(t *testing.T) {
+	tbl := newTable("stocks")
+	insertHelper(tbl, " insert into stocks (ticker, bid, ask) values (IBM, 12, 14) ")
+	insertHelper(tbl, " insert into stocks (ticker, bid, ask) values (MSFT, 30, 31) ")
+	res, sender := subscribeHelper(tbl, "subscribe skip * from stocks conflate")
+	validateSqlSubscribeResponse(t, res)
+	// fill the queue so that updates are held back
+	sender.sender = make(chan response, 1)
+	insertHelper(tbl, " insert into stocks (ticker, bid, ask) values (ORCL, 20, 21) ")
+	updateHelper(tbl, " update stocks set bid = 13 where id = 0 ")
+	updateHelper(tbl, " update stocks set bid = 31 where id = 1 ")
+	updateHelper(tbl, " update stocks set ask = 15 where id = 0 ")
+	ASSERT_TRUE(t, !sender.quit.Done(), "conflated subscriber should not be disconnected")
+	validateActionInsert(t, []*responseSender{sender})
+	sender.refill()
+	update, ok := sender.testRecv().(*sqlActionUpdateResponse)
+	ASSERT_TRUE(t, ok, "expected update response")
+	ASSERT_TRUE(t, len(update.records) == 2, "expected 2 conflated records")
+	// all columns with latest values
+	ASSERT_TRUE(t, len(update.columns) == 4, "expected all columns")
+	ibm := update.records[0]
+	ASSERT_TRUE(t, ibm.getValue(1) == "IBM" && ibm.getValue(2) == "13" && ibm.getValue(3) == "15", "expected latest IBM values")
+	ASSERT_TRUE(t, update.sequence == tbl.sequence, "expected sequence of the last update")
+	validateNoResponse(t, sender)
+}
+
+func TestTableThrottledSubscription(t *testing.T) {
+	tbl := newTable("stocks")
+	res, sender := subscribeHelper(tbl, "subscribe * from stocks throttle 50ms")
+	sub := validateSqlSubscribeResponse(t, res)
+	defer sender.release()
+	// first insert is sent right away
+	insertHelper(tbl, " insert into stocks (ticker, bid) values (IBM, 12) ")
+	validateActionInsert(t, []*responseSender{sender})
+	// following inserts are batched until the interval expires
+	insertHelper(tbl, " insert into stocks (ticker, bid) values (MSFT, 30) ")
+	insertHelper(tbl, " insert into stocks (ticker, bid) values (ORCL, 20) ")
+	updateHelper(tbl, " update stocks set bid = 13 where id = 0 ")
+	validateNoResponse(t, sender)
+	insert, ok := sender.testRecv().(*sqlActionInsertResponse)
+	ASSERT_TRUE(t, ok && insert.pubsubid == sub.pubsubid, "expected insert response")
+	ASSERT_TRUE(t, len(insert.records) == 2, "expected 2 batched records")
+	validateActionUpdate(t, []*responseSender{sender})
+	// pending batch is discarded on unsubscribe
+	insertHelper(tbl, " insert into stocks (ticker, bid) values (JPM, 40) ")
+	validateSqlUnsubscribe(t, unsubscribeHelper(tbl, "unsubscribe from stocks", 0), 1)
+	time.Sleep(100 * time.Millisecond)
+	validateNoResponse(t, sender)
+}
+
+func validateAggregateValues(t *testing.T, sender *responseSender, values ...string) {
+	res, ok := sender.tryRecv().(*sqlActionAggregateResponse)
+	if !ok {
+		t.Errorf("table aggregate error: expected sqlActionAggregateResponse")
+		return
+	}
+	validateResponseJSON(t, res)
+	rec := res.records[0]
+	for idx, val := range values {
+		if rec.getValue(idx) != val {
+			t.Errorf("table aggregate error: expected %s but got %s for %s", val, rec.getValue(idx), res.columns[idx].name)
+		}
+	}
+}
+
+func TestTableAggregateSubscription(t *testing.T) {
+	tbl := newTable("orders")
+	insertHelper(tbl, " insert into orders (status, amount) values (open, 10) ")
+	insertHelper(tbl, " insert into orders (status, amount) values (open, 20) ")
+	insertHelper(tbl, " insert into orders (status, amount) values (closed, 40) ")
+	res, sender := subscribeHelper(tbl, "subscribe count(*), sum(amount), min(amount), max(amount) from orders where status = open")
+	validateSqlSubscribeResponse(t, res)
+	validateAggregateValues(t, sender, "2", "30", "10", "20")
+	// insert
+	insertHelper(tbl, " insert into orders (status, amount) values (open, 5) ")
+	validateAggregateValues(t, sender, "3", "35", "5", "20")
+	// record enters and leaves the result set
+	updateHelper(tbl, " update orders set status = open where id = 2 ")
+	validateAggregateValues(t, sender, "4", "75", "5", "40")
+	updateHelper(tbl, " update orders set status = closed where id = 0 ")
+	validateAggregateValues(t, sender, "3", "65", "5", "40")
+	// change outside of the result set is not published
+	updateHelper(tbl, " update orders set amount = 100 where id = 0 ")
+	validateNoResponse(t, sender)
+	// delete
+	deleteHelper(tbl, " delete from orders where id = 2 ")
+	validateAggregateValues(t, sender, "2", "25", "5", "20")
+	// unsubscribed aggregate is removed
+	unsubscribeHelper(tbl, "unsubscribe from orders", 0)
+	insertHelper(tbl, " insert into orders (status, amount) values (open, 1) ")
+	validateNoResponse(t, sender)
+	ASSERT_TRUE(t, len(tbl.aggregates) == 0, "expected aggregate to be removed")
+	// invalid where clause column
+	res, sender = subscribeHelper(tbl, "subscribe count(*) from orders where region = EU")
+	validateErrorResponse(t, res)
+	// unknown aggregate column is not added to the table
+	res, sender = subscribeHelper(tbl, "subscribe sum(amuont) from orders")
+	validateErrorResponse(t, res)
+	ASSERT_TRUE(t, tbl.getColumn("amuont") == nil, "expected column not to be added")
+}
+
+func validateTopResponse(t *testing.T, res response, ids ...string) {
+	var records []*record
+	switch res.(type) {
+	case *sqlActionAddResponse:
+		records = res.(*sqlActionAddResponse).records
+	case *sqlActionRemoveResponse:
+		records = res.(*sqlActionRemoveResponse).records
+	case *sqlActionUpdateResponse:
+		records = res.(*sqlActionUpdateResponse).records
+	default:
+		t.Errorf("table order by error: unexpected response %T", res)
+		return
+	}
+	if len(records) != len(ids) {
+		t.Errorf("table order by error: expected %d records but got %d", len(ids), len(records))
+		return
+	}
+	for idx, id := range ids {
+		if records[idx].getValue(0) != id {
+			t.Errorf("table order by error: expected id %s but got %s", id, records[idx].getValue(0))
+		}
+	}
+}
+
+func TestTableOrderedSubscription(t *testing.T) {
+	tbl := newTable("scores")
+	insertHelper(tbl, " insert into scores (player, points) values (ann, 10) ")
+	insertHelper(tbl, " insert into scores (player, points) values (bob, 30) ")
+	insertHelper(tbl, " insert into scores (player, points) values (cid, 20) ")
+	insertHelper(tbl, " insert into scores (player, points) values (dan, 5) ")
+	res, sender := subscribeHelper(tbl, "subscribe * from scores order by points desc limit 2")
+	validateSqlSubscribeResponse(t, res)
+	add, _ := sender.tryRecv().(*sqlActionAddResponse)
+	validateTopResponse(t, add, "1", "2")
+	// change outside of the window
+	updateHelper(tbl, " update scores set points = 6 where id = 3 ")
+	validateNoResponse(t, sender)
+	// record enters the window and pushes the last one out
+	updateHelper(tbl, " update scores set points = 25 where id = 0 ")
+	remove, ok := sender.tryRecv().(*sqlActionRemoveResponse)
+	ASSERT_TRUE(t, ok, "expected remove response")
+	validateTopResponse(t, remove, "2")
+	add, ok = sender.tryRecv().(*sqlActionAddResponse)
+	ASSERT_TRUE(t, ok, "expected add response")
+	validateTopResponse(t, add, "0")
+	// change within the window
+	updateHelper(tbl, " update scores set points = 40 where id = 0 ")
+	validateTopResponse(t, sender.tryRecv(), "0")
+	// insert below the window
+	insertHelper(tbl, " insert into scores (player, points) values (eve, 1) ")
+	validateNoResponse(t, sender)
+	// delete within the window refills it from the ordered records
+	deleteHelper(tbl, " delete from scores where id = 1 ")
+	remove, ok = sender.tryRecv().(*sqlActionRemoveResponse)
+	ASSERT_TRUE(t, ok, "expected remove response")
+	validateTopResponse(t, remove, "1")
+	add, ok = sender.tryRecv().(*sqlActionAddResponse)
+	ASSERT_TRUE(t, ok, "expected add response")
+	validateTopResponse(t, add, "2")
+	validateNoResponse(t, sender)
+	ASSERT_TRUE(t, len(tbl.tops) == 1, "expected ordered subscription")
+	// unknown order by column is not added to the table
+	res, sender = subscribeHelper(tbl, "subscribe * from scores order by pionts limit 2")
+	validateErrorResponse(t, res)
+	ASSERT_TRUE(t, tbl.getColumn("pionts") == nil, "expected column not to be added")
+	ASSERT_TRUE(t, len(tbl.tops) == 1, "expected ordered subscription")
+}
+
 // UNSUBSCRIBE
 
 func unsubscribeHelper(t *table, sqlUnsubscribe string, connectionId uint64) response {
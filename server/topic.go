@@ -0,0 +1,130 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import "sync/atomic"
+
+// topic is a named channel for plain messages that are not stored in any table.
+type topic struct {
+	name          string
+	pubsub        pubsub
+	subscriptions mapSubscriptionByConnection
+}
+
+// topic factory
+func newTopic(name string) *topic {
+	return &topic{
+		name:          name,
+		subscriptions: make(mapSubscriptionByConnection),
+	}
+}
+
+// Removes subscription from the connection subscriptions, pubsub removes it when it is visited next time.
+func (this *topic) remove(sub *subscription) {
+	connectionId := sub.sender.connectionId
+	this.subscriptions.deactivate(connectionId, sub.id)
+	if len(this.subscriptions[connectionId]) == 0 {
+		delete(this.subscriptions, connectionId)
+	}
+}
+
+// topicBroker is a collection container for topics.
+// It is owned by dataService and is only accessed from the data service event loop.
+type topicBroker struct {
+	topics   map[string]*topic
+	registry *subscriptionRegistry
+}
+
+// topicBroker factory
+func newTopicBroker() *topicBroker {
+	return &topicBroker{
+		topics: make(map[string]*topic),
+	}
+}
+
+// Retrieves existing topic or adds it if does not exist.
+func (this *topicBroker) getAddTopic(name string) *topic {
+	tpc := this.topics[name]
+	if tpc == nil {
+		tpc = newTopic(name)
+		this.topics[name] = tpc
+	}
+	return tpc
+}
+
+// Removes topic that has no active subscriptions.
+func (this *topicBroker) removeIfEmpty(tpc *topic) {
+	if !tpc.pubsub.hasSubscriptions() {
+		delete(this.topics, tpc.name)
+	}
+}
+
+// Processes sql subscribe topic request.
+// On success returns sqlSubscribeResponse.
+func (this *topicBroker) subscribe(req *sqlSubscribeTopicRequest) response {
+	tpc := this.getAddTopic(req.topic)
+	sub := newSubscription(req.sender, atomic.AddUint64(&subid, 1))
+	tpc.subscriptions.add(req.sender.connectionId, sub)
+	tpc.pubsub.add(sub)
+	this.registry.add(sub, "", "topic "+tpc.name)
+	return newSubscribeResponse(sub)
+}
+
+// Processes sql unsubscribe topic request.
+// Unsubscribes all topic subscriptions for a given connection and returns sqlUnsubscribeResponse.
+func (this *topicBroker) unsubscribe(req *sqlUnsubscribeTopicRequest) response {
+	res := new(sqlUnsubscribeResponse)
+	tpc := this.topics[req.topic]
+	if tpc == nil {
+		return res
+	}
+	res.unsubscribed = tpc.subscriptions.deactivateAll(req.connectionId)
+	// visiting removes deactivated subscriptions
+	tpc.pubsub.count()
+	this.removeIfEmpty(tpc)
+	return res
+}
+
+// Processes sql publish request by delivering the message to every topic subscriber.
+// On success returns okResponse.
+func (this *topicBroker) publish(req *sqlPublishRequest) response {
+	tpc := this.topics[req.topic]
+	if tpc == nil {
+		return newOkResponse("publish")
+	}
+	visitor := func(sub *subscription) bool {
+		if sub.send(newActionPublishResponse(sub.id, tpc.name, req.message)) {
+			return true
+		}
+		// delivery fails only when the connection is closed or is being closed
+		tpc.remove(sub)
+		return false
+	}
+	tpc.pubsub.visit(visitor)
+	this.removeIfEmpty(tpc)
+	return newOkResponse("publish")
+}
+
+// Deactivates all topic subscriptions for a closed connection.
+func (this *topicBroker) connectionClosed(connectionId uint64) {
+	for _, tpc := range this.topics {
+		if tpc.subscriptions.deactivateAll(connectionId) > 0 {
+			tpc.pubsub.count()
+			this.removeIfEmpty(tpc)
+		}
+	}
+}
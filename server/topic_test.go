@@ -0,0 +1,82 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import "testing"
+
+func validateActionPublish(t *testing.T, sender *responseSender, pubsubid uint64, message string) {
+	res := sender.tryRecv()
+	switch res.(type) {
+	case *sqlActionPublishResponse:
+		x := res.(*sqlActionPublishResponse)
+		if x.pubsubid != pubsubid {
+			t.Errorf("invalid sqlActionPublishResponse pubsubid expected:%d but got:%d", pubsubid, x.pubsubid)
+		}
+		if x.message != message {
+			t.Errorf("invalid sqlActionPublishResponse message expected:%s but got:%s", message, x.message)
+		}
+		validateResponseJSON(t, res)
+	default:
+		t.Errorf("topic publish error: invalid response type expected sqlActionPublishResponse")
+	}
+}
+
+func TestTopicBroker(t *testing.T) {
+	broker := newTopicBroker()
+	sender1 := newResponseSenderStub(1)
+	sender2 := newResponseSenderStub(2)
+	// publish without subscribers
+	validateOkResponse(t, broker.publish(&sqlPublishRequest{topic: "news", message: "nobody"}))
+	ASSERT_TRUE(t, len(broker.topics) == 0, "expected no topics")
+	// subscribe
+	sub1 := validateSqlSubscribeResponse(t, broker.subscribe(&sqlSubscribeTopicRequest{topic: "news", sender: sender1}))
+	sub2 := validateSqlSubscribeResponse(t, broker.subscribe(&sqlSubscribeTopicRequest{topic: "news", sender: sender2}))
+	validateSqlSubscribeResponse(t, broker.subscribe(&sqlSubscribeTopicRequest{topic: "sports", sender: sender2}))
+	// publish
+	validateOkResponse(t, broker.publish(&sqlPublishRequest{topic: "news", message: "hello"}))
+	validateActionPublish(t, sender1, sub1.pubsubid, "hello")
+	validateActionPublish(t, sender2, sub2.pubsubid, "hello")
+	validateNoResponse(t, sender1)
+	validateNoResponse(t, sender2)
+	// unsubscribe
+	validateSqlUnsubscribe(t, broker.unsubscribe(&sqlUnsubscribeTopicRequest{topic: "news", connectionId: 1}), 1)
+	broker.publish(&sqlPublishRequest{topic: "news", message: "again"})
+	validateNoResponse(t, sender1)
+	validateActionPublish(t, sender2, sub2.pubsubid, "again")
+	// connection closed
+	broker.connectionClosed(2)
+	ASSERT_TRUE(t, len(broker.topics) == 0, "expected no topics")
+}
+
+func TestTopicBrokerPublishToClosedConnection(t *testing.T) {
+	broker := newTopicBroker()
+	sender1 := newResponseSenderStub(1)
+	sender2 := newResponseSenderStub(2)
+	validateSqlSubscribeResponse(t, broker.subscribe(&sqlSubscribeTopicRequest{topic: "news", sender: sender1}))
+	sub2 := validateSqlSubscribeResponse(t, broker.subscribe(&sqlSubscribeTopicRequest{topic: "news", sender: sender2}))
+	// failed delivery removes the subscription of the closed connection
+	sender1.quit.Quit(0)
+	validateOkResponse(t, broker.publish(&sqlPublishRequest{topic: "news", message: "hello"}))
+	validateActionPublish(t, sender2, sub2.pubsubid, "hello")
+	tpc := broker.topics["news"]
+	ASSERT_TRUE(t, tpc != nil && tpc.subscriptions[1] == nil, "expected subscription of closed connection to be removed")
+	ASSERT_TRUE(t, tpc.pubsub.count() == 1, "expected 1 active subscription")
+	// topic is removed with its last subscription
+	sender2.quit.Quit(0)
+	broker.publish(&sqlPublishRequest{topic: "news", message: "again"})
+	ASSERT_TRUE(t, len(broker.topics) == 0, "expected no topics")
+}
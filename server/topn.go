@@ -0,0 +1,147 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import "sort"
+
+// topEntry is a record in the ordered result set with the value it is ordered by.
+type topEntry struct {
+	rec *record
+	id  int
+	val string
+}
+
+// topPubsub delivers changes of the first records ordered by a column to a subscription.
+// All records matching the where clause are kept ordered so that the window can be refilled
+// without rescanning the table when records leave it. Limit 0 means no limit.
+type topPubsub struct {
+	predicatePubsub
+	col     *column
+	desc    bool
+	limit   int
+	ordered []*topEntry
+}
+
+// topPubsub factory
+func newTopPubsub(conditions []condition, col *column, desc bool, limit int) *topPubsub {
+	top := &topPubsub{
+		col:   col,
+		desc:  desc,
+		limit: limit,
+	}
+	top.conditions = conditions
+	return top
+}
+
+// Returns true when entry x is ordered before entry y, ties are ordered by record id.
+func (this *topPubsub) less(x *topEntry, y *topEntry) bool {
+	c := compareValues(x.val, y.val)
+	if this.desc {
+		c = -c
+	}
+	if c != 0 {
+		return c < 0
+	}
+	return x.id < y.id
+}
+
+// Returns index of the first entry that is not ordered before the entry.
+func (this *topPubsub) search(entry *topEntry) int {
+	return sort.Search(len(this.ordered), func(idx int) bool {
+		return !this.less(this.ordered[idx], entry)
+	})
+}
+
+// Adds matching records and orders them.
+func (this *topPubsub) init(records []*record) {
+	for _, rec := range records {
+		if rec != nil && this.match(rec) {
+			this.ordered = append(this.ordered, this.newEntry(rec, rec))
+		}
+	}
+	sort.Slice(this.ordered, func(x, y int) bool {
+		return this.less(this.ordered[x], this.ordered[y])
+	})
+}
+
+func (this *topPubsub) newEntry(live *record, values *record) *topEntry {
+	return &topEntry{
+		rec: live,
+		id:  live.id(),
+		val: values.getValue(this.col.ordinal),
+	}
+}
+
+// Returns records in the window in order.
+func (this *topPubsub) window() []*record {
+	l := len(this.ordered)
+	if this.limit > 0 && this.limit < l {
+		l = this.limit
+	}
+	records := make([]*record, l)
+	for idx := 0; idx < l; idx++ {
+		records[idx] = this.ordered[idx].rec
+	}
+	return records
+}
+
+// Returns true when position is within the window.
+func (this *topPubsub) inWindow(idx int) bool {
+	return idx >= 0 && (this.limit == 0 || idx < this.limit)
+}
+
+// Applies record change, old holds values before the change and is nil for insert,
+// rec is nil for delete. Live is the table record.
+// Returns record that left the window, record that entered the window and
+// true when live record changed within the window.
+func (this *topPubsub) apply(old *record, rec *record, live *record) (*record, *record, bool) {
+	removedAt, insertedAt := -1, -1
+	if old != nil && this.match(old) {
+		removedAt = this.search(this.newEntry(live, old))
+		if removedAt < len(this.ordered) && this.ordered[removedAt].rec == live {
+			this.ordered = append(this.ordered[:removedAt], this.ordered[removedAt+1:]...)
+		} else {
+			removedAt = -1
+		}
+	}
+	if rec != nil && this.match(rec) {
+		entry := this.newEntry(live, rec)
+		insertedAt = this.search(entry)
+		this.ordered = append(this.ordered, nil)
+		copy(this.ordered[insertedAt+1:], this.ordered[insertedAt:])
+		this.ordered[insertedAt] = entry
+	}
+	wasIn, isIn := this.inWindow(removedAt), this.inWindow(insertedAt)
+	var left, entered *record
+	switch {
+	case wasIn && isIn:
+		return nil, nil, true
+	case wasIn:
+		// live record left, the record following the window moved in
+		left = live
+		if this.limit > 0 && this.limit <= len(this.ordered) {
+			entered = this.ordered[this.limit-1].rec
+		}
+	case isIn:
+		// live record entered, the last record in the window moved out
+		entered = live
+		if this.limit > 0 && this.limit < len(this.ordered) {
+			left = this.ordered[this.limit].rec
+		}
+	}
+	return left, entered, false
+}
@@ -0,0 +1,166 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import "strings"
+
+// triggeredRequest is implemented by sql requests and tracks how many triggers led to the request.
+type triggeredRequest interface {
+	triggerDepth() int
+	setTriggerDepth(depth int)
+}
+
+// Returns number of triggers that led to the request.
+func triggerDepth(req request) int {
+	if treq, ok := req.(triggeredRequest); ok {
+		return treq.triggerDepth()
+	}
+	return 0
+}
+
+// trigger executes sql statement after records of the table are inserted, updated or deleted.
+// Statement refers to values of the changed record as new.column and old.column.
+type trigger struct {
+	name      string
+	table     string
+	action    string
+	statement string
+	// creator receives errors of the statements executed by the trigger
+	creator *responseSender
+	// responses to the statements executed by the trigger
+	responses *responseSender
+	// closed when the trigger is dropped
+	dropped chan struct{}
+}
+
+// trigger factory
+func newTrigger(req *sqlCreateTriggerRequest, creator *responseSender) *trigger {
+	responses := newResponseSenderStub(creator.connectionId)
+	responses.setPolicy(slowConsumerDropOldest, 0)
+	return &trigger{
+		name:      req.name,
+		table:     req.table,
+		action:    req.action,
+		statement: req.statement,
+		creator:   creator,
+		responses: responses,
+		dropped:   make(chan struct{}),
+	}
+}
+
+// run is an event loop function that reports errors of the statements executed by the trigger to its creator.
+func (this *trigger) run(quit *Quitter) {
+	quit.Join()
+	defer quit.Leave()
+	for {
+		select {
+		case res := <-this.responses.sender:
+			if errres, ok := res.(*errorResponse); ok {
+				this.report(errres.msg)
+			}
+		case <-this.dropped:
+			debug("trigger", this.name, "dropped")
+			return
+		case <-quit.GetChan():
+			debug("trigger", this.name, "exited due to quit notification")
+			return
+		}
+	}
+}
+
+// Stops the trigger event loop.
+// Must be called once and only by the data service.
+func (this *trigger) drop() {
+	close(this.dropped)
+}
+
+// Returns true when the trigger was dropped.
+func (this *trigger) isDropped() bool {
+	select {
+	case <-this.dropped:
+		return true
+	default:
+		return false
+	}
+}
+
+// Sends error to the trigger creator.
+func (this *trigger) report(msg string) {
+	logWarn("trigger", this.name, "on table", this.table, "failed:", msg)
+	this.creator.send(newErrorResponse("trigger " + this.name + " failed: " + msg))
+}
+
+// Scans and parses the trigger statement replacing new.column and old.column values with record values.
+// Old or rec is nil when the action does not provide it.
+// Returns error message on failure.
+func (this *trigger) bind(lookup func(string) *column, old *record, rec *record) (request, string) {
+	tokens := newTokens()
+	lex(this.statement, tokens)
+	for _, tok := range tokens.tokens {
+		if tok.typ != tokenTypeSqlValue {
+			continue
+		}
+		var source *record
+		var colName string
+		if strings.HasPrefix(tok.val, "new.") {
+			source, colName = rec, tok.val[len("new."):]
+		} else if strings.HasPrefix(tok.val, "old.") {
+			source, colName = old, tok.val[len("old."):]
+		} else {
+			continue
+		}
+		if source == nil {
+			return nil, tok.val + " is not available after " + this.action
+		}
+		col := lookup(colName)
+		if col == nil {
+			return nil, "invalid column: " + colName
+		}
+		tok.val = source.getValue(col.ordinal)
+	}
+	req := parse(tokens)
+	if errreq, ok := req.(*errorRequest); ok {
+		return nil, errreq.err
+	}
+	return req, ""
+}
+
+// Validates statement executed by trigger after the action.
+// Returns error message on failure.
+func validateTriggerStatement(action string, statement string) string {
+	tokens := newTokens()
+	lex(statement, tokens)
+	for _, tok := range tokens.tokens {
+		if tok.typ != tokenTypeSqlValue {
+			continue
+		}
+		if action == "insert" && strings.HasPrefix(tok.val, "old.") {
+			return tok.val + " is not available after insert"
+		}
+		if action == "delete" && strings.HasPrefix(tok.val, "new.") {
+			return tok.val + " is not available after delete"
+		}
+	}
+	req := parse(tokens)
+	switch req.(type) {
+	case *errorRequest:
+		return req.(*errorRequest).err
+	case *sqlInsertRequest, *sqlPushRequest, *sqlUpdateRequest, *sqlDeleteRequest, *sqlPublishRequest:
+		return ""
+	}
+	return "trigger statement must be insert, push, update, delete or publish"
+}
@@ -0,0 +1,605 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// walSyncPolicy defines when write-ahead log entries are flushed to disk.
+type walSyncPolicy int8
+
+const (
+	// fsync after every entry
+	walSyncAlways walSyncPolicy = iota
+	// fsync periodically
+	walSyncInterval
+	// leave flushing to the operating system
+	walSyncNever
+)
+
+// Converts sync policy name "always", "never" or "<N>ms" to walSyncPolicy and sync interval.
+func parseWalSyncPolicy(name string) (walSyncPolicy, time.Duration, bool) {
+	switch name {
+	case "always":
+		return walSyncAlways, 0, true
+	case "never":
+		return walSyncNever, 0, true
+	}
+	if strings.HasSuffix(name, "ms") {
+		ms, err := strconv.ParseUint(strings.TrimSuffix(name, "ms"), 10, 32)
+		if err == nil && ms > 0 {
+			return walSyncInterval, time.Duration(ms) * time.Millisecond, true
+		}
+	}
+	return walSyncAlways, 0, false
+}
+
+const walFileExtension = ".wal"
+
+// snapshot written by compaction, table logs keep entries that follow it
+const walSnapshotFile = "pubsubsql.snapshot"
+
+// walEntry is a mutation of the table recorded in the log, one JSON object per line.
+// Inserts and pushes carry all non empty values of the record so that replay does not depend on other entries.
+// Deletes are recorded for every removed record whether it was deleted, popped, acknowledged or moved to the dead letter table.
+type walEntry struct {
+	Seq      uint64   `json:"seq"`
+	Op       string   `json:"op"`
+	Id       int      `json:"id"`
+	Front    bool     `json:"front,omitempty"`
+	Priority int      `json:"priority,omitempty"`
+	Cols     []string `json:"cols,omitempty"`
+	Vals     []string `json:"vals,omitempty"`
+	// due time of scheduled push in unix nanoseconds
+	Due int64 `json:"due,omitempty"`
+	// sequence of the schedule entry completed by the push
+	Scheduled uint64 `json:"scheduled,omitempty"`
+	// dump of the table restored by a client
+	Snapshot *tableSnapshot `json:"snapshot,omitempty"`
+	// number of times the reserved record was delivered
+	Deliveries int `json:"deliveries,omitempty"`
+}
+
+// Returns column values of the entry.
+func (this *walEntry) columnValues() []*columnValue {
+	colVals := make([]*columnValue, 0, len(this.Cols))
+	for idx, col := range this.Cols {
+		if idx < len(this.Vals) {
+			colVals = append(colVals, &columnValue{col: col, val: this.Vals[idx]})
+		}
+	}
+	return colVals
+}
+
+// tableLog appends mutations of a single table to its log file.
+// It is written by the table event loop and synced by the write-ahead log.
+type tableLog struct {
+	mutex sync.Mutex
+	file  *os.File
+	seq   uint64
+	size  int64
+	sync  bool
+	dirty bool
+}
+
+// Appends entry to the log assigning it the next sequence number.
+// Returns sequence number of the entry, 0 when logging is disabled.
+func (this *tableLog) append(entry *walEntry) uint64 {
+	if this == nil {
+		return 0
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.file == nil {
+		return 0
+	}
+	this.seq++
+	entry.Seq = this.seq
+	bytes, err := json.Marshal(entry)
+	if err == nil {
+		var n int
+		n, err = this.file.Write(append(bytes, '\n'))
+		this.size += int64(n)
+	}
+	if err == nil && this.sync {
+		err = this.file.Sync()
+	}
+	if err != nil {
+		logError("failed to write log", this.file.Name(), err.Error())
+	}
+	this.dirty = !this.sync
+	return this.seq
+}
+
+// Returns sequence number of the last entry.
+func (this *tableLog) sequence() uint64 {
+	if this == nil {
+		return 0
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.seq
+}
+
+// Returns size of the log file.
+func (this *tableLog) fileSize() int64 {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.size
+}
+
+// Rewrites the log file without entries up to and including seq that are already in the snapshot.
+// Entries are not appended while the log is rewritten.
+func (this *tableLog) truncate(seq uint64) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.file == nil {
+		return nil
+	}
+	path := this.file.Name()
+	entries, _, err := readLog(path)
+	if err != nil {
+		return err
+	}
+	temp := path + ".tmp"
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	var size int64
+	for _, entry := range entries {
+		if entry.Seq <= seq || err != nil {
+			continue
+		}
+		var bytes []byte
+		if bytes, err = json.Marshal(entry); err == nil {
+			_, err = writer.Write(append(bytes, '\n'))
+			size += int64(len(bytes) + 1)
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err == nil {
+		err = os.Rename(temp, path)
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+	// continue appending to the rewritten file
+	this.file.Close()
+	this.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	this.size = size
+	this.dirty = false
+	return err
+}
+
+// Flushes entries written since the last sync to disk.
+func (this *tableLog) syncDirty() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.file != nil && this.dirty {
+		if err := this.file.Sync(); err != nil {
+			logError("failed to sync log", this.file.Name(), err.Error())
+		}
+		this.dirty = false
+	}
+}
+
+// Syncs and closes the log file, subsequent entries are ignored.
+func (this *tableLog) close() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.file != nil {
+		this.file.Sync()
+		this.file.Close()
+		this.file = nil
+	}
+}
+
+// writeAheadLog keeps append-only log file per table in the log directory.
+type writeAheadLog struct {
+	dir      string
+	policy   walSyncPolicy
+	interval time.Duration
+	mutex    sync.Mutex
+	logs     map[string]*tableLog
+}
+
+// newWriteAheadLog returns write-ahead log that keeps table logs in the directory, creating it if necessary.
+func newWriteAheadLog(dir string, policy walSyncPolicy, interval time.Duration) (*writeAheadLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &writeAheadLog{
+		dir:      dir,
+		policy:   policy,
+		interval: interval,
+		logs:     make(map[string]*tableLog),
+	}, nil
+}
+
+// Returns path of the table log file.
+func (this *writeAheadLog) path(table string) string {
+	return filepath.Join(this.dir, table+walFileExtension)
+}
+
+// Returns path of the snapshot written by compaction.
+func (this *writeAheadLog) snapshotPath() string {
+	return filepath.Join(this.dir, walSnapshotFile)
+}
+
+// Returns sorted names of tables that have log files.
+func (this *writeAheadLog) tables() ([]string, error) {
+	files, err := os.ReadDir(this.dir)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for _, file := range files {
+		name := file.Name()
+		if !file.IsDir() && strings.HasSuffix(name, walFileExtension) {
+			tables = append(tables, strings.TrimSuffix(name, walFileExtension))
+		}
+	}
+	sort.Strings(tables)
+	return tables, nil
+}
+
+// Opens log of the table for appending, sequence numbers continue after seq.
+// Returns nil when logging is disabled or the log can not be opened.
+func (this *writeAheadLog) open(table string, seq uint64) *tableLog {
+	if this == nil {
+		return nil
+	}
+	file, err := os.OpenFile(this.path(table), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		logError("failed to open log of table", table, err.Error())
+		return nil
+	}
+	log := &tableLog{
+		file: file,
+		seq:  seq,
+		sync: this.policy == walSyncAlways,
+	}
+	if info, err := file.Stat(); err == nil {
+		log.size = info.Size()
+	}
+	this.mutex.Lock()
+	this.logs[table] = log
+	this.mutex.Unlock()
+	return log
+}
+
+// Removes entries that are included in the snapshot from logs of the tables.
+func (this *writeAheadLog) truncate(sequences map[string]uint64) {
+	for table, seq := range sequences {
+		this.mutex.Lock()
+		log := this.logs[table]
+		this.mutex.Unlock()
+		if log == nil {
+			continue
+		}
+		if err := log.truncate(seq); err != nil {
+			logError("failed to truncate log of table", table, err.Error())
+		}
+	}
+}
+
+// Returns total size of table logs.
+func (this *writeAheadLog) size() int64 {
+	var size int64
+	for _, log := range this.tableLogs() {
+		size += log.fileSize()
+	}
+	return size
+}
+
+// Returns logs of all tables.
+func (this *writeAheadLog) tableLogs() []*tableLog {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	logs := make([]*tableLog, 0, len(this.logs))
+	for _, log := range this.logs {
+		logs = append(logs, log)
+	}
+	return logs
+}
+
+// run syncs table logs when policy is interval and closes them on quit.
+func (this *writeAheadLog) run(quit *Quitter) {
+	quit.Join()
+	defer quit.Leave()
+	var tick <-chan time.Time
+	if this.policy == walSyncInterval {
+		ticker := time.NewTicker(this.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+			for _, log := range this.tableLogs() {
+				log.syncDirty()
+			}
+		case <-quit.GetChan():
+			for _, log := range this.tableLogs() {
+				log.close()
+			}
+			debug("write-ahead log closed")
+			return
+		}
+	}
+}
+
+// Reads entries of the log file.
+// Returns entries and size of the log they occupy, incomplete or corrupted entry at the end of the log is ignored.
+func readLog(path string) ([]*walEntry, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var entries []*walEntry
+	var size int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				logWarn("ignoring incomplete entry at the end of log", path)
+			}
+			return entries, size, nil
+		}
+		if err != nil {
+			return entries, size, err
+		}
+		entry := new(walEntry)
+		if err = json.Unmarshal(line, entry); err != nil {
+			logWarn("ignoring log", path, "after corrupted entry:", err.Error())
+			return entries, size, nil
+		}
+		entries = append(entries, entry)
+		size += int64(len(line))
+	}
+}
+
+// TABLE logging
+
+// Logs record inserted or pushed to the table.
+// Ephemeral records do not outlive connections that own them and are never logged.
+func (this *table) logInsert(action string, rec *record, back bool, scheduled uint64) {
+	if this.wal == nil || rec.ephemeral {
+		return
+	}
+	entry := &walEntry{
+		Op:        action,
+		Id:        rec.id(),
+		Front:     !back,
+		Priority:  rec.priority,
+		Scheduled: scheduled,
+	}
+	for _, col := range this.colSlice[1:] {
+		if val := rec.getValue(col.ordinal); len(val) > 0 {
+			entry.Cols = append(entry.Cols, col.name)
+			entry.Vals = append(entry.Vals, val)
+		}
+	}
+	this.wal.append(entry)
+}
+
+// Logs updated values of the record.
+func (this *table) logUpdate(rec *record, colVals []*columnValue) {
+	if this.wal == nil || rec.ephemeral {
+		return
+	}
+	entry := &walEntry{
+		Op:   "update",
+		Id:   rec.id(),
+		Cols: make([]string, len(colVals)),
+		Vals: make([]string, len(colVals)),
+	}
+	for idx, colVal := range colVals {
+		entry.Cols[idx] = colVal.col
+		entry.Vals[idx] = colVal.val
+	}
+	this.wal.append(entry)
+}
+
+// Logs record removed from the table.
+func (this *table) logDelete(rec *record) {
+	if this.wal == nil || rec.ephemeral {
+		return
+	}
+	this.wal.append(&walEntry{Op: "delete", Id: rec.id()})
+}
+
+// Logs reserved record with its delivery count.
+func (this *table) logReserve(rec *record) {
+	if this.wal == nil || rec.ephemeral {
+		return
+	}
+	this.wal.append(&walEntry{Op: "reserve", Id: rec.id(), Deliveries: rec.deliveries})
+}
+
+// Logs key or tag definition.
+func (this *table) logIndex(action string, column string) {
+	if this.wal == nil {
+		return
+	}
+	this.wal.append(&walEntry{Op: action, Cols: []string{column}})
+}
+
+// Logs push that is due later.
+// Returns sequence of the entry that is logged again when the push is completed.
+func (this *table) logSchedule(req *sqlPushRequest, due time.Time) uint64 {
+	if this.wal == nil {
+		return 0
+	}
+	return this.wal.append(newScheduleEntry(req, due))
+}
+
+// Returns entry describing push request that is due later.
+func newScheduleEntry(req *sqlPushRequest, due time.Time) *walEntry {
+	entry := &walEntry{
+		Op:       "schedule",
+		Front:    req.front,
+		Priority: req.priority,
+		Due:      due.UnixNano(),
+		Cols:     make([]string, len(req.colVals)),
+		Vals:     make([]string, len(req.colVals)),
+	}
+	for idx, colVal := range req.colVals {
+		entry.Cols[idx] = colVal.col
+		entry.Vals[idx] = colVal.val
+	}
+	return entry
+}
+
+// Returns push request described by schedule entry.
+func (this *walEntry) pushRequest() *sqlPushRequest {
+	req := &sqlPushRequest{front: this.Front, priority: this.Priority}
+	req.colVals = this.columnValues()
+	return req
+}
+
+// TABLE replay
+
+// Applies logged mutations to the table without publishing them.
+// Pushes that were scheduled but not completed are scheduled again.
+// Reservations do not survive restart, reserved records reappear at the front of the queue with their delivery count.
+func (this *table) replay(entries []*walEntry) {
+	var pending []*walEntry
+	// removes completed push from pending ones
+	complete := func(seq uint64) {
+		for idx, entry := range pending {
+			if seq > 0 && entry.Seq == seq {
+				pending = append(pending[:idx], pending[idx+1:]...)
+				return
+			}
+		}
+	}
+	for _, entry := range entries {
+		switch entry.Op {
+		case "insert", "push":
+			this.replayInsert(entry)
+			complete(entry.Scheduled)
+		case "update":
+			this.replayUpdate(entry)
+		case "delete":
+			if rec := this.getRecord(entry.Id); rec != nil {
+				this.deleteRecord(rec)
+				rec.free()
+			}
+		case "reserve":
+			this.replayReserve(entry)
+		case "key":
+			this.replayIndex(entry, columnTypeKey)
+		case "tag":
+			this.replayIndex(entry, columnTypeTag)
+		case "restore":
+			if entry.Snapshot != nil {
+				this.restore(entry.Snapshot)
+			}
+		case "schedule":
+			pending = append(pending, entry)
+		case "unschedule":
+			complete(entry.Scheduled)
+		default:
+			logWarn("ignoring unknown log entry", entry.Op, "of table", this.name)
+		}
+	}
+	for _, entry := range pending {
+		this.scheduled.add(entry.pushRequest(), time.Unix(0, entry.Due), entry.Seq)
+	}
+	this.publishSchemaColumns()
+	this.resetTimer()
+}
+
+// Adds logged record with its original id.
+func (this *table) replayInsert(entry *walEntry) {
+	if entry.Id < len(this.records) {
+		logWarn("ignoring log entry", entry.Seq, "of table", this.name, "for existing record", entry.Id)
+		return
+	}
+	// ids of records that were not logged stay empty
+	for len(this.records) < entry.Id {
+		addRecordToSlice(&this.records, nil)
+	}
+	rec, id := this.prepareRecord()
+	colVals := entry.columnValues()
+	cols := make([]*column, len(colVals))
+	for idx, colVal := range colVals {
+		cols[idx], _ = this.getAddColumn(colVal.col)
+	}
+	this.bindRecord(cols, colVals, rec, id)
+	rec.priority = entry.Priority
+	this.addNewRecord(rec, !entry.Front)
+}
+
+// Moves reserved record to the front of the queue and restores its delivery count.
+func (this *table) replayReserve(entry *walEntry) {
+	rec := this.getRecord(entry.Id)
+	if rec == nil {
+		return
+	}
+	rec.deliveries = entry.Deliveries
+	this.unlinkRecord(rec)
+	this.linkRecord(rec, false)
+}
+
+// Updates logged record values.
+func (this *table) replayUpdate(entry *walEntry) {
+	rec := this.getRecord(entry.Id)
+	if rec == nil {
+		logWarn("ignoring log entry", entry.Seq, "of table", this.name, "for missing record", entry.Id)
+		return
+	}
+	colVals := entry.columnValues()
+	cols := make([]*column, len(colVals))
+	for idx, colVal := range colVals {
+		cols[idx], _ = this.getAddColumn(colVal.col)
+	}
+	this.updateRecord(cols, colVals, rec, entry.Id)
+}
+
+// Defines logged key or tag.
+func (this *table) replayIndex(entry *walEntry, coltyp columnType) {
+	if len(entry.Cols) == 0 {
+		return
+	}
+	if col := this.getColumn(entry.Cols[0]); col != nil && col.isIndexed() {
+		return
+	}
+	this.tagOrKeyColumn(entry.Cols[0], coltyp)
+}
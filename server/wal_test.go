@@ -0,0 +1,227 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import "os"
+import "path/filepath"
+import "testing"
+import "time"
+
+func TestParseWalSyncPolicy(t *testing.T) {
+	policy, interval, valid := parseWalSyncPolicy("always")
+	ASSERT_TRUE(t, valid && policy == walSyncAlways && interval == 0, "always")
+	policy, interval, valid = parseWalSyncPolicy("never")
+	ASSERT_TRUE(t, valid && policy == walSyncNever && interval == 0, "never")
+	policy, interval, valid = parseWalSyncPolicy("250ms")
+	ASSERT_TRUE(t, valid && policy == walSyncInterval && interval == 250*time.Millisecond, "250ms")
+	_, _, valid = parseWalSyncPolicy("0ms")
+	ASSERT_FALSE(t, valid, "0ms")
+	_, _, valid = parseWalSyncPolicy("sometimes")
+	ASSERT_FALSE(t, valid, "sometimes")
+}
+
+func startLoggedDataService(t *testing.T, dir string) (*Quitter, *dataService) {
+	return startCompactedDataService(t, dir, 0)
+}
+
+func startCompactedDataService(t *testing.T, dir string, compactInterval time.Duration) (*Quitter, *dataService) {
+	quit, dataSrv := newLoggedDataService(t, dir)
+	dataSrv.compactInterval = compactInterval
+	runLoggedDataService(t, quit, dataSrv, "")
+	return quit, dataSrv
+}
+
+// Returns data service with write-ahead log that is not started yet.
+func newLoggedDataService(t *testing.T, dir string) (*Quitter, *dataService) {
+	quit := NewQuitter()
+	dataSrv := newDataService(quit)
+	wal, err := newWriteAheadLog(dir, walSyncAlways, 0)
+	if err != nil {
+		t.Fatalf("failed to create write-ahead log %s", err.Error())
+	}
+	dataSrv.wal = wal
+	return quit, dataSrv
+}
+
+// Restores tables from the snapshot and write-ahead log and starts the data service.
+func runLoggedDataService(t *testing.T, quit *Quitter, dataSrv *dataService, snapshotPath string) {
+	if err := dataSrv.restore(snapshotPath); err != nil {
+		t.Fatalf("failed to replay write-ahead log %s", err.Error())
+	}
+	go dataSrv.wal.run(quit)
+	go dataSrv.run()
+}
+
+func TestWriteAheadLogReplay(t *testing.T) {
+	dir := t.TempDir()
+	quit, dataSrv := startLoggedDataService(t, dir)
+	sender := newResponseSenderStub(1)
+	statements := []string{
+		" insert into stocks (ticker, bid, sector) values (IBM, 123, TECH) ",
+		" insert into stocks (ticker, bid, sector) values (MSFT, 37, TECH) ",
+		" insert ephemeral into stocks (ticker, bid) values (ORCL, 30) ",
+		" key stocks ticker ",
+		" tag stocks sector ",
+		" update stocks set bid = 140 where ticker = IBM ",
+		" delete from stocks where ticker = MSFT ",
+		" push into jobs (name) values (job1) ",
+		" push front into jobs (name) values (job0) ",
+		" push into jobs priority 5 (name) values (job2) ",
+		" pop front * from jobs ",
+		" push into jobs (name) values (job3) delay 1h ",
+	}
+	for _, sql := range statements {
+		dataSrv.acceptRequest(sqlHelper(sql, sender))
+		if _, ok := sender.testRecv().(*errorResponse); ok {
+			t.Errorf("unexpected error for %s", sql)
+		}
+	}
+	quit.Quit(time.Millisecond * 1000)
+	// restart
+	quit, dataSrv = startLoggedDataService(t, dir)
+	dataSrv.acceptRequest(sqlHelper(" select * from stocks ", sender))
+	res := sender.testRecv()
+	validateSqlSelect(t, res, 1, 4)
+	rec := res.(*sqlSelectResponse).records[0]
+	if rec.getValue(1) != "IBM" || rec.getValue(2) != "140" {
+		t.Errorf("expected updated IBM record but got %v", rec.values)
+	}
+	dataSrv.acceptRequest(sqlHelper(" insert into stocks (ticker) values (IBM) ", sender))
+	validateErrorResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" select * from stocks where sector = TECH ", sender))
+	validateSqlSelect(t, sender.testRecv(), 1, 4)
+	// queue order survives the restart
+	for _, name := range []string{"job0", "job1"} {
+		dataSrv.acceptRequest(sqlHelper(" pop front * from jobs ", sender))
+		res, ok := sender.testRecv().(*sqlActionDataResponse)
+		if !ok || len(res.records) != 1 || res.records[0].getValue(1) != name {
+			t.Errorf("expected %s to be popped", name)
+		}
+	}
+	dataSrv.acceptRequest(sqlHelper(" pop front * from jobs ", sender))
+	validatePopRows(t, sender.testRecv(), 0)
+	quit.Quit(time.Millisecond * 1000)
+	if len(dataSrv.tables["jobs"].scheduled.pushes) != 1 {
+		t.Errorf("expected scheduled push to be restored")
+	}
+}
+
+func TestWriteAheadLogReserve(t *testing.T) {
+	dir := t.TempDir()
+	quit, dataSrv := startLoggedDataService(t, dir)
+	sender := newResponseSenderStub(1)
+	dataSrv.acceptRequest(sqlHelper(" push into jobs (name) values (job1) ", sender))
+	sender.testRecv()
+	dataSrv.acceptRequest(sqlHelper(" push into jobs (name) values (job2) ", sender))
+	sender.testRecv()
+	dataSrv.acceptRequest(sqlHelper(" reserve back from jobs timeout 60s ", sender))
+	validateReserve(t, sender.testRecv(), "1", 1)
+	quit.Quit(time.Millisecond * 1000)
+	// reservation does not survive restart, record reappears at the front with its delivery count
+	quit, dataSrv = startLoggedDataService(t, dir)
+	dataSrv.acceptRequest(sqlHelper(" ack jobs 1 ", sender))
+	validateErrorResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" reserve front from jobs timeout 60s ", sender))
+	validateReserve(t, sender.testRecv(), "1", 2)
+	quit.Quit(time.Millisecond * 1000)
+}
+
+func TestWriteAheadLogIncompleteEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stocks"+walFileExtension)
+	complete := `{"seq":1,"op":"insert","id":0,"cols":["ticker"],"vals":["IBM"]}` + "\n"
+	os.WriteFile(path, []byte(complete+`{"seq":2,"op":"ins`), 0644)
+	entries, size, err := readLog(path)
+	if err != nil || len(entries) != 1 || size != int64(len(complete)) {
+		t.Errorf("expected one complete entry but got %d entries of size %d", len(entries), size)
+	}
+	tbl := newTable("stocks")
+	tbl.replay(entries)
+	validateTableRecordsCount(t, tbl, 1)
+	validateRecordValue(t, tbl.getRecord(0), 1, "IBM")
+}
+
+func waitForCompaction(t *testing.T, dataSrv *dataService, size int64) {
+	for i := 0; i < 200; i++ {
+		walSize, lastSnapshot, _ := dataSrv.persistenceStatus()
+		if !lastSnapshot.IsZero() && walSize < size {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected write-ahead log to be compacted")
+}
+
+func TestWriteAheadLogCompaction(t *testing.T) {
+	dir := t.TempDir()
+	quit, dataSrv := startCompactedDataService(t, dir, 20*time.Millisecond)
+	sender := newResponseSenderStub(1)
+	dataSrv.acceptRequest(sqlHelper(" insert into stocks (ticker, bid) values (IBM, 123) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	for i := 0; i < 50; i++ {
+		dataSrv.acceptRequest(sqlHelper(" push into jobs (name) values (job) ", sender))
+		sender.testRecv()
+		dataSrv.acceptRequest(sqlHelper(" pop front * from jobs ", sender))
+		validatePopRows(t, sender.testRecv(), 1)
+	}
+	size, _, _ := dataSrv.persistenceStatus()
+	waitForCompaction(t, dataSrv, size)
+	// tail after the snapshot
+	dataSrv.acceptRequest(sqlHelper(" update stocks set bid = 140 where id = 0 ", sender))
+	validateSqlUpdate(t, sender.testRecv(), 1)
+	quit.Quit(time.Millisecond * 1000)
+	if _, err := os.Stat(filepath.Join(dir, walSnapshotFile)); err != nil {
+		t.Errorf("expected compaction snapshot %s", err.Error())
+	}
+	// recover from snapshot and tail
+	quit, dataSrv = startLoggedDataService(t, dir)
+	dataSrv.acceptRequest(sqlHelper(" select * from stocks ", sender))
+	res := sender.testRecv()
+	validateSqlSelect(t, res, 1, 3)
+	validateRecordValue(t, res.(*sqlSelectResponse).records[0], 2, "140")
+	dataSrv.acceptRequest(sqlHelper(" pop front * from jobs ", sender))
+	validatePopRows(t, sender.testRecv(), 0)
+	_, _, replayDuration := dataSrv.persistenceStatus()
+	ASSERT_TRUE(t, replayDuration > 0, "replay duration")
+	quit.Quit(time.Millisecond * 1000)
+}
+
+func TestWriteAheadLogRestoreAfterCompaction(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(t.TempDir(), "backup.snapshot")
+	quit, dataSrv := newLoggedDataService(t, dir)
+	dataSrv.snapshotPath = path
+	dataSrv.compactInterval = 20 * time.Millisecond
+	runLoggedDataService(t, quit, dataSrv, "")
+	sender := newResponseSenderStub(1)
+	dataSrv.acceptRequest(sqlHelper(" insert into stocks (ticker, bid) values (IBM, 123) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" snapshot ", sender))
+	validateOkResponse(t, sender.testRecv())
+	dataSrv.acceptRequest(sqlHelper(" insert into stocks (ticker, bid) values (MSFT, 37) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	size, _, _ := dataSrv.persistenceStatus()
+	waitForCompaction(t, dataSrv, size)
+	dataSrv.acceptRequest(sqlHelper(" insert into stocks (ticker, bid) values (ORCL, 30) ", sender))
+	validateSqlInsertResponse(t, sender.testRecv())
+	quit.Quit(time.Millisecond * 1000)
+	// older snapshot does not lose records of truncated log entries
+	quit, dataSrv = newLoggedDataService(t, dir)
+	runLoggedDataService(t, quit, dataSrv, path)
+	dataSrv.acceptRequest(sqlHelper(" select * from stocks ", sender))
+	validateSqlSelect(t, sender.testRecv(), 3, 3)
+	quit.Quit(time.Millisecond * 1000)
+}
@@ -0,0 +1,147 @@
+/* Copyright (C) 2013 CompleteDB LLC.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with PubSubSQL.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package server
+
+import (
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Determines if table name is a pattern such as orders_* or *.
+func isTablePattern(name string) bool {
+	return strings.Contains(name, "*")
+}
+
+// Determines if table name matches the pattern.
+func matchTablePattern(pattern string, name string) bool {
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
+
+// wildcardSubscription subscribes a client to every existing and future table that matches the pattern.
+// Subscriptions in individual tables share the same pubsubid and tag events with the table name.
+type wildcardSubscription struct {
+	id  uint64
+	req *sqlSubscribeRequest
+}
+
+// Returns subscribe request for a table matching the pattern.
+func (this *wildcardSubscription) tableRequest(table string) *requestItem {
+	req := *this.req
+	req.table = table
+	req.pubsubid = this.id
+	req.setStreaming()
+	return &requestItem{
+		req:    &req,
+		sender: this.req.sender,
+	}
+}
+
+// Returns unsubscribe request for a table matching the pattern.
+func (this *wildcardSubscription) tableUnsubscribeRequest(table string) *requestItem {
+	req := &sqlUnsubscribeRequest{
+		connectionId: this.req.sender.connectionId,
+	}
+	req.table = table
+	req.filter.addFilter("pubsubid", strconv.FormatUint(this.id, 10))
+	req.setStreaming()
+	return &requestItem{
+		req:    req,
+		sender: this.req.sender,
+	}
+}
+
+// wildcardBroker is a collection container for wildcard subscriptions.
+// It is owned by dataService and is only accessed from the data service event loop.
+type wildcardBroker struct {
+	subscriptions []*wildcardSubscription
+}
+
+// wildcardBroker factory
+func newWildcardBroker() *wildcardBroker {
+	return &wildcardBroker{}
+}
+
+// Adds wildcard subscription and returns it.
+func (this *wildcardBroker) subscribe(req *sqlSubscribeRequest) *wildcardSubscription {
+	wsub := &wildcardSubscription{
+		id:  atomic.AddUint64(&subid, 1),
+		req: req,
+	}
+	this.subscriptions = append(this.subscriptions, wsub)
+	return wsub
+}
+
+// Returns subscribe requests for a newly created table.
+// Subscriptions of closed connections are removed.
+func (this *wildcardBroker) tableRequests(table string) []*requestItem {
+	var items []*requestItem
+	active := this.subscriptions[:0]
+	for _, wsub := range this.subscriptions {
+		if wsub.req.sender.quit.Done() {
+			continue
+		}
+		active = append(active, wsub)
+		if matchTablePattern(wsub.req.table, table) {
+			items = append(items, wsub.tableRequest(table))
+		}
+	}
+	this.subscriptions = active
+	return items
+}
+
+// Removes wildcard subscriptions with the pattern for a given connection.
+// When pubsubid is not empty only the matching subscription is removed.
+func (this *wildcardBroker) unsubscribe(pattern string, connectionId uint64, pubsubid string) []*wildcardSubscription {
+	var removed []*wildcardSubscription
+	active := this.subscriptions[:0]
+	for _, wsub := range this.subscriptions {
+		if wsub.req.table == pattern && wsub.req.sender.connectionId == connectionId &&
+			(len(pubsubid) == 0 || strconv.FormatUint(wsub.id, 10) == pubsubid) {
+			removed = append(removed, wsub)
+			continue
+		}
+		active = append(active, wsub)
+	}
+	this.subscriptions = active
+	return removed
+}
+
+// Removes all wildcard subscriptions for a closed connection.
+func (this *wildcardBroker) connectionClosed(connectionId uint64) {
+	active := this.subscriptions[:0]
+	for _, wsub := range this.subscriptions {
+		if wsub.req.sender.connectionId != connectionId {
+			active = append(active, wsub)
+		}
+	}
+	this.subscriptions = active
+}
+
+// Removes wildcard subscription with the pubsubid.
+// Returns removed subscription or nil when it does not exist.
+func (this *wildcardBroker) kill(pubsubid uint64) *wildcardSubscription {
+	for idx, wsub := range this.subscriptions {
+		if wsub.id == pubsubid {
+			this.subscriptions = append(this.subscriptions[:idx], this.subscriptions[idx+1:]...)
+			return wsub
+		}
+	}
+	return nil
+}